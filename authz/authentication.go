@@ -0,0 +1,62 @@
+package authz
+
+import (
+	"log"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+// AuthenticationAdvisor can tell if guest denied an action would be allowed
+// to perform it after authenticating, so denials can be reported to guests
+// as missing authentication rather than as lack of permissions.
+type AuthenticationAdvisor interface {
+	AllowedIfAuthenticated(action, resource interface{}) bool
+}
+
+// build time guarantee that OsoAuthorizer implement AuthenticationAdvisor
+var _ AuthenticationAdvisor = &OsoAuthorizer{}
+
+// TitleStore provides titles users hold. It is implemented by
+// store.DBManager.
+type TitleStore interface {
+	// Titles returns distinct titles users hold in organization with
+	// provided ID, or in any organization if ID is zero.
+	Titles(organizationID int) ([]string, error)
+}
+
+// WithTitles makes AllowedIfAuthenticated consider titles users hold in
+// provided store. Without store only users without title are considered.
+func WithTitles(store TitleStore) Option {
+	return func(o *options) {
+		o.titles = store
+	}
+}
+
+// AllowedIfAuthenticated reports if any authenticated user would be allowed
+// to perform action on resource. Identity of guest is not known before
+// authentication, so users without title and with every title users hold
+// (see WithTitles) are tried, none of them owns or belongs to anything.
+// Answer is therefore only accurate for decisions that do not depend on who
+// the user is, like those about requests.
+func (e *OsoAuthorizer) AllowedIfAuthenticated(action, resource interface{}) bool {
+	titles := []string{""}
+	if e.titles != nil {
+		held, err := e.titles.Titles(0)
+		if err != nil {
+			log.Printf("loading titles: %v", err)
+		}
+		titles = append(titles, held...)
+	}
+	for _, title := range titles {
+		probe := model.User{
+			ID:          -1,
+			Email:       "authenticated",
+			Title:       title,
+			Memberships: []model.Membership{{Title: title}},
+		}
+		if e.Authorize(probe, action, resource) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package authz
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+// titleStore is TitleStore with fixed titles.
+type titleStore []string
+
+func (s titleStore) Titles(organizationID int) ([]string, error) {
+	return s, nil
+}
+
+func TestAllowedIfAuthenticated(t *testing.T) {
+	data := []struct {
+		name    string
+		titles  TitleStore
+		method  string
+		path    string
+		allowed bool
+	}{
+		{"submit", nil, http.MethodPut, "/expenses/submit", true},
+		{"admin only", titleStore{"developer", "admin"}, http.MethodGet, "/admin/impersonations", true},
+		{"admin only without admins", titleStore{"developer"}, http.MethodGet, "/admin/impersonations", false},
+		{"admin only without store", nil, http.MethodGet, "/admin/impersonations", false},
+		{"unknown path", titleStore{"admin"}, http.MethodGet, "/unknown", false},
+		{"unknown method", titleStore{"admin"}, http.MethodPatch, "/expenses/submit", false},
+	}
+	for _, d := range data {
+		d := d
+		t.Run(d.name, func(t *testing.T) {
+			var opts []Option
+			if d.titles != nil {
+				opts = append(opts, WithTitles(d.titles))
+			}
+			manager, err := NewAuthorizer(Policy, opts...)
+			if err != nil {
+				t.Fatalf("failed to create authorizer: %v", err)
+			}
+			req, _ := http.NewRequest(d.method, d.path, nil)
+			if manager.Authorize(model.User{}, d.method, req) {
+				t.Fatalf("expected guest to be denied")
+			}
+			if allowed := manager.AllowedIfAuthenticated(d.method, req); allowed != d.allowed {
+				t.Fatalf("expected %v, got %v", d.allowed, allowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+// Package authz decides if actors are allowed to perform actions on resources,
+// based on Polar policies evaluated by OSO.
+package authz
+
+import (
+	_ "embed"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/osohq/go-oso"
+	"go.uber.org/multierr"
+
+	"github.com/delicb/oso-go-tutorial/authz/polarlint"
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+// Policy contains production permission policies defined in external file.
+//
+//go:embed authorization.polar
+var Policy string
+
+// OsoAuthorizer is Authorizer backed by OSO engine.
+type OsoAuthorizer struct {
+	engine oso.Oso
+
+	// policies and constants authorizer was created with, tracer is
+	// created from them when first needed
+	policies string
+
+	traceMu   sync.Mutex
+	constants map[string]interface{}
+	tracer    *tracer
+
+	// titles users hold, nil if not known
+	titles TitleStore
+}
+
+// Authorizer can determine if actor has permission to perform action on an object.
+type Authorizer interface {
+	// Authorize performs a check if action has permission to perform action on a resource.
+	Authorize(actor, action, resource interface{}) bool
+}
+
+// Option customizes authorizer created by NewAuthorizer.
+type Option func(*options)
+
+type options struct {
+	constants map[string]interface{}
+	titles    TitleStore
+}
+
+// WithConstant makes provided value available in policies under provided name.
+//
+// Constants exposing data from stores (Hierarchy, Spending, Reports) are
+// always registered, so policies referencing them load without store set,
+// they just see no data then. Policies can not handle errors, so store
+// errors are logged and methods of those constants return the same result
+// as if there was no data.
+func WithConstant(name string, value interface{}) Option {
+	return func(o *options) {
+		o.constants[name] = value
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{constants: map[string]interface{}{
+		hierarchyName: Hierarchy{},
+		spendingName:  Spending{},
+		reportsName:   Reports{},
+	}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// classes returns types registered with OSO. They are available in policies
+// by their type name.
+func classes() []reflect.Type {
+	return []reflect.Type{
+		// http types
+		reflect.TypeOf(http.Request{}),
+
+		// domain types
+		reflect.TypeOf(model.User{}),
+		reflect.TypeOf(model.Organization{}),
+		reflect.TypeOf(model.Expense{}),
+		reflect.TypeOf(model.ExpenseReport{}),
+		reflect.TypeOf(model.Delegation{}),
+		reflect.TypeOf(model.Category{}),
+		reflect.TypeOf(model.ServiceAccount{}),
+
+		// library
+		reflect.TypeOf(Lib{}),
+	}
+}
+
+// NewAuthorizer returns new instance of authorizer.
+// Uses OSO as a backed. In order for returned authorizer to be capable
+// of making decisions, set of polar policies should be passed as parameter.
+// Domain types are registered and some utility stuff (like http.Request and
+// small library with utility functions).
+// Policies are linted first, errors found by linter are returned as
+// *LintError and warnings are logged.
+func NewAuthorizer(policies string, opts ...Option) (*OsoAuthorizer, error) {
+	o := newOptions(opts)
+
+	// fail early on mistakes OSO would only report when evaluating queries
+	issues, err := lint(policies, o)
+	if err != nil {
+		return nil, fmt.Errorf("linting policies: %w", err)
+	}
+	if polarlint.HasErrors(issues) {
+		return nil, &LintError{Issues: issues}
+	}
+	for _, issue := range issues {
+		log.Printf("policy %v", issue)
+	}
+
+	engine, err := newEngine(policies, o.constants)
+	if err != nil {
+		return nil, err
+	}
+	return &OsoAuthorizer{engine: engine, policies: policies, constants: o.constants, titles: o.titles}, nil
+}
+
+// newEngine returns OSO engine with domain types and provided constants
+// registered and policies loaded.
+func newEngine(policies string, constants map[string]interface{}) (oso.Oso, error) {
+	engine, err := oso.NewOso()
+	if err != nil {
+		return engine, fmt.Errorf("creating OSO engine: %w", err)
+	}
+
+	// register types used in policies
+	for _, cls := range classes() {
+		err = multierr.Append(err, engine.RegisterClass(cls, nil))
+	}
+	if err != nil {
+		return engine, fmt.Errorf("registering classes failed: %w", err)
+	}
+
+	for name, value := range constants {
+		if err := engine.RegisterConstant(value, name); err != nil {
+			return engine, fmt.Errorf("registering constant %q: %w", name, err)
+		}
+	}
+
+	// load policy
+	if err := engine.LoadString(policies); err != nil {
+		return engine, fmt.Errorf("loading policies: %w", err)
+	}
+	return engine, nil
+}
+
+// build time guarantee that OsoAuthorizer implement Authorizer
+var _ Authorizer = &OsoAuthorizer{}
+
+// Authorize utilizes OSO engine and loaded policies in order to determine
+// if provided actor has a permission to perform an action on provided resource.
+func (e *OsoAuthorizer) Authorize(actor, action, resource interface{}) bool {
+	allowed, err := e.engine.IsAllowed(actor, action, resource)
+	// if we got any error, we interpret that as not-authorized, but we log an error for debugging
+	// since in normal operation we should get no-error and true/false
+	if err != nil {
+		log.Printf("authorization resolution error: %v", err)
+		return false
+	}
+	return allowed
+}
+
+// Lib holds utility functions that might be useful for evaluating policies
+type Lib struct{}
+
+func (_ Lib) Split(what string, separator string) []string {
+	return strings.Split(what, separator)
+}
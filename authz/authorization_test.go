@@ -1,14 +1,18 @@
-package main
+package authz
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
 	"testing"
+
+	"github.com/delicb/oso-go-tutorial/model"
 )
 
-func getManager(t *testing.T) *authManager {
+func getManager(t *testing.T) *OsoAuthorizer {
 	t.Helper()
 	// load production policy, since that is the one we want to test here
 	// this also checks that authorization.polar is in a good shape, since during
@@ -28,7 +32,7 @@ func getManager(t *testing.T) *authManager {
 
 type httpAuthRequest struct {
 	expectedAllow bool
-	user          User
+	user          model.User
 	action        string
 	path          string
 	// request       *http.Request
@@ -40,67 +44,67 @@ func TestAuthByHTTPPath(t *testing.T) {
 	data := []httpAuthRequest{
 		{
 			true,
-			User{},
+			model.User{},
 			"GET",
 			"/",
 		},
 		{
 			false,
-			User{},
+			model.User{},
 			"POST",
 			"/",
 		},
 		{
 			true,
-			User{},
+			model.User{},
 			"GET",
 			"/whoami",
 		},
 		{
 			false,
-			User{},
+			model.User{},
 			"PUT",
 			"/whoami",
 		},
 		{
 			false,
-			User{},
+			model.User{},
 			"GET",
 			"/random",
 		},
 		{
 			true,
-			User{},
+			model.User{},
 			"GET",
 			"/expenses/1",
 		},
 		{
 			true,
-			User{},
+			model.User{},
 			"GET",
 			"/expenses",
 		},
 		{
 			false,
-			User{},
+			model.User{},
 			"PUT",
 			"/expenses/1",
 		},
 		{
 			false,
-			User{},
+			model.User{},
 			"PUT",
 			"/expenses/submit",
 		},
 		{
 			true,
-			User{Email: "test@example.com"}, // make user authenticated
+			model.User{Email: "test@example.com"}, // make user authenticated
 			"PUT",
 			"/expenses/submit",
 		},
 		{
 			false,
-			User{Email: "test@example.com"}, // make user authenticated
+			model.User{Email: "test@example.com"}, // make user authenticated
 			"POST",
 			"/expenses/submit",
 		},
@@ -120,9 +124,9 @@ func TestAuthByHTTPPath(t *testing.T) {
 
 type expenseRequest struct {
 	expectedAllow bool
-	user          User
+	user          model.User
 	action        string
-	expense       Expense
+	expense       model.Expense
 }
 
 func TestExpenseAuth(t *testing.T) {
@@ -131,21 +135,21 @@ func TestExpenseAuth(t *testing.T) {
 	data := []expenseRequest{
 		{
 			true,
-			User{ID: 1},
+			model.User{ID: 1},
 			"read",
-			Expense{ID: 1, UserID: 1},
+			model.Expense{ID: 1, UserID: 1},
 		},
 		{
 			false,
-			User{ID: 1},
+			model.User{ID: 1},
 			"write",
-			Expense{ID: 1, UserID: 1},
+			model.Expense{ID: 1, UserID: 1},
 		},
 		{
 			false,
-			User{ID: 1},
+			model.User{ID: 1},
 			"read",
-			Expense{ID: 1, UserID: 2},
+			model.Expense{ID: 1, UserID: 2},
 		},
 	}
 
@@ -162,9 +166,9 @@ func TestExpenseAuth(t *testing.T) {
 
 type organizationsRequest struct {
 	expectedAllow bool
-	user          User
+	user          model.User
 	action        string
-	organization  Organization
+	organization  model.Organization
 }
 
 func TestOrganizationsAuth(t *testing.T) {
@@ -173,21 +177,21 @@ func TestOrganizationsAuth(t *testing.T) {
 	data := []organizationsRequest{
 		{
 			true,
-			User{ID: 1, OrganizationID: 1},
+			model.User{ID: 1, OrganizationID: 1, Memberships: []model.Membership{{OrganizationID: 1}}},
 			"read",
-			Organization{ID: 1, Name: "org"},
+			model.Organization{ID: 1, Name: "org"},
 		},
 		{
 			false,
-			User{ID: 1, OrganizationID: 1},
+			model.User{ID: 1, OrganizationID: 1, Memberships: []model.Membership{{OrganizationID: 1}}},
 			"write",
-			Organization{ID: 1, Name: "org"},
+			model.Organization{ID: 1, Name: "org"},
 		},
 		{
 			false,
-			User{ID: 1, OrganizationID: 2},
+			model.User{ID: 1, OrganizationID: 2, Memberships: []model.Membership{{OrganizationID: 2}}},
 			"write",
-			Organization{ID: 1, Name: "org"},
+			model.Organization{ID: 1, Name: "org"},
 		},
 	}
 
@@ -202,3 +206,14 @@ func TestOrganizationsAuth(t *testing.T) {
 	}
 
 }
+
+func TestNewAuthorizer_LintErrors(t *testing.T) {
+	_, err := NewAuthorizer(`allow(_user, "GET", request: Request) if request.URL.Pth = "/";`)
+	var lintErr *LintError
+	if !errors.As(err, &lintErr) {
+		t.Fatalf("expected lint error, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), `unknown field "Pth"`) {
+		t.Fatalf("unexpected error message: %v", err)
+	}
+}
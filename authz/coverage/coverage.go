@@ -0,0 +1,248 @@
+// Package coverage reports which rules of a policy are exercised by
+// authorization checks, usually by policy tests.
+//
+// Polar evaluation traces (POLAR_LOG) do not report every rule that gets
+// applied, so instead of parsing them, policy is instrumented: every rule
+// gets a probe call appended to its body, which counts how many times the
+// rule succeeded. Rules whose head matched, but body failed, are not covered.
+package coverage
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"sync/atomic"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/authz/polarsrc"
+)
+
+// probeName is name of constant probe is available as in instrumented policy.
+const probeName = "CoverageProbe"
+
+// probe is called from instrumented rules. OSO passes constants by value,
+// so hits are stored in a slice shared between copies.
+type probe struct {
+	hits []int64
+}
+
+// Hit records that rule with provided index succeeded. It always
+// returns true, so it does not change outcome of the rule.
+func (p probe) Hit(rule int) bool {
+	atomic.AddInt64(&p.hits[rule], 1)
+	return true
+}
+
+// Recorder is authz.Authorizer that records which policy rules were
+// applied while making decisions.
+type Recorder struct {
+	auth  *authz.OsoAuthorizer
+	rules []polarsrc.Rule
+	probe probe
+}
+
+// NewRecorder returns recorder making decisions based on instrumented
+// copy of provided policy. Options are passed to authz.NewAuthorizer.
+func NewRecorder(policy string, opts ...authz.Option) (*Recorder, error) {
+	all, err := polarsrc.Rules(policy)
+	if err != nil {
+		return nil, fmt.Errorf("parsing policy: %w", err)
+	}
+
+	rec := &Recorder{}
+	var instrumented strings.Builder
+	for _, rule := range all {
+		if rule.IsQuery() {
+			instrumented.WriteString(rule.Text + "\n")
+			continue
+		}
+		instrumented.WriteString(instrument(rule, len(rec.rules)) + "\n")
+		rec.rules = append(rec.rules, rule)
+	}
+	rec.probe = probe{hits: make([]int64, len(rec.rules))}
+
+	opts = append(opts, authz.WithConstant(probeName, rec.probe))
+	rec.auth, err = authz.NewAuthorizer(instrumented.String(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("loading instrumented policy: %w", err)
+	}
+	return rec, nil
+}
+
+// instrument returns rule source with probe call appended to its body, so
+// probe is only reached once the rest of the body succeeded.
+func instrument(rule polarsrc.Rule, index int) string {
+	call := fmt.Sprintf("%s.Hit(%d)", probeName, index)
+	body := rule.BodyText()
+	if body == "" {
+		// fact, becomes rule with probe as the only condition
+		return fmt.Sprintf("%s if %s;", rule.HeadText(), call)
+	}
+	return fmt.Sprintf("%s if (%s) and %s;", rule.HeadText(), body, call)
+}
+
+// build time guarantee that Recorder implement Authorizer
+var _ authz.Authorizer = &Recorder{}
+
+// Authorize makes decision using instrumented policy, recording applied rules.
+func (r *Recorder) Authorize(actor, action, resource interface{}) bool {
+	return r.auth.Authorize(actor, action, resource)
+}
+
+// build time guarantee that Recorder implement Reasoner
+var _ authz.Reasoner = &Recorder{}
+
+// DenyReasons returns deny reasons using instrumented policy, recording
+// applied rules.
+func (r *Recorder) DenyReasons(actor, action, resource interface{}) []string {
+	return r.auth.DenyReasons(actor, action, resource)
+}
+
+// Report returns coverage collected so far.
+func (r *Recorder) Report() Report {
+	report := Report{}
+	for i, rule := range r.rules {
+		hits := int(atomic.LoadInt64(&r.probe.hits[i]))
+		report.Rules = append(report.Rules, RuleCoverage{Rule: rule, Hits: hits})
+	}
+	return report
+}
+
+// RuleCoverage is number of times single rule was applied.
+type RuleCoverage struct {
+	Rule polarsrc.Rule
+	Hits int
+}
+
+// Report is coverage of all rules in a policy.
+type Report struct {
+	Rules []RuleCoverage
+}
+
+// Merge sums hits from provided reports, e.g. of recorders used for
+// different test suites. All reports must be created for the same policy.
+func Merge(reports ...Report) Report {
+	merged := Report{}
+	for _, r := range reports {
+		if merged.Rules == nil {
+			merged.Rules = append([]RuleCoverage(nil), r.Rules...)
+			continue
+		}
+		for i, rc := range r.Rules {
+			merged.Rules[i].Hits += rc.Hits
+		}
+	}
+	return merged
+}
+
+// Covered returns number of rules applied at least once and total number of rules.
+func (r Report) Covered() (covered, total int) {
+	for _, rc := range r.Rules {
+		if rc.Hits > 0 {
+			covered++
+		}
+	}
+	return covered, len(r.Rules)
+}
+
+// Uncovered returns rules that were never applied.
+func (r Report) Uncovered() []polarsrc.Rule {
+	var rules []polarsrc.Rule
+	for _, rc := range r.Rules {
+		if rc.Hits == 0 {
+			rules = append(rules, rc.Rule)
+		}
+	}
+	return rules
+}
+
+// Percent returns percentage of covered rules.
+func (r Report) Percent() float64 {
+	covered, total := r.Covered()
+	if total == 0 {
+		return 100
+	}
+	return float64(covered) / float64(total) * 100
+}
+
+// WriteText writes report as plain text, one line per rule.
+func (r Report) WriteText(w io.Writer) error {
+	covered, total := r.Covered()
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d/%d rules covered (%.1f%%)\n", covered, total, r.Percent())
+	for _, rc := range r.Rules {
+		mark := ""
+		if rc.Hits == 0 {
+			mark = "  NOT COVERED"
+		}
+		fmt.Fprintf(&b, "line %4d  %5d hits  %s%s\n", rc.Rule.Line, rc.Hits, firstLine(rc.Rule.Text), mark)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteHTML writes report as standalone HTML page, with policy source
+// annotated with hit counts and covered and uncovered rules highlighted.
+// Source has to be the same policy report was created for.
+func (r Report) WriteHTML(w io.Writer, source string) error {
+	type line struct {
+		Number int
+		Text   string
+		Class  string
+		Hits   string
+	}
+
+	lines := strings.Split(source, "\n")
+	data := struct {
+		Covered, Total int
+		Percent        float64
+		Lines          []line
+	}{Lines: make([]line, len(lines)), Percent: r.Percent()}
+	data.Covered, data.Total = r.Covered()
+
+	for i, text := range lines {
+		data.Lines[i] = line{Number: i + 1, Text: text}
+	}
+	for _, rc := range r.Rules {
+		class := "covered"
+		if rc.Hits == 0 {
+			class = "uncovered"
+		}
+		for n := rc.Rule.Line; n <= rc.Rule.EndLine && n <= len(lines); n++ {
+			data.Lines[n-1].Class = class
+		}
+		data.Lines[rc.Rule.Line-1].Hits = fmt.Sprint(rc.Hits)
+	}
+	return htmlReport.Execute(w, data)
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i] + " ..."
+	}
+	return s
+}
+
+var htmlReport = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Policy coverage</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; font-family: monospace; }
+td { padding: 0 8px; white-space: pre; }
+td.num, td.hits { color: #888; text-align: right; }
+tr.covered td.src { background: #dfd; }
+tr.uncovered td.src { background: #fdd; }
+</style>
+</head>
+<body>
+<h1>Policy coverage: {{.Covered}}/{{.Total}} rules ({{printf "%.1f" .Percent}}%)</h1>
+<table>
+{{range .Lines}}<tr class="{{.Class}}"><td class="num">{{.Number}}</td><td class="hits">{{.Hits}}</td><td class="src">{{.Text}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
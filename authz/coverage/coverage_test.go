@@ -0,0 +1,127 @@
+package coverage
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+func TestRecorder(t *testing.T) {
+	rec, err := NewRecorder(authz.Policy)
+	if err != nil {
+		t.Fatalf("failed to create recorder: %v", err)
+	}
+
+	// instrumentation must not change decisions
+	if !rec.Authorize(model.User{ID: 1}, "read", model.Expense{UserID: 1}) {
+		t.Fatalf("expected expense read to be allowed")
+	}
+	if rec.Authorize(model.User{ID: 1}, "read", model.Expense{UserID: 2}) {
+		t.Fatalf("expected expense read to be denied")
+	}
+	if !rec.Authorize(model.User{}, "GET", &http.Request{URL: &url.URL{Path: "/"}}) {
+		t.Fatalf("expected index to be allowed")
+	}
+
+	report := rec.Report()
+	hits := make(map[string]int)
+	for _, rc := range report.Rules {
+		// rules are identified by first line, first rule with it wins
+		if _, seen := hits[firstLine(rc.Rule.Text)]; !seen {
+			hits[firstLine(rc.Rule.Text)] = rc.Hits
+		}
+	}
+	data := []struct {
+		rule string
+		hits int
+	}{
+		// only allowed read succeeded, denied one matched heads only
+		{`allow(user: User, "read", expense: Expense) if ...`, 1},
+		{`submitted(user: User, expense: Expense) if ...`, 1},
+		{`allow(_user, "GET", request: Request) if ...`, 1},
+		{`allow_by_path(_user, "GET", "organizations", _rest);`, 0},
+	}
+	for _, d := range data {
+		if hits[d.rule] != d.hits {
+			t.Errorf("expected %d hits for %q, got %d", d.hits, d.rule, hits[d.rule])
+		}
+	}
+
+	covered, total := report.Covered()
+	if covered == 0 || covered == total || len(report.Uncovered()) != total-covered {
+		t.Errorf("unexpected coverage %d/%d, uncovered: %v", covered, total, report.Uncovered())
+	}
+
+	var text, html bytes.Buffer
+	if err := report.WriteText(&text); err != nil {
+		t.Fatalf("failed to write text report: %v", err)
+	}
+	if !strings.Contains(text.String(), "NOT COVERED") {
+		t.Errorf("text report does not flag uncovered rules: %s", text.String())
+	}
+	if err := report.WriteHTML(&html, authz.Policy); err != nil {
+		t.Fatalf("failed to write html report: %v", err)
+	}
+	if !strings.Contains(html.String(), `class="uncovered"`) {
+		t.Errorf("html report does not highlight uncovered rules")
+	}
+}
+
+func TestRecorder_FailedBody(t *testing.T) {
+	rec, err := NewRecorder(`allow(user: User, "read", expense: Expense) if user.ID = expense.UserID;`)
+	if err != nil {
+		t.Fatalf("failed to create recorder: %v", err)
+	}
+
+	// head matches, body fails
+	if rec.Authorize(model.User{ID: 1}, "read", model.Expense{UserID: 2}) {
+		t.Fatalf("expected expense read to be denied")
+	}
+	if uncovered := rec.Report().Uncovered(); len(uncovered) != 1 {
+		t.Fatalf("expected rule with failed body to be uncovered, got %v", uncovered)
+	}
+
+	if !rec.Authorize(model.User{ID: 1}, "read", model.Expense{UserID: 1}) {
+		t.Fatalf("expected expense read to be allowed")
+	}
+	if uncovered := rec.Report().Uncovered(); len(uncovered) != 0 {
+		t.Fatalf("expected succeeded rule to be covered, got %v", uncovered)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	first, err := NewRecorder(authz.Policy)
+	if err != nil {
+		t.Fatalf("failed to create recorder: %v", err)
+	}
+	second, err := NewRecorder(authz.Policy)
+	if err != nil {
+		t.Fatalf("failed to create recorder: %v", err)
+	}
+	first.Authorize(model.User{}, "GET", &http.Request{URL: &url.URL{Path: "/"}})
+	second.Authorize(model.User{}, "GET", &http.Request{URL: &url.URL{Path: "/"}})
+	second.Authorize(model.User{ID: 1}, "read", model.Organization{ID: 1})
+
+	firstReport := first.Report()
+	merged := Merge(firstReport, second.Report())
+	covered, _ := merged.Covered()
+	secondCovered, _ := second.Report().Covered()
+	if covered != secondCovered {
+		t.Fatalf("expected %d covered rules, got %d", secondCovered, covered)
+	}
+	for _, rc := range merged.Rules {
+		if firstLine(rc.Rule.Text) == `allow(_user, "GET", request: Request) if ...` && rc.Hits != 2 {
+			t.Fatalf("expected hits of both reports to be summed, got %d", rc.Hits)
+		}
+	}
+	for i := range firstReport.Rules {
+		if firstReport.Rules[i].Hits > 1 {
+			t.Fatalf("merge must not modify merged reports")
+		}
+	}
+}
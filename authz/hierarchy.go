@@ -0,0 +1,60 @@
+package authz
+
+import (
+	"log"
+	"time"
+)
+
+// hierarchyName is name Hierarchy is available as in policies.
+const hierarchyName = "Hierarchy"
+
+// HierarchyStore provides management chain of users and delegations of
+// approval rights. It is implemented by store.DBManager.
+type HierarchyStore interface {
+	// ReportsTo reports if user with userID is direct or transitive report
+	// of user with managerID. It must terminate for cyclic chains.
+	ReportsTo(userID, managerID int) (bool, error)
+	// ActiveDelegators returns IDs of users whose delegations to user with
+	// provided ID are active at provided time.
+	ActiveDelegators(delegateID int, at time.Time) ([]int, error)
+}
+
+// Hierarchy exposes management chain to policies, since it can not be
+// resolved from models alone. Without store nobody manages anybody.
+type Hierarchy struct {
+	store HierarchyStore
+}
+
+// WithHierarchy makes management chain from provided store available in
+// policies as Hierarchy.
+func WithHierarchy(store HierarchyStore) Option {
+	return WithConstant(hierarchyName, Hierarchy{store: store})
+}
+
+// Manages reports if user with managerID is direct or transitive manager of
+// user with userID.
+func (h Hierarchy) Manages(managerID, userID int) bool {
+	if h.store == nil {
+		return false
+	}
+	reports, err := h.store.ReportsTo(userID, managerID)
+	if err != nil {
+		log.Printf("checking if %d manages %d: %v", managerID, userID, err)
+		return false
+	}
+	return reports
+}
+
+// DelegatorsOf returns IDs of users that currently delegate their approval
+// rights to user with provided ID.
+func (h Hierarchy) DelegatorsOf(userID int) []int {
+	if h.store == nil {
+		return []int{}
+	}
+	delegators, err := h.store.ActiveDelegators(userID, time.Now())
+	if err != nil {
+		log.Printf("loading delegators of %d: %v", userID, err)
+		return []int{}
+	}
+	return delegators
+}
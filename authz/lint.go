@@ -0,0 +1,60 @@
+package authz
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/delicb/oso-go-tutorial/authz/polarlint"
+)
+
+// builtinClasses are registered by OSO itself.
+var builtinClasses = map[string]reflect.Type{
+	"Boolean":    reflect.TypeOf(true),
+	"Integer":    reflect.TypeOf(int(1)),
+	"Float":      reflect.TypeOf(float64(1.0)),
+	"String":     reflect.TypeOf(""),
+	"List":       reflect.TypeOf([]interface{}{}),
+	"Dictionary": reflect.TypeOf(map[string]interface{}{}),
+}
+
+// entryPoints are rules queried by application.
+var entryPoints = []string{"allow", denyReasonRule}
+
+// LintError is returned by NewAuthorizer when linter finds errors in policies.
+type LintError struct {
+	// Issues contains all found issues, including warnings.
+	Issues []polarlint.Issue
+}
+
+func (e *LintError) Error() string {
+	var errs []string
+	for _, issue := range e.Issues {
+		if issue.Severity == polarlint.Error {
+			errs = append(errs, issue.String())
+		}
+	}
+	return "policy has errors: " + strings.Join(errs, "; ")
+}
+
+// Lint checks policies for mistakes, in the same environment (registered
+// classes and constants) NewAuthorizer evaluates them in.
+func Lint(policies string, opts ...Option) ([]polarlint.Issue, error) {
+	return lint(policies, newOptions(opts))
+}
+
+func lint(policies string, o *options) ([]polarlint.Issue, error) {
+	cfg := polarlint.Config{
+		Classes:     make(map[string]reflect.Type),
+		EntryPoints: entryPoints,
+	}
+	for name, cls := range builtinClasses {
+		cfg.Classes[name] = cls
+	}
+	for _, cls := range classes() {
+		cfg.Classes[cls.Name()] = cls
+	}
+	for name, value := range o.constants {
+		cfg.Classes[name] = reflect.TypeOf(value)
+	}
+	return polarlint.Lint(policies, cfg)
+}
@@ -0,0 +1,329 @@
+// Package polarlint finds mistakes in Polar policies that OSO would only
+// report (if at all) when a query is evaluated, like typos in field names.
+package polarlint
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/delicb/oso-go-tutorial/authz/polarsrc"
+)
+
+// Severity of found issue.
+type Severity int
+
+const (
+	// Warning is issue that does not prevent policy from working as intended,
+	// but it is suspicious (e.g. unused rule).
+	Warning Severity = iota
+	// Error is issue that would cause policy evaluation to fail or silently deny.
+	Error
+)
+
+func (s Severity) String() string {
+	if s == Error {
+		return "error"
+	}
+	return "warning"
+}
+
+// Issue is single problem found in policy.
+type Issue struct {
+	Line     int
+	Severity Severity
+	Message  string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("line %d: %s: %s", i.Line, i.Severity, i.Message)
+}
+
+// Config describes environment policy is evaluated in.
+type Config struct {
+	// Classes contains all classes and constants registered with OSO, by
+	// name they are available in policy, mapped to their Go type.
+	Classes map[string]reflect.Type
+	// EntryPoints are rules queried by application (e.g. "allow"), they
+	// are never reported as unused.
+	EntryPoints []string
+}
+
+// keywords of Polar language, never treated as variables or rule calls.
+var keywords = map[string]bool{
+	"if": true, "and": true, "or": true, "not": true, "matches": true,
+	"in": true, "forall": true, "cut": true, "new": true, "print": true,
+	"debug": true, "isa": true, "true": true, "false": true, "nil": true,
+}
+
+// Lint checks provided policy source. Returned error means policy could not
+// be analyzed at all (e.g. due to syntax error), problems in policy are
+// returned as issues, sorted by line.
+func Lint(src string, cfg Config) ([]Issue, error) {
+	rules, err := polarsrc.Rules(src)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &linter{cfg: cfg, defined: make(map[string]int), called: make(map[string]bool)}
+	for _, rule := range rules {
+		if !rule.IsQuery() {
+			if _, exists := l.defined[rule.Name]; !exists {
+				l.defined[rule.Name] = rule.Line
+			}
+		}
+	}
+	for _, rule := range rules {
+		l.lintRule(rule)
+	}
+	l.checkRuleUsage()
+
+	sort.Slice(l.issues, func(i, j int) bool {
+		if l.issues[i].Line != l.issues[j].Line {
+			return l.issues[i].Line < l.issues[j].Line
+		}
+		return l.issues[i].Message < l.issues[j].Message
+	})
+	return l.issues, nil
+}
+
+// HasErrors reports if any of provided issues is an error.
+func HasErrors(issues []Issue) bool {
+	for _, i := range issues {
+		if i.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+type linter struct {
+	cfg    Config
+	issues []Issue
+	// defined maps rule names to line they are first defined on
+	defined map[string]int
+	// called contains names of rules called from other rules
+	called map[string]bool
+	// calls are rule calls, checked once all rules are known
+	calls []polarsrc.Token
+}
+
+func (l *linter) report(line int, severity Severity, format string, args ...interface{}) {
+	l.issues = append(l.issues, Issue{Line: line, Severity: severity, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) lintRule(rule polarsrc.Rule) {
+	tokens := rule.Tokens
+	if !rule.IsQuery() {
+		// skip rule name, it is not a call
+		tokens = tokens[1:]
+	}
+
+	types := make(map[string]reflect.Type)
+	occurrences := make(map[string][]polarsrc.Token)
+	var brackets []string
+
+	for i, t := range tokens {
+		prev, next := tokenAt(tokens, i-1), tokenAt(tokens, i+1)
+
+		if t.Kind == polarsrc.Punct {
+			switch t.Text {
+			case "(", "[", "{":
+				brackets = append(brackets, t.Text)
+			case ")", "]", "}":
+				if len(brackets) > 0 {
+					brackets = brackets[:len(brackets)-1]
+				}
+			}
+			continue
+		}
+		if t.Kind != polarsrc.Ident || keywords[t.Text] || prev.Text == "." {
+			continue
+		}
+		inDict := len(brackets) > 0 && brackets[len(brackets)-1] == "{"
+
+		switch {
+		case inDict && next.Text == ":":
+			// dictionary or pattern key
+		case prev.Text == ":" && !inDict, prev.Text == "matches", prev.Text == "new":
+			// class name in specializer, pattern or constructor
+			cls, ok := l.class(t)
+			if !ok {
+				continue
+			}
+			// specializer or matches binds type to variable before it
+			if variable := tokenAt(tokens, i-2); prev.Text != "new" && variable.Kind == polarsrc.Ident && variable.Text != "" {
+				types[variable.Text] = cls
+			}
+		case isClassName(t.Text):
+			// class or constant used directly, e.g. Lib.Split
+			l.class(t)
+		case l.isConstant(t.Text):
+			// lower case constants are not variables
+		case next.Text == "(":
+			l.calls = append(l.calls, t)
+		default:
+			occurrences[t.Text] = append(occurrences[t.Text], t)
+		}
+	}
+
+	l.checkSingletons(occurrences)
+	l.checkLookups(tokens, types)
+}
+
+// class returns type of registered class (or constant) token refers to,
+// reporting an error if class is not registered.
+func (l *linter) class(t polarsrc.Token) (reflect.Type, bool) {
+	cls, ok := l.cfg.Classes[t.Text]
+	if !ok && isClassName(t.Text) {
+		l.report(t.Line, Error, "unregistered class %q", t.Text)
+	}
+	return cls, ok
+}
+
+func (l *linter) isConstant(name string) bool {
+	_, ok := l.cfg.Classes[name]
+	return ok
+}
+
+func (l *linter) checkSingletons(occurrences map[string][]polarsrc.Token) {
+	for name, tokens := range occurrences {
+		if len(tokens) == 1 && !strings.HasPrefix(name, "_") {
+			l.report(tokens[0].Line, Warning, "singleton variable %q is unused or undefined, use _%s if it is intentional", name, name)
+		}
+	}
+}
+
+// checkLookups verifies that attribute and method lookups (e.g.
+// request.URL.Path) exist on types of variables they are made on.
+func (l *linter) checkLookups(tokens []polarsrc.Token, types map[string]reflect.Type) {
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.Kind != polarsrc.Ident || tokenAt(tokens, i-1).Text == "." || tokenAt(tokens, i+1).Text != "." {
+			continue
+		}
+		typ, ok := types[t.Text]
+		if !ok {
+			typ, ok = l.cfg.Classes[t.Text]
+		}
+		if !ok {
+			continue
+		}
+
+		path := t.Text
+		// walk chain of .name and .name(args)
+		for i+2 < len(tokens) && tokens[i+1].Text == "." && tokens[i+2].Kind == polarsrc.Ident {
+			name := tokens[i+2]
+			i += 2
+			isCall := tokenAt(tokens, i+1).Text == "("
+			if isCall {
+				i = skipParens(tokens, i+1)
+			}
+			if typ == nil {
+				continue
+			}
+
+			next, known := lookup(typ, name.Text, isCall)
+			if !known {
+				kind := "field"
+				if isCall {
+					kind = "method"
+				}
+				l.report(name.Line, Error, "unknown %s %q on %s (in %s.%s)", kind, name.Text, typeName(typ), path, name.Text)
+				typ = nil
+			} else {
+				typ = next
+			}
+			path += "." + name.Text
+		}
+	}
+}
+
+func (l *linter) checkRuleUsage() {
+	for _, call := range l.calls {
+		if _, ok := l.defined[call.Text]; !ok {
+			l.report(call.Line, Error, "call to undefined rule %q", call.Text)
+		}
+		l.called[call.Text] = true
+	}
+
+	entry := make(map[string]bool)
+	for _, name := range l.cfg.EntryPoints {
+		entry[name] = true
+	}
+	for name, line := range l.defined {
+		if !entry[name] && !l.called[name] {
+			l.report(line, Warning, "rule %q is never used", name)
+		}
+	}
+}
+
+// lookup returns type of field or result of method with provided name.
+// Second return value is false if there is no such field or method.
+// Nil type is returned when result type can not be checked further.
+func lookup(typ reflect.Type, name string, isCall bool) (reflect.Type, bool) {
+	base := typ
+	for base.Kind() == reflect.Ptr {
+		base = base.Elem()
+	}
+	// only structs are checked, builtin types have methods provided by Polar
+	if base.Kind() != reflect.Struct {
+		return nil, true
+	}
+
+	if m, ok := reflect.PtrTo(base).MethodByName(name); ok {
+		if m.Type.NumOut() == 0 {
+			return nil, true
+		}
+		return checkable(m.Type.Out(0)), true
+	}
+	if f, ok := base.FieldByName(name); ok && !isCall {
+		return checkable(f.Type), true
+	}
+	return nil, false
+}
+
+// checkable returns type if lookups on it can be checked, nil otherwise.
+func checkable(typ reflect.Type) reflect.Type {
+	if typ.Kind() == reflect.Interface {
+		return nil
+	}
+	return typ
+}
+
+func typeName(typ reflect.Type) string {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ.Name()
+}
+
+// skipParens returns index of parenthesis closing one at provided index.
+func skipParens(tokens []polarsrc.Token, open int) int {
+	depth := 0
+	for i := open; i < len(tokens); i++ {
+		switch tokens[i].Text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(tokens) - 1
+}
+
+func tokenAt(tokens []polarsrc.Token, i int) polarsrc.Token {
+	if i < 0 || i >= len(tokens) {
+		return polarsrc.Token{}
+	}
+	return tokens[i]
+}
+
+func isClassName(name string) bool {
+	return name != "" && unicode.IsUpper(rune(name[0]))
+}
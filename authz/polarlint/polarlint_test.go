@@ -0,0 +1,81 @@
+package polarlint
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type user struct {
+	ID int
+}
+
+func (u user) IsAdmin() bool { return false }
+
+type lib struct{}
+
+func (lib) Split(s, sep string) []string { return strings.Split(s, sep) }
+
+var testConfig = Config{
+	Classes: map[string]reflect.Type{
+		"User":    reflect.TypeOf(user{}),
+		"Request": reflect.TypeOf(http.Request{}),
+		"Lib":     reflect.TypeOf(lib{}),
+		"List":    reflect.TypeOf([]interface{}{}),
+	},
+	EntryPoints: []string{"allow"},
+}
+
+func lintMessages(t *testing.T, policy string) []string {
+	t.Helper()
+	issues, err := Lint(policy, testConfig)
+	if err != nil {
+		t.Fatalf("unexpected lint failure: %v", err)
+	}
+	var messages []string
+	for _, i := range issues {
+		messages = append(messages, i.String())
+	}
+	return messages
+}
+
+func TestLint_Clean(t *testing.T) {
+	policy := `
+allow(user: User, "GET", request: Request) if
+    request.URL.Path = "/" and user.IsAdmin() and helper(user);
+allow(_user, "read", req: Request) if
+    Lib.Split(req.URL.Path, "/") = [_, *rest] and rest matches List and x = {key: 1} and x.key = 1;
+helper(u: User) if u.ID = 1;
+`
+	if messages := lintMessages(t, policy); len(messages) != 0 {
+		t.Fatalf("expected no issues, got: %v", messages)
+	}
+}
+
+func TestLint_Issues(t *testing.T) {
+	data := []struct {
+		name     string
+		policy   string
+		expected string
+	}{
+		{"unknown field", `allow(_u, "GET", r: Request) if r.URL.Pth = "/";`, `line 1: error: unknown field "Pth" on URL (in r.URL.Pth)`},
+		{"unknown method", `allow(u: User, _a, _r) if u.IsAdmn();`, `line 1: error: unknown method "IsAdmn" on user (in u.IsAdmn)`},
+		{"unknown method on class", `allow(_u, _a, r) if Lib.Splitt(r, "/") = [];`, `line 1: error: unknown method "Splitt" on lib (in Lib.Splitt)`},
+		{"unregistered specializer", `allow(_u, _a, _r: Expens);`, `line 1: error: unregistered class "Expens"`},
+		{"unregistered matches", `allow(_u, _a, r) if r matches Expens;`, `line 1: error: unregistered class "Expens"`},
+		{"unused rule", "allow(_u, _a, _r);\nunused(_x);", `line 2: warning: rule "unused" is never used`},
+		{"undefined rule", `allow(u, _a, _r) if missing(u);`, `line 1: error: call to undefined rule "missing"`},
+		{"singleton", `allow(user, _a, _r);`, `line 1: warning: singleton variable "user" is unused or undefined`},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.name, func(t *testing.T) {
+			messages := lintMessages(t, d.policy)
+			if !strings.Contains(strings.Join(messages, "\n"), d.expected) {
+				t.Fatalf("expected issue %q, got: %v", d.expected, messages)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+// Package polarsrc provides light-weight analysis of Polar policy source.
+//
+// It is not a full Polar parser, it only understands enough of the syntax
+// (tokens, rules and their boundaries) to support tooling like coverage
+// reports and linting.
+package polarsrc
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// TokenKind is type of lexical token.
+type TokenKind int
+
+const (
+	Ident TokenKind = iota
+	String
+	Number
+	Punct
+)
+
+// Token is single lexical token with its position in source.
+type Token struct {
+	Kind TokenKind
+	Text string
+	// Line is 1-based line number token starts on.
+	Line int
+	// Offset is byte offset of token in source.
+	Offset int
+}
+
+// Rule is single rule (or inline query) from policy source.
+type Rule struct {
+	// Name of the rule, e.g. "allow". Inline queries have name "?=".
+	Name string
+	// Line and EndLine are 1-based lines rule starts and ends on.
+	Line    int
+	EndLine int
+	// Text is rule source, including terminating semicolon.
+	Text string
+	// Tokens of the rule, without terminating semicolon.
+	Tokens []Token
+}
+
+// IsQuery reports if rule is inline query (?= ...) and not a real rule.
+func (r Rule) IsQuery() bool {
+	return r.Name == "?="
+}
+
+// Head returns tokens of rule head, e.g. everything before "if".
+func (r Rule) Head() []Token {
+	for i, t := range r.Tokens {
+		if t.Kind == Ident && t.Text == "if" {
+			return r.Tokens[:i]
+		}
+	}
+	return r.Tokens
+}
+
+// Body returns tokens after "if", or nil for facts.
+func (r Rule) Body() []Token {
+	for i, t := range r.Tokens {
+		if t.Kind == Ident && t.Text == "if" {
+			return r.Tokens[i+1:]
+		}
+	}
+	return nil
+}
+
+// HeadText returns source of rule head, e.g. everything before "if".
+func (r Rule) HeadText() string {
+	start := r.Tokens[0].Offset
+	head := r.Head()
+	if len(head) == len(r.Tokens) {
+		return strings.TrimSpace(strings.TrimSuffix(r.Text, ";"))
+	}
+	return strings.TrimSpace(r.Text[:r.Tokens[len(head)].Offset-start])
+}
+
+// BodyText returns source of rule body, without "if" and terminating
+// semicolon, or empty string for facts.
+func (r Rule) BodyText() string {
+	body := r.Body()
+	if len(body) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimSuffix(r.Text[body[0].Offset-r.Tokens[0].Offset:], ";"))
+}
+
+// Tokenize splits Polar source into tokens, skipping whitespace and comments.
+func Tokenize(src string) ([]Token, error) {
+	var tokens []Token
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '"':
+			start, startLine := i, line
+			i++
+			for i < len(src) && src[i] != '"' {
+				if src[i] == '\\' {
+					i++
+				}
+				if i < len(src) && src[i] == '\n' {
+					line++
+				}
+				i++
+			}
+			if i >= len(src) {
+				return nil, fmt.Errorf("line %d: unterminated string", startLine)
+			}
+			i++
+			tokens = append(tokens, Token{String, src[start:i], startLine, start})
+		case isIdentStart(c):
+			start := i
+			for i < len(src) && isIdentPart(src[i]) {
+				i++
+			}
+			tokens = append(tokens, Token{Ident, src[start:i], line, start})
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(src) && (src[i] >= '0' && src[i] <= '9' || src[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, Token{Number, src[start:i], line, start})
+		default:
+			start := i
+			i++
+			// two character operators
+			if i < len(src) {
+				switch src[start : i+1] {
+				case "==", "!=", "<=", ">=", ":=", "?=":
+					i++
+				}
+			}
+			tokens = append(tokens, Token{Punct, src[start:i], line, start})
+		}
+	}
+	return tokens, nil
+}
+
+// Rules splits policy source into rules.
+func Rules(src string) ([]Rule, error) {
+	tokens, err := Tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []Rule
+	var current []Token
+	depth := 0
+	for _, t := range tokens {
+		if t.Kind == Punct {
+			switch t.Text {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				depth--
+			}
+		}
+		if t.Kind == Punct && t.Text == ";" && depth == 0 {
+			if len(current) == 0 {
+				continue
+			}
+			rules = append(rules, newRule(src, current, t))
+			current = nil
+			continue
+		}
+		current = append(current, t)
+	}
+	if len(current) > 0 {
+		return rules, fmt.Errorf("line %d: rule is not terminated with ';'", current[0].Line)
+	}
+	return rules, nil
+}
+
+func newRule(src string, tokens []Token, semicolon Token) Rule {
+	return Rule{
+		Name:    tokens[0].Text,
+		Line:    tokens[0].Line,
+		EndLine: semicolon.Line,
+		Text:    src[tokens[0].Offset : semicolon.Offset+1],
+		Tokens:  tokens,
+	}
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || unicode.IsLetter(rune(c))
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9'
+}
@@ -0,0 +1,49 @@
+package polarsrc
+
+import (
+	"testing"
+)
+
+const testPolicy = `# comment with "quotes"; and semicolon
+allow(user: User, "GET", request: Request) if
+    request.URL.Path = "/a;b";
+
+allow_by_path(_user, "GET", "expenses", [_, *rest]);
+?= allow(1, 2, 3);
+`
+
+func TestRules(t *testing.T) {
+	rules, err := Rules(testPolicy)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rules) != 3 {
+		t.Fatalf("expected 3 rules, got %d: %v", len(rules), rules)
+	}
+
+	first := rules[0]
+	if first.Name != "allow" || first.Line != 2 || first.EndLine != 3 {
+		t.Errorf("unexpected first rule: %+v", first)
+	}
+	if len(first.Head()) == len(first.Tokens) || first.Body()[0].Text != "request" {
+		t.Errorf("unexpected head/body split: %v / %v", first.Head(), first.Body())
+	}
+	if first.HeadText() != `allow(user: User, "GET", request: Request)` || first.BodyText() != `request.URL.Path = "/a;b"` {
+		t.Errorf("unexpected head/body text: %q / %q", first.HeadText(), first.BodyText())
+	}
+	if rules[1].Body() != nil || rules[1].BodyText() != "" {
+		t.Errorf("fact should not have body")
+	}
+	if rules[1].HeadText() != `allow_by_path(_user, "GET", "expenses", [_, *rest])` {
+		t.Errorf("unexpected fact head text: %q", rules[1].HeadText())
+	}
+	if !rules[2].IsQuery() {
+		t.Errorf("expected inline query, got %q", rules[2].Name)
+	}
+}
+
+func TestRules_Unterminated(t *testing.T) {
+	if _, err := Rules(`allow(_, _, _)`); err == nil {
+		t.Fatalf("expected error for unterminated rule")
+	}
+}
@@ -0,0 +1,61 @@
+package authz_test
+
+import (
+	"testing"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/authz/coverage"
+	"github.com/delicb/oso-go-tutorial/authz/policytest"
+)
+
+// TestPolicyFiles runs declarative policy tests from testdata/policy
+// against production policy.
+func TestPolicyFiles(t *testing.T) {
+	suites, err := policytest.LoadDir("testdata/policy")
+	if err != nil {
+		t.Fatalf("failed to load policy tests: %v", err)
+	}
+	if len(suites) == 0 {
+		t.Fatalf("no policy tests found")
+	}
+
+	for _, suite := range suites {
+		suite := suite
+		t.Run(suite.File, func(t *testing.T) {
+			auth, err := suite.Authorizer(authz.Policy)
+			if err != nil {
+				t.Fatalf("failed to create authorizer: %v", err)
+			}
+			for _, c := range suite.Tests {
+				c := c
+				t.Run(c.Name, func(t *testing.T) {
+					if res := suite.RunCase(auth, c); !res.Passed() {
+						t.Error(res.Diff())
+					}
+				})
+			}
+		})
+	}
+}
+
+// TestPolicyCoverage makes sure every rule of production policy is
+// exercised by declarative policy tests.
+func TestPolicyCoverage(t *testing.T) {
+	suites, err := policytest.LoadDir("testdata/policy")
+	if err != nil {
+		t.Fatalf("failed to load policy tests: %v", err)
+	}
+	var reports []coverage.Report
+	for _, suite := range suites {
+		recorder, err := coverage.NewRecorder(authz.Policy, suite.Options()...)
+		if err != nil {
+			t.Fatalf("failed to create coverage recorder: %v", err)
+		}
+		suite.Run(recorder)
+		reports = append(reports, recorder.Report())
+	}
+
+	for _, rule := range coverage.Merge(reports...).Uncovered() {
+		t.Errorf("rule at line %d is not covered by policy tests: %s", rule.Line, rule.Text)
+	}
+}
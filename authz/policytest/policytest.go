@@ -0,0 +1,309 @@
+// Package policytest runs declarative tests against authorization policies.
+//
+// Tests are described in JSON files, so people writing policies do not have
+// to write Go. File defines named fixtures and list of test cases referencing
+// them:
+//
+//	{
+//	  "users": {
+//	    "alice": {"ID": 1, "Email": "alice@example.com", "OrganizationID": 1}
+//	  },
+//	  "organizations": {"acme": {"ID": 1, "Name": "ACME"}},
+//	  "expenses": {"lunch": {"ID": 1, "UserID": 1, "Amount": 100}},
+//	  "tests": [
+//	    {"name": "owner reads expense", "actor": "alice", "action": "read", "resource": {"expense": "lunch"}, "allow": true},
+//	    {"name": "guest submits", "request": {"method": "PUT", "path": "/expenses/submit"}, "allow": false}
+//	  ]
+//	}
+//
+// Users without "Memberships" are members of their organization only, with
+// their title, like users created in database. Actor is name of user or
+// service account fixture ("service_accounts"), empty actor means guest
+// (unauthenticated) user. When request is used as a
+// resource, action defaults to request method. Cases can also list
+// "reasons" denial is expected to be explained with (see authz.Reasoner).
+//
+// Suite also serves management chain (from ManagerID of user fixtures),
+// delegations fixtures, expense reports and monthly totals of users (from "monthly_totals",
+// mapping user fixture names to amounts) to policies, see Suite.Options.
+package policytest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+// Suite is content of single test file.
+type Suite struct {
+	// File suite was loaded from, used for reporting.
+	File string `json:"-"`
+
+	Users           map[string]model.User           `json:"users"`
+	ServiceAccounts map[string]model.ServiceAccount `json:"service_accounts"`
+	Organizations   map[string]model.Organization   `json:"organizations"`
+	Expenses        map[string]model.Expense        `json:"expenses"`
+	ExpenseReports  map[string]model.ExpenseReport  `json:"expense_reports"`
+	Delegations     map[string]model.Delegation     `json:"delegations"`
+	MonthlyTotals   map[string]int                  `json:"monthly_totals"`
+	Tests           []Case                          `json:"tests"`
+}
+
+// Case is single authorization check with expected result.
+type Case struct {
+	Name     string       `json:"name"`
+	Actor    string       `json:"actor"`
+	Action   string       `json:"action"`
+	Resource ResourceRef  `json:"resource"`
+	Request  *RequestSpec `json:"request"`
+	Allow    bool         `json:"allow"`
+	// Reasons are expected deny reasons, checked only if set.
+	Reasons []string `json:"reasons"`
+}
+
+// ResourceRef references exactly one fixture by its name.
+type ResourceRef struct {
+	Expense       string `json:"expense"`
+	ExpenseReport string `json:"expense_report"`
+	Organization  string `json:"organization"`
+	User          string `json:"user"`
+	Delegation    string `json:"delegation"`
+}
+
+// RequestSpec describes HTTP request used as a resource.
+type RequestSpec struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+}
+
+// Result of running single test case.
+type Result struct {
+	Suite *Suite
+	Case  Case
+	// Got is decision returned by authorizer.
+	Got bool
+	// GotReasons are deny reasons returned by authorizer, if case expects any.
+	GotReasons []string
+	// Err is set if case could not be evaluated (e.g. unknown fixture).
+	Err error
+}
+
+// Passed reports if authorizer made expected decision.
+func (r Result) Passed() bool {
+	return r.Err == nil && r.Got == r.Case.Allow &&
+		(r.Case.Reasons == nil || fmt.Sprint(r.GotReasons) == fmt.Sprint(r.Case.Reasons))
+}
+
+// Diff returns human readable description of failed case, with expected
+// and actual result in diff format. Empty string is returned for passed cases.
+func (r Result) Diff() string {
+	if r.Passed() {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- FAIL: %s: %s\n", r.Suite.File, r.Case.Name)
+	if r.Err != nil {
+		fmt.Fprintf(&b, "    error: %v\n", r.Err)
+		return b.String()
+	}
+	actor, action, resource, _ := r.Suite.resolve(r.Case)
+	fmt.Fprintf(&b, "    actor:    %v\n", actor)
+	fmt.Fprintf(&b, "    action:   %v\n", action)
+	fmt.Fprintf(&b, "    resource: %s\n", describe(resource))
+	fmt.Fprintf(&b, "    - allow: %v\n", r.Case.Allow)
+	fmt.Fprintf(&b, "    + allow: %v\n", r.Got)
+	if r.Case.Reasons != nil {
+		fmt.Fprintf(&b, "    - reasons: %q\n", r.Case.Reasons)
+		fmt.Fprintf(&b, "    + reasons: %q\n", r.GotReasons)
+	}
+	return b.String()
+}
+
+// Load reads test suite from JSON file.
+func Load(file string) (*Suite, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading test file: %w", err)
+	}
+	var suite Suite
+	if err := json.Unmarshal(data, &suite); err != nil {
+		return nil, fmt.Errorf("parsing test file %q: %w", file, err)
+	}
+	suite.File = file
+	// like in database, users are members of their own organization
+	for name, u := range suite.Users {
+		if len(u.Memberships) == 0 && u.OrganizationID != 0 {
+			u.Memberships = []model.Membership{{OrganizationID: u.OrganizationID, Title: u.Title}}
+			suite.Users[name] = u
+		}
+	}
+	return &suite, nil
+}
+
+// LoadDir reads all test suites (files with .json extension) from provided directory.
+func LoadDir(dir string) ([]*Suite, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	suites := make([]*Suite, 0, len(files))
+	for _, file := range files {
+		suite, err := Load(file)
+		if err != nil {
+			return nil, err
+		}
+		suites = append(suites, suite)
+	}
+	return suites, nil
+}
+
+// Options returns authorizer options that make suite fixtures available
+// to policies, e.g. as management chain.
+func (s *Suite) Options() []authz.Option {
+	return []authz.Option{authz.WithHierarchy(s), authz.WithSpending(s), authz.WithReports(s)}
+}
+
+// Authorizer returns authorizer for provided policy, with suite options.
+// Additional options are passed to authz.NewAuthorizer.
+func (s *Suite) Authorizer(policy string, opts ...authz.Option) (*authz.OsoAuthorizer, error) {
+	return authz.NewAuthorizer(policy, append(opts, s.Options()...)...)
+}
+
+// build time guarantee that Suite implement stores used by policies
+var (
+	_ authz.HierarchyStore = &Suite{}
+	_ authz.SpendingStore  = &Suite{}
+	_ authz.ReportStore    = &Suite{}
+)
+
+// ReportsTo walks management chain of user fixtures, stopping on cycles.
+func (s *Suite) ReportsTo(userID, managerID int) (bool, error) {
+	managers := make(map[int]int)
+	for _, u := range s.Users {
+		managers[u.ID] = u.ManagerID
+	}
+	visited := make(map[int]bool)
+	for id := managers[userID]; id != 0 && !visited[id]; id = managers[id] {
+		if id == managerID {
+			return true, nil
+		}
+		visited[id] = true
+	}
+	return false, nil
+}
+
+// ActiveDelegators returns delegators of delegation fixtures active at provided time.
+func (s *Suite) ActiveDelegators(delegateID int, at time.Time) ([]int, error) {
+	delegators := []int{}
+	for _, d := range s.Delegations {
+		if d.DelegateID == delegateID && d.IsActive(at) {
+			delegators = append(delegators, d.DelegatorID)
+		}
+	}
+	return delegators, nil
+}
+
+// SpentInMonth returns monthly total of user fixture, regardless of month.
+func (s *Suite) SpentInMonth(userID int, _ time.Time) (int, error) {
+	for name, u := range s.Users {
+		if u.ID == userID {
+			return s.MonthlyTotals[name], nil
+		}
+	}
+	return 0, nil
+}
+
+// ExpenseReportByID returns expense report fixture with provided ID.
+func (s *Suite) ExpenseReportByID(id int) (model.ExpenseReport, error) {
+	for _, r := range s.ExpenseReports {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+	return model.ExpenseReport{}, fmt.Errorf("no expense report fixture with ID %d", id)
+}
+
+// Run evaluates all test cases from suite using provided authorizer.
+func (s *Suite) Run(auth authz.Authorizer) []Result {
+	results := make([]Result, 0, len(s.Tests))
+	for _, c := range s.Tests {
+		results = append(results, s.RunCase(auth, c))
+	}
+	return results
+}
+
+// RunCase evaluates single test case using provided authorizer.
+func (s *Suite) RunCase(auth authz.Authorizer, c Case) Result {
+	actor, action, resource, err := s.resolve(c)
+	if err != nil {
+		return Result{Suite: s, Case: c, Err: err}
+	}
+	res := Result{Suite: s, Case: c, Got: auth.Authorize(actor, action, resource)}
+	if c.Reasons != nil {
+		reasoner, ok := auth.(authz.Reasoner)
+		if !ok {
+			res.Err = fmt.Errorf("authorizer can not tell deny reasons")
+			return res
+		}
+		res.GotReasons = reasoner.DenyReasons(actor, action, resource)
+	}
+	return res
+}
+
+// resolve converts fixture references from test case to actual objects.
+func (s *Suite) resolve(c Case) (actor interface{}, action string, resource interface{}, err error) {
+	actor = model.User{}
+	if c.Actor != "" {
+		if user, ok := s.Users[c.Actor]; ok {
+			actor = user
+		} else if sa, ok := s.ServiceAccounts[c.Actor]; ok {
+			actor = sa
+		} else {
+			return actor, "", nil, fmt.Errorf("unknown actor fixture %q", c.Actor)
+		}
+	}
+	action = c.Action
+
+	if c.Request != nil {
+		if action == "" {
+			action = c.Request.Method
+		}
+		return actor, action, &http.Request{Method: c.Request.Method, URL: &url.URL{Path: c.Request.Path}}, nil
+	}
+
+	ref := c.Resource
+	var ok bool
+	switch {
+	case ref.Expense != "":
+		resource, ok = s.Expenses[ref.Expense]
+	case ref.ExpenseReport != "":
+		resource, ok = s.ExpenseReports[ref.ExpenseReport]
+	case ref.Organization != "":
+		resource, ok = s.Organizations[ref.Organization]
+	case ref.User != "":
+		resource, ok = s.Users[ref.User]
+	case ref.Delegation != "":
+		resource, ok = s.Delegations[ref.Delegation]
+	default:
+		return actor, action, nil, fmt.Errorf("test case has neither resource nor request")
+	}
+	if !ok {
+		return actor, action, nil, fmt.Errorf("unknown resource fixture %+v", ref)
+	}
+	return actor, action, resource, nil
+}
+
+func describe(resource interface{}) string {
+	if r, ok := resource.(*http.Request); ok {
+		return fmt.Sprintf("<Request: %s %s>", r.Method, r.URL.Path)
+	}
+	return fmt.Sprint(resource)
+}
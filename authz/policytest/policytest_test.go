@@ -0,0 +1,104 @@
+package policytest
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+// records last authorization request and returns configured decision
+type authRecorder struct {
+	allow    bool
+	actor    interface{}
+	action   interface{}
+	resource interface{}
+}
+
+func (a *authRecorder) Authorize(actor, action, resource interface{}) bool {
+	a.actor, a.action, a.resource = actor, action, resource
+	return a.allow
+}
+
+func testSuite() *Suite {
+	return &Suite{
+		File:     "test.json",
+		Users:    map[string]model.User{"alice": {ID: 1, Email: "alice@example.com"}},
+		Expenses: map[string]model.Expense{"lunch": {ID: 1, UserID: 1}},
+	}
+}
+
+func TestRunCase_ResolvesFixtures(t *testing.T) {
+	suite := testSuite()
+	auth := &authRecorder{allow: true}
+
+	res := suite.RunCase(auth, Case{Actor: "alice", Action: "read", Resource: ResourceRef{Expense: "lunch"}, Allow: true})
+	if !res.Passed() {
+		t.Fatalf("expected case to pass, got: %s", res.Diff())
+	}
+	if !reflect.DeepEqual(auth.actor, suite.Users["alice"]) || auth.action != "read" || auth.resource != suite.Expenses["lunch"] {
+		t.Fatalf("unexpected authorization request: %v %v %v", auth.actor, auth.action, auth.resource)
+	}
+}
+
+func TestRunCase_Request(t *testing.T) {
+	auth := &authRecorder{allow: true}
+
+	res := testSuite().RunCase(auth, Case{Request: &RequestSpec{Method: "GET", Path: "/whoami"}, Allow: true})
+	if !res.Passed() {
+		t.Fatalf("expected case to pass, got: %s", res.Diff())
+	}
+	r, ok := auth.resource.(*http.Request)
+	if !ok || r.URL.Path != "/whoami" || auth.action != "GET" {
+		t.Fatalf("unexpected authorization request: %v %v", auth.action, auth.resource)
+	}
+	if u, ok := auth.actor.(model.User); !ok || u.IsAuthenticated() {
+		t.Fatalf("expected guest actor, got %v", auth.actor)
+	}
+}
+
+func TestRunCase_Failures(t *testing.T) {
+	suite := testSuite()
+
+	res := suite.RunCase(&authRecorder{allow: false}, Case{Name: "denied", Actor: "alice", Action: "read", Resource: ResourceRef{Expense: "lunch"}, Allow: true})
+	if res.Passed() {
+		t.Fatalf("expected case to fail")
+	}
+	diff := res.Diff()
+	if !strings.Contains(diff, "- allow: true") || !strings.Contains(diff, "+ allow: false") {
+		t.Fatalf("unexpected diff: %s", diff)
+	}
+
+	res = suite.RunCase(&authRecorder{allow: true}, Case{Actor: "nobody", Action: "read", Resource: ResourceRef{Expense: "lunch"}, Allow: true})
+	if res.Err == nil || res.Passed() {
+		t.Fatalf("expected error for unknown fixture")
+	}
+}
+
+// reasonRecorder is authRecorder that explains denials with fixed reasons
+type reasonRecorder struct {
+	authRecorder
+	reasons []string
+}
+
+func (a *reasonRecorder) DenyReasons(actor, action, resource interface{}) []string {
+	return a.reasons
+}
+
+func TestRunCase_Reasons(t *testing.T) {
+	suite := testSuite()
+	c := Case{Name: "over limit", Actor: "alice", Action: "submit", Resource: ResourceRef{Expense: "lunch"}, Reasons: []string{"over limit"}}
+
+	if res := suite.RunCase(&reasonRecorder{reasons: []string{"over limit"}}, c); !res.Passed() {
+		t.Fatalf("expected case to pass: %s", res.Diff())
+	}
+	res := suite.RunCase(&reasonRecorder{reasons: []string{"other"}}, c)
+	if res.Passed() || !strings.Contains(res.Diff(), `+ reasons: ["other"]`) {
+		t.Fatalf("expected case to fail with reasons diff: %s", res.Diff())
+	}
+	if res := suite.RunCase(&authRecorder{}, c); res.Err == nil {
+		t.Fatalf("expected error for authorizer without reasons")
+	}
+}
@@ -0,0 +1,48 @@
+package authz
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/osohq/go-oso/types"
+)
+
+// denyReasonRule is rule policies define to tell why action is denied,
+// e.g. deny_reason(user, "submit", expense, reason) if ... and reason = "...".
+const denyReasonRule = "deny_reason"
+
+// Reasoner can tell why actor is not allowed to perform an action, so
+// denials can be reported to users with more than "forbidden".
+type Reasoner interface {
+	DenyReasons(actor, action, resource interface{}) []string
+}
+
+// build time guarantee that OsoAuthorizer implement Reasoner
+var _ Reasoner = &OsoAuthorizer{}
+
+// DenyReasons returns reasons defined by deny_reason rules of policy that
+// apply to provided actor, action and resource. Reasons are only
+// explanation, they do not affect decisions made by Authorize.
+func (e *OsoAuthorizer) DenyReasons(actor, action, resource interface{}) []string {
+	q, err := e.engine.NewQueryFromRule(denyReasonRule, actor, action, resource, types.ValueVariable("reason"))
+	if err != nil {
+		log.Printf("querying deny reasons: %v", err)
+		return nil
+	}
+	results, err := q.GetAllResults()
+	if err != nil {
+		log.Printf("querying deny reasons: %v", err)
+		return nil
+	}
+
+	var reasons []string
+	seen := make(map[string]bool)
+	for _, r := range results {
+		reason := fmt.Sprint(r["reason"])
+		if !seen[reason] {
+			seen[reason] = true
+			reasons = append(reasons, reason)
+		}
+	}
+	return reasons
+}
@@ -0,0 +1,53 @@
+package authz
+
+import (
+	"testing"
+	"time"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+type spendingMock map[int]int
+
+func (m spendingMock) SpentInMonth(userID int, _ time.Time) (int, error) {
+	return m[userID], nil
+}
+
+func TestDenyReasons(t *testing.T) {
+	manager, err := NewAuthorizer(Policy, WithSpending(spendingMock{1: 4500}))
+	if err != nil {
+		t.Fatalf("failed to create authorizer: %v", err)
+	}
+	engineer := model.User{ID: 1, Email: "dev@example.com", Title: "developer"}
+
+	data := []struct {
+		name    string
+		amount  int
+		reasons int
+	}{
+		{"within limit", 500, 0},
+		{"over limit", 501, 1},
+	}
+	for _, d := range data {
+		d := d
+		t.Run(d.name, func(t *testing.T) {
+			expense := model.Expense{UserID: 1, Amount: d.amount}
+			reasons := manager.DenyReasons(engineer, "submit", expense)
+			if len(reasons) != d.reasons {
+				t.Fatalf("unexpected reasons: %v", reasons)
+			}
+			if allowed := manager.Authorize(engineer, "submit", expense); allowed != (d.reasons == 0) {
+				t.Fatalf("decision does not match reasons %v: %v", reasons, allowed)
+			}
+		})
+	}
+
+	// policies without deny_reason rules have no reasons
+	plain, err := NewAuthorizer(`allow(_actor, _action, _resource) if false;`)
+	if err != nil {
+		t.Fatalf("failed to create authorizer: %v", err)
+	}
+	if reasons := plain.DenyReasons(engineer, "submit", model.Expense{}); len(reasons) != 0 {
+		t.Fatalf("unexpected reasons: %v", reasons)
+	}
+}
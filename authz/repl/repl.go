@@ -0,0 +1,205 @@
+// Package repl implements interactive shell for evaluating Polar queries
+// against objects loaded from application database. It is meant for
+// debugging authorization decisions.
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/store"
+)
+
+// Engine evaluates queries. It is implemented by *authz.OsoAuthorizer.
+type Engine interface {
+	QueryWithTrace(query string, bindings map[string]interface{}) ([]map[string]interface{}, authz.Trace, error)
+}
+
+const help = `commands:
+  user <id|email> [as <name>]      load user from database (default name: user)
+  expense <id> [as <name>]         load expense from database (default name: expense)
+  organization <id> [as <name>]    load organization from database (default name: organization)
+  vars                             list loaded objects
+  trace on|off                     toggle printing of evaluation traces
+  help                             print this help
+  quit                             exit
+anything else is evaluated as Polar query, e.g. allow(user, "read", expense)`
+
+// variableName matches names objects can be bound to. Capitalized names
+// are reserved for classes.
+var variableName = regexp.MustCompile(`^[a-z_][a-zA-Z0-9_]*$`)
+
+// errQuit is returned by Exec when user asks to leave.
+var errQuit = errors.New("quit")
+
+// REPL keeps state of interactive session.
+type REPL struct {
+	engine Engine
+	db     store.DBManager
+	out    io.Writer
+
+	vars  map[string]interface{}
+	trace bool
+}
+
+// New returns REPL evaluating queries with engine, loading objects from
+// db and printing output to out.
+func New(engine Engine, db store.DBManager, out io.Writer) *REPL {
+	return &REPL{
+		engine: engine,
+		db:     db,
+		out:    out,
+		vars:   make(map[string]interface{}),
+		trace:  true,
+	}
+}
+
+// Run reads commands from in until it is exhausted or user quits.
+// Errors from individual commands are printed, not returned.
+func (r *REPL) Run(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(r.out, "policy> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(r.out)
+			return scanner.Err()
+		}
+		err := r.Exec(scanner.Text())
+		if errors.Is(err, errQuit) {
+			return nil
+		}
+		if err != nil {
+			fmt.Fprintf(r.out, "error: %v\n", err)
+		}
+	}
+}
+
+// Exec executes single command or query.
+func (r *REPL) Exec(line string) error {
+	line = strings.TrimSpace(line)
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	switch fields[0] {
+	case "help":
+		fmt.Fprintln(r.out, help)
+		return nil
+	case "quit", "exit":
+		return errQuit
+	case "vars":
+		r.printVars()
+		return nil
+	case "trace":
+		if len(fields) != 2 || fields[1] != "on" && fields[1] != "off" {
+			return fmt.Errorf("usage: trace on|off")
+		}
+		r.trace = fields[1] == "on"
+		return nil
+	case "user", "expense", "organization":
+		// single word is variable in query, e.g. "user" prints loaded user
+		if len(fields) > 1 {
+			return r.load(fields)
+		}
+	}
+	return r.query(strings.TrimSuffix(line, ";"))
+}
+
+// load fetches object from database and binds it to a name.
+func (r *REPL) load(fields []string) error {
+	kind, ref, name := fields[0], fields[1], fields[0]
+	switch {
+	case len(fields) == 4 && fields[2] == "as":
+		name = fields[3]
+	case len(fields) != 2:
+		return fmt.Errorf("usage: %s <id> [as <name>]", kind)
+	}
+	if !variableName.MatchString(name) {
+		return fmt.Errorf("invalid name %q, names must start with lowercase letter", name)
+	}
+
+	obj, err := r.fetch(kind, ref)
+	if err != nil {
+		return err
+	}
+	r.vars[name] = obj
+	fmt.Fprintf(r.out, "%s = %v\n", name, obj)
+	return nil
+}
+
+func (r *REPL) fetch(kind, ref string) (interface{}, error) {
+	id, idErr := strconv.Atoi(ref)
+	if kind == "user" && idErr != nil {
+		return r.db.UserByEmail(ref)
+	}
+	if idErr != nil {
+		return nil, fmt.Errorf("invalid %s ID %q", kind, ref)
+	}
+	switch kind {
+	case "user":
+		return r.db.UserByID(id)
+	case "expense":
+		return r.db.ExpenseByID(id)
+	default:
+		return r.db.OrganizationByID(id)
+	}
+}
+
+func (r *REPL) query(query string) error {
+	results, trace, err := r.engine.QueryWithTrace(query, r.vars)
+	if err != nil {
+		return err
+	}
+
+	if len(results) == 0 {
+		fmt.Fprintln(r.out, "false")
+	}
+	for _, bindings := range results {
+		if len(bindings) == 0 {
+			fmt.Fprintln(r.out, "true")
+			continue
+		}
+		fmt.Fprintln(r.out, formatBindings(bindings))
+	}
+
+	if r.trace && len(trace) > 0 {
+		fmt.Fprintln(r.out, "trace:")
+		for _, line := range trace {
+			fmt.Fprintf(r.out, "  %s\n", line)
+		}
+	}
+	return nil
+}
+
+func (r *REPL) printVars() {
+	names := make([]string, 0, len(r.vars))
+	for name := range r.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(r.out, "%s = %v\n", name, r.vars[name])
+	}
+}
+
+// formatBindings returns bindings as "name = value" pairs, sorted by name.
+func formatBindings(bindings map[string]interface{}) string {
+	names := make([]string, 0, len(bindings))
+	for name := range bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s = %v", name, bindings[name]))
+	}
+	return strings.Join(parts, ", ")
+}
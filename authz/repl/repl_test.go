@@ -0,0 +1,99 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/store/storetest"
+)
+
+func runSession(t *testing.T, input string) string {
+	t.Helper()
+	return runSessionWith(t, `INSERT INTO expenses (id, user_id, amount, description) VALUES (7, 1, 100, 'lunch'), (8, 2, 50, 'taxi');`, input)
+}
+
+func runSessionWith(t *testing.T, extraSQL, input string) string {
+	t.Helper()
+	auth, err := authz.NewAuthorizer(authz.Policy)
+	if err != nil {
+		t.Fatalf("failed to create authorizer: %v", err)
+	}
+	db := storetest.New(t, storetest.Fixture, extraSQL)
+
+	var out bytes.Buffer
+	if err := New(auth, db, &out).Run(strings.NewReader(input)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return out.String()
+}
+
+func TestREPL(t *testing.T) {
+	out := runSession(t, strings.Join([]string{
+		"user test@example.com",
+		"expense 7",
+		"expense 8 as other",
+		"trace off",
+		`allow(user, "read", expense)`,
+		`allow(user, "read", other);`,
+		`x = user.ID`,
+		"vars",
+		"quit",
+		"user 99", // never executed
+	}, "\n"))
+
+	for _, expected := range []string{
+		"user = <User: test@example.com (id: 1)>",
+		"expense = <Expense: 7 (amount: 100, user: 1)>",
+		"other = <Expense: 8 (amount: 50, user: 2)>",
+		"true\n",
+		"false\n",
+		"x = 1\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected output to contain %q, got:\n%s", expected, out)
+		}
+	}
+	if strings.Contains(out, "trace:") {
+		t.Errorf("trace printed although turned off:\n%s", out)
+	}
+	if strings.Contains(out, "error") {
+		t.Errorf("unexpected error in output:\n%s", out)
+	}
+}
+
+func TestREPL_TraceAndErrors(t *testing.T) {
+	out := runSession(t, "user 1\nallow(user, \"GET\", 1)\nexpense 99\nexpense abc\n")
+
+	if !strings.Contains(out, "trace:\n  QUERY: allow(") {
+		t.Errorf("expected trace in output, got:\n%s", out)
+	}
+	if strings.Count(out, "error: ") != 2 {
+		t.Errorf("expected errors for missing and invalid expense, got:\n%s", out)
+	}
+	if !strings.Contains(out, `error: invalid expense ID "abc"`) {
+		t.Errorf("expected error for invalid ID, got:\n%s", out)
+	}
+}
+
+func TestREPL_BindingsDoNotShadowPolicy(t *testing.T) {
+	out := runSessionWith(t, `
+INSERT INTO users (id, email, title, organization_id) VALUES (2, 'other@example.com', 'developer', 1);
+INSERT INTO expenses (id, user_id, amount, description) VALUES (7, 1, 100, 'lunch'), (8, 2, 50, 'taxi');`, strings.Join([]string{
+		"trace off",
+		"user 1",
+		"expense 7",
+		"user 2 as other_user",
+		"expense 8 as own_expense",
+		`allow(other_user, "read", own_expense)`,
+		"user 1 as User",
+	}, "\n"))
+
+	if !strings.Contains(out, "own_expense = <Expense: 8 (amount: 50, user: 2)>\npolicy> true\n") {
+		t.Errorf("expected other user to read own expense, got:\n%s", out)
+	}
+	if !strings.Contains(out, `error: invalid name "User"`) {
+		t.Errorf("expected error for capitalized name, got:\n%s", out)
+	}
+}
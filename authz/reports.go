@@ -0,0 +1,43 @@
+package authz
+
+import (
+	"log"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+// reportsName is name Reports is available as in policies.
+const reportsName = "Reports"
+
+// ReportStore provides expense reports. It is implemented by store.DBManager.
+type ReportStore interface {
+	// ExpenseReportByID returns expense report with provided ID.
+	ExpenseReportByID(int) (model.ExpenseReport, error)
+}
+
+// Reports exposes expense reports to policies, so permissions on expenses
+// can be derived from reports they belong to. Without store no report
+// exists.
+type Reports struct {
+	store ReportStore
+}
+
+// WithReports makes reports from provided store available in policies
+// as Reports.
+func WithReports(store ReportStore) Option {
+	return WithConstant(reportsName, Reports{store: store})
+}
+
+// ByID returns report with provided ID. Missing report is returned as
+// zero value, which no rule grants access to.
+func (r Reports) ByID(id int) model.ExpenseReport {
+	if r.store == nil {
+		return model.ExpenseReport{}
+	}
+	report, err := r.store.ExpenseReportByID(id)
+	if err != nil {
+		log.Printf("loading expense report %d: %v", id, err)
+		return model.ExpenseReport{}
+	}
+	return report
+}
@@ -0,0 +1,43 @@
+package authz
+
+import (
+	"log"
+	"time"
+)
+
+// spendingName is name Spending is available as in policies.
+const spendingName = "Spending"
+
+// SpendingStore provides aggregated expenses of users. It is implemented by
+// store.DBManager.
+type SpendingStore interface {
+	// SpentInMonth returns total amount of expenses user submitted in month
+	// of provided time, not counting drafts and rejected expenses.
+	SpentInMonth(userID int, month time.Time) (int, error)
+}
+
+// Spending exposes aggregated expenses to policies, e.g. for spending
+// limits. Without store nobody has spent anything.
+type Spending struct {
+	store SpendingStore
+}
+
+// WithSpending makes aggregates from provided store available in policies
+// as Spending.
+func WithSpending(store SpendingStore) Option {
+	return WithConstant(spendingName, Spending{store: store})
+}
+
+// MonthlyTotal returns total amount user with provided ID submitted in
+// current month.
+func (s Spending) MonthlyTotal(userID int) int {
+	if s.store == nil {
+		return 0
+	}
+	total, err := s.store.SpentInMonth(userID, time.Now())
+	if err != nil {
+		log.Printf("loading monthly total of %d: %v", userID, err)
+		return 0
+	}
+	return total
+}
@@ -0,0 +1,230 @@
+package authz
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/osohq/go-oso"
+
+	"github.com/delicb/oso-go-tutorial/authz/polarsrc"
+)
+
+// Trace is evaluation trace of a query, one line per element. Nesting of
+// evaluation is preserved as indentation.
+//
+// Trace starts with the query and reports rules that were applied and
+// whether they succeeded. Rules
+// re-entered after backtracking are reported, but their nesting may not be
+// exact.
+type Trace []string
+
+// String returns trace as multi-line text.
+func (t Trace) String() string {
+	return strings.Join(t, "\n")
+}
+
+// Explainer can explain authorization decisions with evaluation trace.
+type Explainer interface {
+	AuthorizeWithTrace(actor, action, resource interface{}) (bool, Trace, error)
+}
+
+// build time guarantee that OsoAuthorizer implement Explainer
+var _ Explainer = &OsoAuthorizer{}
+
+// traceProbeName is name of constant tracer is available as in instrumented
+// policy.
+const traceProbeName = "TraceProbe"
+
+// tracer evaluates queries on its own OSO engine, loaded with copy of
+// policies where every rule reports to tracer when it is applied and when
+// it is done. Decisions of authorizer are never made by this engine, so
+// they can not end up in someone else's trace.
+type tracer struct {
+	engine oso.Oso
+	rules  []polarsrc.Rule
+
+	trace    Trace
+	depth    int
+	entries  []traceEntry
+	bindings map[string]interface{}
+}
+
+// traceEntry is single application of a rule.
+type traceEntry struct {
+	rule  int
+	depth int
+}
+
+// traceProbe is called from instrumented rules and traced queries. OSO
+// passes constants by value, so it only points to tracer that collects the
+// trace.
+type traceProbe struct {
+	tracer *tracer
+}
+
+// Enter records that rule with provided index was applied and returns ID
+// of the application, which is passed to Exit.
+func (p traceProbe) Enter(rule int) int {
+	t := p.tracer
+	r := t.rules[rule]
+	t.add(fmt.Sprintf("RULE: %s (line %d)", r.HeadText(), r.Line))
+	t.entries = append(t.entries, traceEntry{rule: rule, depth: t.depth})
+	t.depth++
+	return len(t.entries) - 1
+}
+
+// Exit records that rule application with provided ID succeeded, or that
+// it has no (more) results. It always returns true, so it does not change
+// outcome of the rule.
+func (p traceProbe) Exit(entry int, succeeded bool) bool {
+	t := p.tracer
+	e := t.entries[entry]
+	t.depth = e.depth
+	outcome := "NO MORE RESULTS"
+	if succeeded {
+		outcome = "SUCCEEDED"
+	}
+	t.add(fmt.Sprintf("%s: %s", outcome, t.rules[e.rule].HeadText()))
+	return true
+}
+
+// Bound returns value bound to provided name for query being evaluated.
+func (p traceProbe) Bound(name string) interface{} {
+	return p.tracer.bindings[name]
+}
+
+func (t *tracer) add(line string) {
+	t.trace = append(t.trace, strings.Repeat("  ", t.depth)+line)
+}
+
+// newTracer returns tracer for provided policies and constants.
+func newTracer(policies string, constants map[string]interface{}) (*tracer, error) {
+	all, err := polarsrc.Rules(policies)
+	if err != nil {
+		return nil, fmt.Errorf("parsing policies: %w", err)
+	}
+
+	t := &tracer{}
+	var instrumented strings.Builder
+	for _, rule := range all {
+		if rule.IsQuery() {
+			instrumented.WriteString(rule.Text + "\n")
+			continue
+		}
+		instrumented.WriteString(traceRule(rule, len(t.rules)) + "\n")
+		t.rules = append(t.rules, rule)
+	}
+
+	withProbe := map[string]interface{}{traceProbeName: traceProbe{tracer: t}}
+	for name, value := range constants {
+		withProbe[name] = value
+	}
+	if t.engine, err = newEngine(instrumented.String(), withProbe); err != nil {
+		return nil, fmt.Errorf("creating tracing engine: %w", err)
+	}
+	return t, nil
+}
+
+// traceRule returns rule source that reports to tracer when rule is
+// applied, when it succeeds and when it has no more results.
+func traceRule(rule polarsrc.Rule, index int) string {
+	// variable holding ID of rule application, names starting with
+	// underscore are not used by policies
+	const entry = "_trace_entry"
+	enter := fmt.Sprintf("%s = %s.Enter(%d)", entry, traceProbeName, index)
+	succeeded := fmt.Sprintf("%s.Exit(%s, true)", traceProbeName, entry)
+	failed := fmt.Sprintf("%s.Exit(%s, false)", traceProbeName, entry)
+	body := rule.BodyText()
+	if body == "" {
+		// fact, always succeeds once
+		body = "true"
+	}
+	return fmt.Sprintf("%s if %s and (((%s) and %s) or (%s and false));", rule.HeadText(), enter, body, succeeded, failed)
+}
+
+// traced runs provided function evaluating query with tracer of
+// authorizer, creating it if needed, and returns trace collected
+// meanwhile. Traced evaluations are serialized, each of them gets its own
+// trace.
+func (e *OsoAuthorizer) traced(query string, f func(t *tracer) error) (Trace, error) {
+	e.traceMu.Lock()
+	defer e.traceMu.Unlock()
+
+	if e.tracer == nil {
+		t, err := newTracer(e.policies, e.constants)
+		if err != nil {
+			return nil, err
+		}
+		e.tracer = t
+	}
+	e.tracer.trace = Trace{"QUERY: " + query}
+	e.tracer.depth, e.tracer.entries, e.tracer.bindings = 1, nil, nil
+	err := f(e.tracer)
+	return e.tracer.trace, err
+}
+
+// AuthorizeWithTrace works as Authorize, but it also returns evaluation
+// trace and error (if any) instead of just logging it.
+// Tracing is expensive, so this should only be used for debugging and
+// tooling, not for regular request handling.
+func (e *OsoAuthorizer) AuthorizeWithTrace(actor, action, resource interface{}) (allowed bool, trace Trace, err error) {
+	query := fmt.Sprintf("allow(%s, %s, %s)", describeTerm(actor), describeTerm(action), describeTerm(resource))
+	trace, err = e.traced(query, func(t *tracer) error {
+		allowed, err = t.engine.IsAllowed(actor, action, resource)
+		return err
+	})
+	return allowed, trace, err
+}
+
+// QueryWithTrace evaluates arbitrary Polar query and returns all results
+// (as variable bindings) along with evaluation trace.
+// Provided bindings are values of query variables with the same name, they
+// are not visible to policies and are not part of results.
+func (e *OsoAuthorizer) QueryWithTrace(query string, bindings map[string]interface{}) (results []map[string]interface{}, trace Trace, err error) {
+	names := make([]string, 0, len(bindings))
+	for name := range bindings {
+		if !polarVariable.MatchString(name) {
+			return nil, nil, fmt.Errorf("invalid variable name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	bound := query
+	for i := len(names) - 1; i >= 0; i-- {
+		bound = fmt.Sprintf("%s = %s.Bound(%q) and (%s)", names[i], traceProbeName, names[i], bound)
+	}
+
+	trace, err = e.traced(query, func(t *tracer) error {
+		t.bindings = bindings
+		q, err := t.engine.NewQueryFromStr(bound)
+		if err != nil {
+			return err
+		}
+		results, err = q.GetAllResults()
+		return err
+	})
+	for _, result := range results {
+		for name := range bindings {
+			delete(result, name)
+		}
+	}
+	return results, trace, err
+}
+
+// polarVariable matches names that can be used as variables in queries.
+var polarVariable = regexp.MustCompile(`^[a-z_][a-zA-Z0-9_]*$`)
+
+// describeTerm returns short description of value passed to policy.
+func describeTerm(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v)
+	case *http.Request:
+		return fmt.Sprintf("<Request: %s %s>", v.Method, v.URL.Path)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,99 @@
+package authz
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+func TestAuthorizeWithTrace(t *testing.T) {
+	manager := getManager(t)
+
+	allowed, trace, err := manager.AuthorizeWithTrace(model.User{ID: 1}, "read", model.Expense{UserID: 1})
+	if err != nil || !allowed {
+		t.Fatalf("expected to be allowed without error, got %v, %v", allowed, err)
+	}
+	for _, expected := range []string{
+		"QUERY: allow(",
+		`  RULE: allow(user: User, "read", expense: Expense) (line `,
+		"    RULE: submitted(user: User, expense: Expense) (line ",
+		"    SUCCEEDED: submitted(user: User, expense: Expense)",
+		`  SUCCEEDED: allow(user: User, "read", expense: Expense)`,
+	} {
+		if !strings.Contains(trace.String(), expected) {
+			t.Fatalf("trace does not contain %q:\n%s", expected, trace)
+		}
+	}
+
+	// tracing must not leak to regular evaluation
+	if _, trace, _ := manager.AuthorizeWithTrace(model.User{}, "read", model.Expense{}); len(trace) == 0 {
+		t.Fatalf("expected trace for second evaluation")
+	}
+}
+
+func TestAuthorizeWithTrace_Concurrent(t *testing.T) {
+	manager := getManager(t)
+	req, _ := http.NewRequest(http.MethodGet, "/whoami", nil)
+
+	// decisions made meanwhile must not end up in trace
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				manager.Authorize(model.User{}, "GET", req)
+			}
+		}
+	}()
+	defer wg.Wait()
+	defer close(done)
+
+	for i := 0; i < 10; i++ {
+		_, trace, err := manager.AuthorizeWithTrace(model.User{ID: 1}, "read", model.Expense{UserID: 1})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if strings.Contains(trace.String(), "Request") {
+			t.Fatalf("trace contains other decisions:\n%s", trace)
+		}
+	}
+}
+
+func TestQueryWithTrace(t *testing.T) {
+	manager := getManager(t)
+	bindings := map[string]interface{}{
+		"me":   model.User{ID: 7},
+		"mine": model.Expense{UserID: 7},
+	}
+
+	results, trace, err := manager.QueryWithTrace(`x = me.ID and submitted(me, mine)`, bindings)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 1 || len(results[0]) != 1 || fmt.Sprint(results[0]["x"]) != "7" {
+		t.Fatalf("unexpected results: %v", results)
+	}
+	// all results are requested, so rule is asked for more after it succeeds
+	if len(trace) != 4 || trace[0] != "QUERY: x = me.ID and submitted(me, mine)" ||
+		!strings.HasPrefix(trace[1], "  RULE: submitted(") || !strings.HasPrefix(trace[2], "  SUCCEEDED: submitted(") ||
+		!strings.HasPrefix(trace[3], "  NO MORE RESULTS: submitted(") {
+		t.Fatalf("unexpected trace:\n%s", trace)
+	}
+}
+
+func TestQueryWithTrace_InvalidBinding(t *testing.T) {
+	manager := getManager(t)
+	_, _, err := manager.QueryWithTrace(`x = 1`, map[string]interface{}{"User": model.User{ID: 7}})
+	if err == nil {
+		t.Fatalf("expected error for binding shadowing class name")
+	}
+}
@@ -0,0 +1,435 @@
+// Package client provides typed Go client for expenses HTTP API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+// Client talks to expenses server on behalf of a single user.
+// It is safe for concurrent use.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	user       string
+	apiKey     string
+	// organization user acts in, zero for user's own
+	organization int
+	// email of user requests are sent as, empty if not impersonating
+	impersonate string
+
+	maxRetries   int
+	retryBackoff time.Duration
+}
+
+// Option customizes client returned by New.
+type Option func(*Client)
+
+// WithHTTPClient sets HTTP client used for requests. Client is copied,
+// since redirect handling has to be changed on it. Nil client is ignored.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		if httpClient == nil {
+			return
+		}
+		copied := *httpClient
+		c.httpClient = &copied
+	}
+}
+
+// WithUser sets email of a user on behalf of which requests are sent.
+// Without it, all requests are sent as guest user.
+func WithUser(email string) Option {
+	return func(c *Client) {
+		c.user = email
+	}
+}
+
+// WithAPIKey sets API key requests are authenticated with, as service
+// account of organization key was created for. Key takes precedence over
+// user set with WithUser.
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithOrganization sets ID of organization requests are sent in, for users
+// that are members of multiple organizations. Without it, requests are sent
+// in organization user was created in.
+func WithOrganization(id int) Option {
+	return func(c *Client) {
+		c.organization = id
+	}
+}
+
+// WithImpersonation sets email of user requests are sent as, on behalf of
+// user set with WithUser. Server allows it to admins, and records every
+// such request.
+func WithImpersonation(email string) Option {
+	return func(c *Client) {
+		c.impersonate = email
+	}
+}
+
+// WithRetries sets how many times idempotent requests are retried on
+// network errors and 429, 502, 503 and 504 responses, and how long to wait
+// before first retry. Wait time is doubled for each subsequent retry.
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.retryBackoff = backoff
+	}
+}
+
+// New returns client for expenses server listening on baseURL.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing base URL: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("base URL %q must be absolute", baseURL)
+	}
+
+	c := &Client{
+		baseURL:      u,
+		httpClient:   &http.Client{Timeout: 30 * time.Second},
+		maxRetries:   2,
+		retryBackoff: 100 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	// server answers to submit with redirect to created expense, we want to
+	// handle that ourselves instead of re-sending body to new location
+	c.httpClient.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return c, nil
+}
+
+// GetExpense returns expense with provided ID.
+func (c *Client) GetExpense(ctx context.Context, id int) (model.Expense, error) {
+	var expense model.Expense
+	err := c.getJSON(ctx, "/expenses/"+strconv.Itoa(id), &expense)
+	return expense, err
+}
+
+// GetOrganization returns organization with provided ID.
+func (c *Client) GetOrganization(ctx context.Context, id int) (model.Organization, error) {
+	var organization model.Organization
+	err := c.getJSON(ctx, "/organizations/"+strconv.Itoa(id), &organization)
+	return organization, err
+}
+
+// WhoAmI returns user client is authenticated as. For guest users,
+// empty user is returned.
+func (c *Client) WhoAmI(ctx context.Context) (model.User, error) {
+	var user model.User
+	err := c.getJSON(ctx, "/whoami", &user)
+	return user, err
+}
+
+// SubmitExpense creates new expense for current user and returns it as
+// stored by the server (e.g. with ID filled in). UserID must not be set,
+// server assigns expense to current user.
+// Submitting is not idempotent, so it is never retried.
+func (c *Client) SubmitExpense(ctx context.Context, expense model.Expense) (model.Expense, error) {
+	body, err := json.Marshal(expense)
+	if err != nil {
+		return model.Expense{}, fmt.Errorf("marshaling expense: %w", err)
+	}
+
+	resp, err := c.do(ctx, http.MethodPut, "/expenses/submit", body)
+	if err != nil {
+		return model.Expense{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusTemporaryRedirect {
+		return model.Expense{}, newAPIError(resp)
+	}
+
+	// location of created expense ends with its ID
+	location, err := resp.Location()
+	if err != nil {
+		return model.Expense{}, fmt.Errorf("reading location of created expense: %w", err)
+	}
+	id, err := strconv.Atoi(path.Base(location.Path))
+	if err != nil {
+		return model.Expense{}, fmt.Errorf("unexpected location of created expense %q", location)
+	}
+	return c.GetExpense(ctx, id)
+}
+
+// ListExpenses returns expenses of user's organization user is allowed
+// to read. Non empty category (ID or name) limits expenses to that category.
+func (c *Client) ListExpenses(ctx context.Context, category string) ([]model.Expense, error) {
+	endpoint := "/expenses"
+	if category != "" {
+		endpoint += "?" + url.Values{"category": {category}}.Encode()
+	}
+	var expenses []model.Expense
+	err := c.getJSON(ctx, endpoint, &expenses)
+	return expenses, err
+}
+
+// Categories returns expense categories of organization with provided ID.
+func (c *Client) Categories(ctx context.Context, organizationID int) ([]model.Category, error) {
+	var categories []model.Category
+	err := c.getJSON(ctx, "/organizations/"+strconv.Itoa(organizationID)+"/categories", &categories)
+	return categories, err
+}
+
+// TransitionExpense performs approval workflow action (e.g. "approve") on
+// provided expense and returns updated expense. Expense not being in status
+// action is possible from is reported as ErrConflict and expense changed
+// since it was loaded as ErrPreconditionFailed.
+func (c *Client) TransitionExpense(ctx context.Context, expense model.Expense, action string) (model.Expense, error) {
+	endpoint := "/expenses/" + strconv.Itoa(expense.ID) + "/" + action
+	resp, err := c.send(ctx, http.MethodPost, endpoint, "application/json", nil, http.Header{"If-Match": {expense.ETag()}})
+	if err != nil {
+		return model.Expense{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return model.Expense{}, newAPIError(resp)
+	}
+	var updated model.Expense
+	if err := json.NewDecoder(resp.Body).Decode(&updated); err != nil {
+		return model.Expense{}, fmt.Errorf("decoding expense: %w", err)
+	}
+	return updated, nil
+}
+
+// ExpenseHistory returns status changes of expense with provided ID, oldest first.
+func (c *Client) ExpenseHistory(ctx context.Context, id int) ([]model.ExpenseEvent, error) {
+	var history []model.ExpenseEvent
+	err := c.getJSON(ctx, "/expenses/"+strconv.Itoa(id)+"/history", &history)
+	return history, err
+}
+
+// ExpenseVersions returns snapshots of expense with provided ID taken after
+// each of its changes, oldest first.
+func (c *Client) ExpenseVersions(ctx context.Context, id int) ([]model.ExpenseVersion, error) {
+	var versions []model.ExpenseVersion
+	err := c.getJSON(ctx, "/expenses/"+strconv.Itoa(id)+"/versions", &versions)
+	return versions, err
+}
+
+// DiffExpenseVersions returns changes of expense between provided versions.
+func (c *Client) DiffExpenseVersions(ctx context.Context, id, from, to int) (model.VersionDiff, error) {
+	var diff model.VersionDiff
+	endpoint := fmt.Sprintf("/expenses/%d/versions/diff?from=%d&to=%d", id, from, to)
+	err := c.getJSON(ctx, endpoint, &diff)
+	return diff, err
+}
+
+// CreateAPIKey creates service account of organization with provided ID and
+// returns it with its API key. Key is not available later, so it has to be
+// stored by caller. Creating is not idempotent, so it is never retried.
+func (c *Client) CreateAPIKey(ctx context.Context, organizationID int, account model.ServiceAccount) (model.APIKey, error) {
+	body, err := json.Marshal(account)
+	if err != nil {
+		return model.APIKey{}, fmt.Errorf("marshaling service account: %w", err)
+	}
+	resp, err := c.do(ctx, http.MethodPost, "/organizations/"+strconv.Itoa(organizationID)+"/api-keys", body)
+	if err != nil {
+		return model.APIKey{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return model.APIKey{}, newAPIError(resp)
+	}
+	var key model.APIKey
+	if err := json.NewDecoder(resp.Body).Decode(&key); err != nil {
+		return model.APIKey{}, fmt.Errorf("decoding API key: %w", err)
+	}
+	return key, nil
+}
+
+// APIKeys returns service accounts of organization with provided ID,
+// revoked and expired included.
+func (c *Client) APIKeys(ctx context.Context, organizationID int) ([]model.ServiceAccount, error) {
+	var accounts []model.ServiceAccount
+	err := c.getJSON(ctx, "/organizations/"+strconv.Itoa(organizationID)+"/api-keys", &accounts)
+	return accounts, err
+}
+
+// RevokeAPIKey makes API key of service account with provided ID unusable.
+// Revoking key that is already revoked is reported as ErrConflict.
+func (c *Client) RevokeAPIKey(ctx context.Context, organizationID, id int) error {
+	endpoint := fmt.Sprintf("/organizations/%d/api-keys/%d", organizationID, id)
+	resp, err := c.do(ctx, http.MethodDelete, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return newAPIError(resp)
+	}
+	return nil
+}
+
+// Formats of data accepted by ImportExpenses.
+const (
+	FormatCSV       = "text/csv"
+	FormatJSONLines = "application/x-ndjson"
+)
+
+// ImportExpenses creates expenses of current user from data in provided
+// format (FormatCSV or FormatJSONLines). Rows are validated one by one, so
+// report has to be checked for rows that were not imported.
+// Importing is not idempotent, so it is never retried.
+func (c *Client) ImportExpenses(ctx context.Context, format string, data []byte) (model.ImportReport, error) {
+	resp, err := c.send(ctx, http.MethodPost, "/expenses/import", format, data, nil)
+	if err != nil {
+		return model.ImportReport{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return model.ImportReport{}, newAPIError(resp)
+	}
+	var report model.ImportReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return model.ImportReport{}, fmt.Errorf("decoding import report: %w", err)
+	}
+	return report, nil
+}
+
+// ExportExpenses streams expenses current user can read to w, in format
+// supported by server (csv, jsonl, qif or ofx). Non empty category (ID or
+// name) limits expenses to that category. Export is written as it is
+// received, so it is never retried.
+func (c *Client) ExportExpenses(ctx context.Context, format, category string, w io.Writer) error {
+	query := url.Values{"format": {format}}
+	if category != "" {
+		query.Set("category", category)
+	}
+	resp, err := c.do(ctx, http.MethodGet, "/expenses/export?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError(resp)
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("reading export: %w", err)
+	}
+	return nil
+}
+
+// getJSON sends GET request to provided endpoint, retrying on transient
+// failures, and decodes JSON response into out.
+func (c *Client) getJSON(ctx context.Context, endpoint string, out interface{}) error {
+	var resp *http.Response
+	var err error
+
+	backoff := c.retryBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err = c.do(ctx, http.MethodGet, endpoint, nil)
+		if !retryable(resp, err) || attempt >= c.maxRetries {
+			break
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response from %s: %w", endpoint, err)
+	}
+	return nil
+}
+
+// do sends single request with JSON body to provided endpoint with
+// authentication attached.
+func (c *Client) do(ctx context.Context, method, endpoint string, body []byte) (*http.Response, error) {
+	return c.send(ctx, method, endpoint, "application/json", body, nil)
+}
+
+// send is do with body of provided content type and additional headers.
+func (c *Client) send(ctx context.Context, method, endpoint, contentType string, body []byte, header http.Header) (*http.Response, error) {
+	// endpoint can contain query string
+	ref, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parsing endpoint: %w", err)
+	}
+	u := c.baseURL.ResolveReference(ref)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.user != "" {
+		req.Header.Set("user", c.user)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	if c.impersonate != "" {
+		req.Header.Set("X-Impersonate-User", c.impersonate)
+	}
+	if c.organization != 0 {
+		req.Header.Set("X-Organization", strconv.Itoa(c.organization))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", method, endpoint, err)
+	}
+	return resp, nil
+}
+
+// retryable reports if request that ended with provided response or error
+// is worth repeating.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		// context errors are final, everything else is (probably) network issue
+		return !errorsIsContext(err)
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+func newTestClient(t *testing.T, handler http.Handler, opts ...Option) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	opts = append([]Option{WithRetries(2, time.Millisecond)}, opts...)
+	c, err := New(server.URL, opts...)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	return c
+}
+
+func TestClient_RetriesIdempotentRequests(t *testing.T) {
+	var calls int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"ID": 7, "Name": "org"}`))
+	})
+	c := newTestClient(t, handler)
+
+	org, err := c.GetOrganization(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if org.ID != 7 || org.Name != "org" {
+		t.Fatalf("unexpected organization: %v", org)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 calls, got %d", calls)
+	}
+}
+
+func TestClient_DoesNotRetrySubmit(t *testing.T) {
+	var calls int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	c := newTestClient(t, handler)
+
+	if _, err := c.SubmitExpense(context.Background(), model.Expense{}); err == nil {
+		t.Fatalf("expected error, got none")
+	}
+	if calls != 1 {
+		t.Fatalf("expected single call, got %d", calls)
+	}
+}
+
+func TestClient_TypedErrors(t *testing.T) {
+	data := []struct {
+		statusCode int
+		expected   error
+	}{
+		{http.StatusUnauthorized, ErrUnauthenticated},
+		{http.StatusForbidden, ErrForbidden},
+		{http.StatusNotFound, ErrNotFound},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(http.StatusText(d.statusCode), func(t *testing.T) {
+			c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "nope", d.statusCode)
+			}))
+			_, err := c.GetExpense(context.Background(), 1)
+			if !errors.Is(err, d.expected) {
+				t.Fatalf("expected %v, got %v", d.expected, err)
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.Message != "nope" {
+				t.Fatalf("expected API error with server message, got %v", err)
+			}
+		})
+	}
+}
+
+func TestClient_NilHTTPClient(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ID": 7, "Name": "org"}`))
+	})
+	c := newTestClient(t, handler, WithHTTPClient(nil))
+
+	if _, err := c.GetOrganization(context.Background(), 7); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
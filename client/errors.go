@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Sentinel errors that APIError unwraps to, so callers can use errors.Is
+// without inspecting status codes.
+var (
+	ErrUnauthenticated = errors.New("unauthenticated")
+	ErrForbidden       = errors.New("forbidden")
+	ErrNotFound        = errors.New("not found")
+	ErrConflict        = errors.New("conflict")
+	// ErrPreconditionFailed is returned when record changed since client
+	// loaded it.
+	ErrPreconditionFailed = errors.New("precondition failed")
+)
+
+// APIError is returned when server answers with unexpected status code.
+type APIError struct {
+	StatusCode int
+	// Message is body returned by server, trimmed.
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("server responded with %d: %s", e.StatusCode, e.Message)
+}
+
+// Unwrap returns sentinel error matching status code, if there is one.
+func (e *APIError) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusUnauthorized:
+		return ErrUnauthenticated
+	case http.StatusForbidden:
+		return ErrForbidden
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusConflict:
+		return ErrConflict
+	case http.StatusPreconditionFailed:
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// newAPIError creates error from response. Caller is responsible for
+// closing response body.
+func newAPIError(resp *http.Response) *APIError {
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 4*1024))
+	return &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    strings.TrimSpace(string(message)),
+	}
+}
+
+func errorsIsContext(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,275 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/httpapi"
+	"github.com/delicb/oso-go-tutorial/model"
+	"github.com/delicb/oso-go-tutorial/store/storetest"
+)
+
+// runs API client against real HTTP handler, with real policy and in-memory database
+func getClient(t *testing.T, opts ...Option) *Client {
+	t.Helper()
+	return newClient(t, getServer(t, storetest.Fixture), opts...)
+}
+
+// getServer returns URL of server with database filled with provided data
+func getServer(t *testing.T, data ...string) string {
+	t.Helper()
+	auth, err := authz.NewAuthorizer(authz.Policy)
+	if err != nil {
+		t.Fatalf("failed to create authorizer: %v", err)
+	}
+	server := httptest.NewServer(httpapi.NewHTTPHandler(storetest.New(t, data...), auth))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func newClient(t *testing.T, url string, opts ...Option) *Client {
+	t.Helper()
+	c, err := New(url, opts...)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	return c
+}
+
+func TestIntegration_WhoAmI(t *testing.T) {
+	user, err := getClient(t, WithUser("test@example.com")).WhoAmI(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if user.ID != 1 || user.Email != "test@example.com" {
+		t.Fatalf("unexpected user: %v", user)
+	}
+
+	guest, err := getClient(t).WhoAmI(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if guest.IsAuthenticated() {
+		t.Fatalf("expected guest user, got %v", guest)
+	}
+
+	// user is not member of organization 2
+	if _, err := getClient(t, WithUser("test@example.com"), WithOrganization(2)).WhoAmI(context.Background()); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found error for organization user is not member of, got %v", err)
+	}
+}
+
+func TestIntegration_SubmitAndGetExpense(t *testing.T) {
+	c := getClient(t, WithUser("test@example.com"))
+
+	created, err := c.SubmitExpense(context.Background(), model.Expense{Amount: 100, Description: "lunch"})
+	if err != nil {
+		t.Fatalf("failed to submit expense: %v", err)
+	}
+	if created.ID == 0 || created.UserID != 1 || created.Amount != 100 {
+		t.Fatalf("unexpected expense: %v", created)
+	}
+
+	fetched, err := c.GetExpense(context.Background(), created.ID)
+	if err != nil {
+		t.Fatalf("failed to get expense: %v", err)
+	}
+	if fetched != created {
+		t.Fatalf("expected %v, got %v", created, fetched)
+	}
+}
+
+func TestIntegration_ExpenseWorkflow(t *testing.T) {
+	c := getClient(t, WithUser("test@example.com"))
+
+	draft, err := c.SubmitExpense(context.Background(), model.Expense{Amount: 100, Description: "lunch", Status: model.StatusDraft})
+	if err != nil {
+		t.Fatalf("failed to create draft: %v", err)
+	}
+	submitted, err := c.TransitionExpense(context.Background(), draft, model.ActionSubmit)
+	if err != nil {
+		t.Fatalf("failed to submit draft: %v", err)
+	}
+	if submitted.Status != model.StatusSubmitted {
+		t.Fatalf("unexpected status after submit: %v", submitted.Status)
+	}
+	if _, err := c.TransitionExpense(context.Background(), draft, model.ActionSubmit); !errors.Is(err, ErrPreconditionFailed) {
+		t.Fatalf("expected precondition error for submit of stale draft, got %v", err)
+	}
+	if _, err := c.TransitionExpense(context.Background(), submitted, model.ActionSubmit); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected conflict error for second submit, got %v", err)
+	}
+
+	history, err := c.ExpenseHistory(context.Background(), draft.ID)
+	if err != nil {
+		t.Fatalf("failed to get history: %v", err)
+	}
+	if len(history) != 2 || history[1].Action != model.ActionSubmit {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+
+	versions, err := c.ExpenseVersions(context.Background(), draft.ID)
+	if err != nil {
+		t.Fatalf("failed to get versions: %v", err)
+	}
+	if len(versions) != 2 || versions[1].Expense.Status != model.StatusSubmitted {
+		t.Fatalf("unexpected versions: %+v", versions)
+	}
+	diff, err := c.DiffExpenseVersions(context.Background(), draft.ID, 1, 2)
+	if err != nil {
+		t.Fatalf("failed to diff versions: %v", err)
+	}
+	// values of changed fields are decoded from JSON as they are
+	expected := []model.FieldChange{{Field: "Status", From: "draft", To: "submitted"}}
+	if !reflect.DeepEqual(diff.Changes, expected) {
+		t.Fatalf("unexpected diff: %+v", diff)
+	}
+}
+
+func TestIntegration_Categories(t *testing.T) {
+	c := getClient(t, WithUser("test@example.com"))
+
+	categories, err := c.Categories(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("failed to get categories: %v", err)
+	}
+	if len(categories) != 4 {
+		t.Fatalf("unexpected categories: %v", categories)
+	}
+
+	for _, e := range []model.Expense{{Amount: 100, CategoryID: 1}, {Amount: 20, CategoryID: 2}} {
+		if _, err := c.SubmitExpense(context.Background(), e); err != nil {
+			t.Fatalf("failed to submit expense: %v", err)
+		}
+	}
+	travel, err := c.ListExpenses(context.Background(), "travel")
+	if err != nil {
+		t.Fatalf("failed to list expenses: %v", err)
+	}
+	if len(travel) != 1 || travel[0].Category != "travel" {
+		t.Fatalf("unexpected expenses: %v", travel)
+	}
+	all, err := c.ListExpenses(context.Background(), "")
+	if err != nil {
+		t.Fatalf("failed to list expenses: %v", err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("unexpected expenses: %v", all)
+	}
+}
+
+func TestIntegration_ImportExpenses(t *testing.T) {
+	c := getClient(t, WithUser("test@example.com"))
+
+	report, err := c.ImportExpenses(context.Background(), FormatCSV, []byte("amount,description,category\n100,lunch,meals\n20,taxi,yachts\n"))
+	if err != nil {
+		t.Fatalf("failed to import expenses: %v", err)
+	}
+	if report.Imported != 1 || report.Failed != 1 || report.Rows[0].Expense.Category != "meals" || report.Rows[1].Error == "" {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	report, err = c.ImportExpenses(context.Background(), FormatJSONLines, []byte(`{"Amount": 30, "Description": "coffee"}`))
+	if err != nil {
+		t.Fatalf("failed to import expenses: %v", err)
+	}
+	if report.Imported != 1 || report.Failed != 0 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	_, err = c.ImportExpenses(context.Background(), FormatCSV, []byte("planet\nmars\n"))
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected bad request error, got: %v", err)
+	}
+}
+
+func TestIntegration_ExportExpenses(t *testing.T) {
+	c := getClient(t, WithUser("test@example.com"))
+
+	if _, err := c.SubmitExpense(context.Background(), model.Expense{Amount: 100, Description: "lunch", CategoryID: 2}); err != nil {
+		t.Fatalf("failed to submit expense: %v", err)
+	}
+
+	var out strings.Builder
+	if err := c.ExportExpenses(context.Background(), "qif", "meals", &out); err != nil {
+		t.Fatalf("failed to export expenses: %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "!Type:Bank\n") || !strings.Contains(out.String(), "T-100.00\n") {
+		t.Fatalf("unexpected export: %q", out.String())
+	}
+
+	if err := c.ExportExpenses(context.Background(), "xls", "", &out); err == nil {
+		t.Fatalf("expected error for unknown format")
+	}
+}
+
+func TestIntegration_APIKeys(t *testing.T) {
+	url := getServer(t, storetest.Fixture, `INSERT INTO users ("id", "email", "title", "organization_id") VALUES (2, 'admin@example.com', 'admin', 1);`)
+	admin := newClient(t, url, WithUser("admin@example.com"))
+
+	key, err := admin.CreateAPIKey(context.Background(), 1, model.ServiceAccount{Name: "batch", Scopes: []string{model.ScopeExpensesRead}})
+	if err != nil {
+		t.Fatalf("failed to create API key: %v", err)
+	}
+	batch := newClient(t, url, WithAPIKey(key.Key))
+	if _, err := batch.ListExpenses(context.Background(), ""); err != nil {
+		t.Fatalf("failed to list expenses with API key: %v", err)
+	}
+	if _, err := batch.SubmitExpense(context.Background(), model.Expense{Amount: 1}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected forbidden error for submit with API key, got %v", err)
+	}
+
+	keys, err := admin.APIKeys(context.Background(), 1)
+	if err != nil || len(keys) != 1 || keys[0].Name != "batch" {
+		t.Fatalf("unexpected API keys: %+v, %v", keys, err)
+	}
+	if err := admin.RevokeAPIKey(context.Background(), 1, key.ServiceAccount.ID); err != nil {
+		t.Fatalf("failed to revoke API key: %v", err)
+	}
+	if err := admin.RevokeAPIKey(context.Background(), 1, key.ServiceAccount.ID); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected conflict error for second revoke, got %v", err)
+	}
+	if _, err := batch.ListExpenses(context.Background(), ""); !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("expected unauthenticated error for revoked key, got %v", err)
+	}
+}
+
+func TestIntegration_Errors(t *testing.T) {
+	guest := getClient(t)
+
+	if _, err := guest.SubmitExpense(context.Background(), model.Expense{Amount: 1}); !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("expected unauthenticated error for guest submit, got %v", err)
+	}
+	if _, err := guest.GetExpense(context.Background(), 99); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+	// organizations other than user's own do not exist for the user
+	if _, err := guest.GetOrganization(context.Background(), 1); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found error for other organization, got %v", err)
+	}
+}
+
+func TestIntegration_Impersonation(t *testing.T) {
+	url := getServer(t, storetest.Fixture, `INSERT INTO users ("id", "email", "title", "organization_id") VALUES (2, 'admin@example.com', 'admin', 1);`)
+
+	support := newClient(t, url, WithUser("admin@example.com"), WithImpersonation("test@example.com"))
+	user, err := support.WhoAmI(context.Background())
+	if err != nil {
+		t.Fatalf("failed to impersonate user: %v", err)
+	}
+	if user.Email != "test@example.com" {
+		t.Fatalf("expected impersonated user, got %+v", user)
+	}
+
+	developer := newClient(t, url, WithUser("test@example.com"), WithImpersonation("admin@example.com"))
+	if _, err := developer.WhoAmI(context.Background()); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected forbidden error for developer impersonating admin, got %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"go.uber.org/multierr"
+)
+
+// exportExpenses writes expenses user can read on running server to
+// standard output or file.
+func exportExpenses(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	newClient := clientFlags(fs)
+	format := fs.String("format", "csv", "export format, one of csv, jsonl, qif or ofx")
+	category := fs.String("category", "", "export only expenses in category (ID or name)")
+	output := fs.String("o", "", "write export to file instead of standard output")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	w := os.Stdout
+	if *output != "" {
+		if w, err = os.Create(*output); err != nil {
+			return fmt.Errorf("export: %w", err)
+		}
+	}
+	err = c.ExportExpenses(context.Background(), *format, *category, w)
+	if w != os.Stdout {
+		err = multierr.Append(err, w.Close())
+	}
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/delicb/oso-go-tutorial/client"
+)
+
+// importExpenses sends expenses from file to running server, on behalf of
+// provided user, and prints rows that were not imported.
+func importExpenses(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	newClient := clientFlags(fs)
+	format := fs.String("format", "", "format of file, csv or jsonl (guessed from file extension if not set)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("import: provide exactly one file")
+	}
+	file := fs.Arg(0)
+
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(file)), ".")
+	}
+	var contentType string
+	switch *format {
+	case "csv":
+		contentType = client.FormatCSV
+	case "jsonl", "ndjson":
+		contentType = client.FormatJSONLines
+	default:
+		return fmt.Errorf("import: unknown format %q, use csv or jsonl", *format)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("import: reading file: %w", err)
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	report, err := c.ImportExpenses(context.Background(), contentType, data)
+	if err != nil {
+		return fmt.Errorf("import: %w", err)
+	}
+
+	for _, row := range report.Rows {
+		if row.Error != "" {
+			fmt.Printf("row %d: %s\n", row.Row, row.Error)
+		}
+	}
+	fmt.Printf("%d imported, %d failed\n", report.Imported, report.Failed)
+	if report.Failed > 0 {
+		return fmt.Errorf("import: %d rows failed", report.Failed)
+	}
+	return nil
+}
+
+// clientFlags registers flags for connecting to running server and returns
+// function creating client from them, to be called after flags are parsed.
+func clientFlags(fs *flag.FlagSet) func() (*client.Client, error) {
+	server := fs.String("server", "http://127.0.0.1:8000", "URL of expenses server")
+	user := fs.String("user", "", "email of user to act as")
+	return func() (*client.Client, error) {
+		return client.New(*server, client.WithUser(*user))
+	}
+}
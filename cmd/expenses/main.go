@@ -0,0 +1,46 @@
+// Command expenses runs expenses HTTP server and provides tools for
+// working with authorization policies.
+//
+// Usage:
+//
+//	expenses [serve]                        run HTTP server
+//	expenses import [flags] file            import expenses from CSV or JSON lines file
+//	expenses export [flags]                 export expenses as CSV, JSON lines, QIF or OFX
+//	expenses purge [flags]                  remove soft deleted records after retention
+//	expenses policy test [flags] paths      run declarative policy tests
+//	expenses policy coverage [flags] paths  report policy rules exercised by tests
+//	expenses policy lint [flags]            check policy for mistakes
+//	expenses policy repl [flags]            evaluate queries against database objects
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "expenses: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		return serve(nil)
+	}
+	switch args[0] {
+	case "serve":
+		return serve(args[1:])
+	case "import":
+		return importExpenses(args[1:])
+	case "export":
+		return exportExpenses(args[1:])
+	case "purge":
+		return purge(args[1:])
+	case "policy":
+		return policy(args[1:])
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/authz/coverage"
+	"github.com/delicb/oso-go-tutorial/authz/polarlint"
+	"github.com/delicb/oso-go-tutorial/authz/policytest"
+	"github.com/delicb/oso-go-tutorial/authz/repl"
+)
+
+// policy dispatches policy related subcommands.
+func policy(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("policy: missing subcommand (test, coverage, lint, repl)")
+	}
+	switch args[0] {
+	case "test":
+		return policyTest(args[1:])
+	case "coverage":
+		return policyCoverage(args[1:])
+	case "lint":
+		return policyLint(args[1:])
+	case "repl":
+		return policyREPL(args[1:])
+	default:
+		return fmt.Errorf("policy: unknown subcommand %q", args[0])
+	}
+}
+
+// policyFlag registers flag for overriding embedded policy.
+func policyFlag(fs *flag.FlagSet) *string {
+	return fs.String("policy", "", "path to policy file, embedded policy is used if not set")
+}
+
+// loadPolicy returns content of policy file, or embedded policy if file is not set.
+func loadPolicy(file string) (string, error) {
+	if file == "" {
+		return authz.Policy, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("reading policy: %w", err)
+	}
+	return string(data), nil
+}
+
+// policyTest runs declarative policy tests from provided files or directories.
+func policyTest(args []string) error {
+	fs := flag.NewFlagSet("policy test", flag.ContinueOnError)
+	policyFile := policyFlag(fs)
+	verbose := fs.Bool("v", false, "print passed tests too")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("policy test: provide at least one test file or directory")
+	}
+
+	policy, err := loadPolicy(*policyFile)
+	if err != nil {
+		return err
+	}
+	suites, err := loadSuites(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	var passed, failed int
+	for _, suite := range suites {
+		// each suite provides its own fixtures to policy
+		auth, err := suite.Authorizer(policy)
+		if err != nil {
+			return err
+		}
+		for _, res := range suite.Run(auth) {
+			if res.Passed() {
+				passed++
+				if *verbose {
+					fmt.Printf("--- PASS: %s: %s\n", suite.File, res.Case.Name)
+				}
+				continue
+			}
+			failed++
+			fmt.Print(res.Diff())
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("FAIL (%d passed, %d failed)\n", passed, failed)
+		return fmt.Errorf("%d policy tests failed", failed)
+	}
+	fmt.Printf("ok (%d passed)\n", passed)
+	return nil
+}
+
+// policyCoverage runs declarative policy tests and reports which policy
+// rules were applied by them.
+func policyCoverage(args []string) error {
+	fs := flag.NewFlagSet("policy coverage", flag.ContinueOnError)
+	policyFile := policyFlag(fs)
+	htmlFile := fs.String("html", "", "write HTML report to provided file")
+	failUncovered := fs.Bool("fail-uncovered", false, "exit with error if any rule is not covered")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("policy coverage: provide at least one test file or directory")
+	}
+
+	policy, err := loadPolicy(*policyFile)
+	if err != nil {
+		return err
+	}
+	suites, err := loadSuites(fs.Args())
+	if err != nil {
+		return err
+	}
+	var reports []coverage.Report
+	for _, suite := range suites {
+		// each suite provides its own fixtures to policy
+		recorder, err := coverage.NewRecorder(policy, suite.Options()...)
+		if err != nil {
+			return err
+		}
+		for _, res := range suite.Run(recorder) {
+			if !res.Passed() {
+				fmt.Print(res.Diff())
+			}
+		}
+		reports = append(reports, recorder.Report())
+	}
+
+	report := coverage.Merge(reports...)
+	if err := report.WriteText(os.Stdout); err != nil {
+		return err
+	}
+	if *htmlFile != "" {
+		f, err := os.Create(*htmlFile)
+		if err != nil {
+			return err
+		}
+		if err := report.WriteHTML(f, policy); err != nil {
+			_ = f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+
+	if uncovered := len(report.Uncovered()); *failUncovered && uncovered > 0 {
+		return fmt.Errorf("%d policy rules not covered", uncovered)
+	}
+	return nil
+}
+
+// policyLint checks policy for mistakes and prints found issues.
+func policyLint(args []string) error {
+	fs := flag.NewFlagSet("policy lint", flag.ContinueOnError)
+	policyFile := policyFlag(fs)
+	strict := fs.Bool("strict", false, "treat warnings as errors")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	policy, err := loadPolicy(*policyFile)
+	if err != nil {
+		return err
+	}
+	issues, err := authz.Lint(policy)
+	if err != nil {
+		return err
+	}
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+
+	if polarlint.HasErrors(issues) || *strict && len(issues) > 0 {
+		return fmt.Errorf("policy lint found %d issues", len(issues))
+	}
+	return nil
+}
+
+// policyREPL starts interactive shell for evaluating queries against
+// objects from configured database.
+func policyREPL(args []string) error {
+	fs := flag.NewFlagSet("policy repl", flag.ContinueOnError)
+	policyFile := policyFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	policy, err := loadPolicy(*policyFile)
+	if err != nil {
+		return err
+	}
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	auth, err := authz.NewAuthorizer(policy, authz.WithHierarchy(db), authz.WithSpending(db), authz.WithReports(db), authz.WithTitles(db))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(`type "help" for list of commands`)
+	return repl.New(auth, db, os.Stdout).Run(os.Stdin)
+}
+
+// loadSuites loads test suites from provided paths, which can be files or directories.
+func loadSuites(paths []string) ([]*policytest.Suite, error) {
+	var suites []*policytest.Suite
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			dirSuites, err := policytest.LoadDir(path)
+			if err != nil {
+				return nil, err
+			}
+			suites = append(suites, dirSuites...)
+			continue
+		}
+		suite, err := policytest.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		suites = append(suites, suite)
+	}
+	return suites, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/delicb/oso-go-tutorial/store"
+)
+
+// defaultRetention is how long soft deleted records are kept before they
+// are purged, unless configured with EXPENSES_RETENTION.
+const defaultRetention = 90 * 24 * time.Hour
+
+// purgeInterval is how often running server purges soft deleted records.
+const purgeInterval = time.Hour
+
+// purge permanently removes records soft deleted before retention period.
+func purge(args []string) error {
+	fs := flag.NewFlagSet("purge", flag.ContinueOnError)
+	retention := fs.Duration("retention", 0, "remove records deleted before this long ago (default EXPENSES_RETENTION or 2160h)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *retention == 0 {
+		var err error
+		if *retention, err = retentionFromEnv(); err != nil {
+			return err
+		}
+	}
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	purged, err := db.PurgeDeleted(time.Now().Add(-*retention))
+	if err != nil {
+		return fmt.Errorf("purge: %w", err)
+	}
+	fmt.Printf("purged %d records\n", purged)
+	return nil
+}
+
+// retentionFromEnv returns retention period configured with
+// EXPENSES_RETENTION environment variable.
+func retentionFromEnv() (time.Duration, error) {
+	value := os.Getenv("EXPENSES_RETENTION")
+	if value == "" {
+		return defaultRetention, nil
+	}
+	retention, err := time.ParseDuration(value)
+	if err != nil || retention <= 0 {
+		return 0, fmt.Errorf("invalid EXPENSES_RETENTION %q", value)
+	}
+	return retention, nil
+}
+
+// purgePeriodically purges records deleted before retention period every
+// purgeInterval, until process exits.
+func purgePeriodically(db store.DBManager, retention time.Duration) {
+	for {
+		purged, err := db.PurgeDeleted(time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("failed to purge deleted records: %v", err)
+		} else if purged > 0 {
+			log.Printf("purged %d deleted records", purged)
+		}
+		time.Sleep(purgeInterval)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/httpapi"
+	"github.com/delicb/oso-go-tutorial/oidc"
+	"github.com/delicb/oso-go-tutorial/store"
+)
+
+// serve runs HTTP server. Configuration is read from environment.
+func serve(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	retention, err := retentionFromEnv()
+	if err != nil {
+		return err
+	}
+
+	// prepare DB
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+
+	// prepare OSO, management chain and spending are resolved from database
+	authManager, err := authz.NewAuthorizer(authz.Policy, authz.WithHierarchy(db), authz.WithSpending(db), authz.WithReports(db), authz.WithTitles(db))
+	if err != nil {
+		return err
+	}
+
+	// remove soft deleted records once retention period passes
+	go purgePeriodically(db, retention)
+
+	// prepare HTTP server, with login through identity provider if configured
+	var opts []httpapi.Option
+	if value := os.Getenv("EXPENSES_INSECURE_COOKIES"); value != "" {
+		insecure, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid EXPENSES_INSECURE_COOKIES %q", value)
+		}
+		// cookies are sent over plain HTTP too, e.g. in local development
+		opts = append(opts, httpapi.WithSecureCookies(!insecure))
+	}
+	sso, err := ssoFromEnv(context.Background())
+	if err != nil {
+		return err
+	}
+	if sso != nil {
+		opts = append(opts, httpapi.WithSSO(sso))
+	}
+	webApp := httpapi.NewHTTPHandler(db, authManager, opts...)
+
+	// run server
+	listenOn := os.Getenv("EXPENSES_LISTEN_ON")
+	if listenOn == "" {
+		listenOn = "127.0.0.1:8000"
+	}
+	log.Printf("Starting HTTP server on %s", listenOn)
+	return http.ListenAndServe(listenOn, webApp)
+}
+
+// openDB opens database configured with EXPENSES_DB environment variable
+// and makes sure schema is up to date.
+func openDB() (*store.SQLiteManager, error) {
+	dbName := os.Getenv("EXPENSES_DB")
+	if dbName == "" {
+		dbName = "expenses.sqlite"
+	}
+	db, err := store.NewDBManager(dbName)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Migrate(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// ssoFromEnv returns login with OpenID Connect identity provider configured
+// with EXPENSES_OIDC_* environment variables, nil if EXPENSES_OIDC_ISSUER
+// is not set. Group titles are listed as "group=title,group=title".
+func ssoFromEnv(ctx context.Context) (*httpapi.SSO, error) {
+	issuer := os.Getenv("EXPENSES_OIDC_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+
+	provisioning := httpapi.Provisioning{
+		OrganizationID: 1,
+		GroupTitles:    make(map[string]string),
+		DefaultTitle:   os.Getenv("EXPENSES_OIDC_DEFAULT_TITLE"),
+	}
+	if value := os.Getenv("EXPENSES_OIDC_ORGANIZATION"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("invalid EXPENSES_OIDC_ORGANIZATION %q", value)
+		}
+		provisioning.OrganizationID = id
+	}
+	if value := os.Getenv("EXPENSES_OIDC_GROUP_TITLES"); value != "" {
+		for _, pair := range strings.Split(value, ",") {
+			parts := strings.SplitN(pair, "=", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return nil, fmt.Errorf("invalid EXPENSES_OIDC_GROUP_TITLES %q", value)
+			}
+			provisioning.GroupTitles[parts[0]] = parts[1]
+		}
+	}
+
+	provider, err := oidc.NewProvider(ctx, oidc.Config{
+		Issuer:       issuer,
+		ClientID:     os.Getenv("EXPENSES_OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("EXPENSES_OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("EXPENSES_OIDC_REDIRECT_URL"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return httpapi.NewSSO(provider, provisioning), nil
+}
@@ -0,0 +1,153 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/model"
+	"github.com/delicb/oso-go-tutorial/store"
+)
+
+// explainRequest describes authorization decision admin wants explained.
+type explainRequest struct {
+	// Actor is referenced by ID or email, empty actor is guest user.
+	Actor struct {
+		ID    int    `json:"id"`
+		Email string `json:"email"`
+	} `json:"actor"`
+	// Action defaults to method of request resource.
+	Action string `json:"action"`
+	// Resource is either expense, organization or request (method and path).
+	Resource struct {
+		Expense      int    `json:"expense"`
+		Organization int    `json:"organization"`
+		Method       string `json:"method"`
+		Path         string `json:"path"`
+	} `json:"resource"`
+}
+
+type explainResponse struct {
+	Allowed  bool     `json:"allowed"`
+	Actor    string   `json:"actor"`
+	Action   string   `json:"action"`
+	Resource string   `json:"resource"`
+	Error    string   `json:"error,omitempty"`
+	Trace    []string `json:"trace"`
+}
+
+// explainHandler returns handler that evaluates authorization request
+// described in body, with provided explainer, and returns decision with
+// evaluation trace.
+func (h *HTTPServer) explainHandler(explainer authz.Explainer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 64*1024))
+		if err != nil {
+			http.Error(w, "unable to read provided body", http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+
+		var req explainRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, "failed to parse JSON", http.StatusBadRequest)
+			return
+		}
+
+		// admins explain decisions about their own organization only
+		db := h.tenant(UserFromRequest(r))
+		actor, err := explainActor(db, req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		action, resource, status, err := explainResource(db, req)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		allowed, trace, err := explainer.AuthorizeWithTrace(actor, action, resource)
+		resp := explainResponse{
+			Allowed:  allowed,
+			Actor:    actor.String(),
+			Action:   action,
+			Resource: describeResource(resource),
+			Trace:    trace,
+		}
+		if err != nil {
+			resp.Error = err.Error()
+		}
+		if resp.Trace == nil {
+			resp.Trace = []string{}
+		}
+
+		payload, err := json.Marshal(resp)
+		if err != nil {
+			http.Error(w, "failed to marshal json", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(payload)
+	}
+}
+
+func explainActor(db store.DBManager, req explainRequest) (model.User, error) {
+	switch {
+	case req.Actor.ID != 0:
+		user, err := db.UserByID(req.Actor.ID)
+		if err != nil {
+			return model.User{}, fmt.Errorf("unable to find actor")
+		}
+		return user, nil
+	case req.Actor.Email != "":
+		user, err := db.UserByEmail(req.Actor.Email)
+		if err != nil {
+			return model.User{}, fmt.Errorf("unable to find actor")
+		}
+		return user, nil
+	default:
+		// guest user
+		return model.User{}, nil
+	}
+}
+
+// explainResource loads resource referenced in request. In case of error,
+// HTTP status code to respond with is returned as well.
+func explainResource(db store.DBManager, req explainRequest) (action string, resource interface{}, status int, err error) {
+	ref := req.Resource
+	action = req.Action
+	switch {
+	case ref.Expense != 0:
+		resource, err = db.ExpenseByID(ref.Expense)
+	case ref.Organization != 0:
+		resource, err = db.OrganizationByID(ref.Organization)
+	case ref.Path != "":
+		if ref.Method == "" {
+			return "", nil, http.StatusBadRequest, fmt.Errorf("request resource requires method")
+		}
+		if action == "" {
+			action = ref.Method
+		}
+		resource = &http.Request{Method: ref.Method, URL: &url.URL{Path: ref.Path}}
+	default:
+		return "", nil, http.StatusBadRequest, fmt.Errorf("resource must reference expense, organization or request")
+	}
+	if err != nil {
+		return "", nil, http.StatusNotFound, fmt.Errorf("unable to find resource")
+	}
+	if action == "" {
+		return "", nil, http.StatusBadRequest, fmt.Errorf("action is required")
+	}
+	return action, resource, http.StatusOK, nil
+}
+
+func describeResource(resource interface{}) string {
+	if r, ok := resource.(*http.Request); ok {
+		return fmt.Sprintf("<Request: %s %s>", r.Method, r.URL.Path)
+	}
+	return fmt.Sprint(resource)
+}
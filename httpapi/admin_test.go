@@ -0,0 +1,96 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/store/storetest"
+)
+
+const adminData = `
+INSERT INTO users ("id", "email", "title", "organization_id") VALUES (2, 'admin@example.com', 'admin',  1);
+INSERT INTO expenses ("id", "user_id", "amount", "description", "organization_id") VALUES (7, 1, 100, 'lunch', 1);
+`
+
+func explain(t *testing.T, user, body string) (*httptest.ResponseRecorder, explainResponse) {
+	t.Helper()
+	db := storetest.New(t, storetest.Fixture, adminData)
+	// guests are told to authenticate only if some user holds admin title
+	auth, err := authz.NewAuthorizer(authz.Policy, authz.WithTitles(db))
+	if err != nil {
+		t.Fatalf("failed to create authorizer: %v", err)
+	}
+	handler := NewHTTPHandler(db, auth)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/authz/explain", strings.NewReader(body))
+	req.Header.Set("user", user)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var resp explainResponse
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+	}
+	return rec, resp
+}
+
+func TestExplain(t *testing.T) {
+	data := []struct {
+		name    string
+		body    string
+		allowed bool
+	}{
+		{"owner reads expense", `{"actor": {"id": 1}, "action": "read", "resource": {"expense": 7}}`, true},
+		{"admin reads expense", `{"actor": {"email": "admin@example.com"}, "action": "read", "resource": {"expense": 7}}`, false},
+		{"member reads organization", `{"actor": {"id": 1}, "action": "read", "resource": {"organization": 1}}`, true},
+		{"guest submits expense", `{"resource": {"method": "PUT", "path": "/expenses/submit"}}`, false},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.name, func(t *testing.T) {
+			rec, resp := explain(t, "admin@example.com", d.body)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("unexpected status code %d: %s", rec.Code, rec.Body.String())
+			}
+			if resp.Allowed != d.allowed {
+				t.Fatalf("expected allowed %v, got %v", d.allowed, resp.Allowed)
+			}
+			if len(resp.Trace) == 0 || !strings.HasPrefix(resp.Trace[0], "QUERY: allow(") {
+				t.Fatalf("expected evaluation trace, got %v", resp.Trace)
+			}
+		})
+	}
+}
+
+func TestExplain_Errors(t *testing.T) {
+	data := []struct {
+		name         string
+		user         string
+		body         string
+		expectedCode int
+	}{
+		{"guest", "", `{"action": "read", "resource": {"expense": 7}}`, http.StatusUnauthorized},
+		{"non admin", "test@example.com", `{"action": "read", "resource": {"expense": 7}}`, http.StatusForbidden},
+		{"invalid json", "admin@example.com", `{`, http.StatusBadRequest},
+		{"unknown actor", "admin@example.com", `{"actor": {"id": 99}, "action": "read", "resource": {"expense": 7}}`, http.StatusNotFound},
+		{"unknown resource", "admin@example.com", `{"action": "read", "resource": {"expense": 99}}`, http.StatusNotFound},
+		{"missing resource", "admin@example.com", `{"action": "read"}`, http.StatusBadRequest},
+		{"missing action", "admin@example.com", `{"resource": {"expense": 7}}`, http.StatusBadRequest},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.name, func(t *testing.T) {
+			if rec, _ := explain(t, d.user, d.body); rec.Code != d.expectedCode {
+				t.Fatalf("expected status code %d, got %d: %s", d.expectedCode, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+// listAPIKeys responds with service accounts of organization from URL,
+// revoked and expired included. Keys themselves are never listed.
+func (h *HTTPServer) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	organization, ok := h.organizationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	actor := ActorFromRequest(r)
+	if allowed := h.auth.Authorize(actor, "manage_api_keys", organization); !allowed {
+		h.forbidden(w, actor, "manage_api_keys", organization)
+		return
+	}
+
+	accounts, err := h.tenant(actor).ServiceAccounts(organization.ID)
+	if err != nil {
+		http.Error(w, "failed to fetch API keys", http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(accounts)
+	if err != nil {
+		http.Error(w, "failed to marshal json", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(payload)
+}
+
+// createAPIKey creates service account of organization from URL and
+// responds with its API key. Response is the only place key is ever shown.
+func (h *HTTPServer) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	organization, ok := h.organizationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	actor := ActorFromRequest(r)
+	if allowed := h.auth.Authorize(actor, "manage_api_keys", organization); !allowed {
+		h.forbidden(w, actor, "manage_api_keys", organization)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 64*1024))
+	if err != nil {
+		http.Error(w, "unable to read provided body", http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+
+	var account model.ServiceAccount
+	if err := json.Unmarshal(body, &account); err != nil {
+		http.Error(w, "failed to parse JSON", http.StatusBadRequest)
+		return
+	}
+	if err := validateServiceAccount(account); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	account.OrganizationID = organization.ID
+
+	created, key, err := h.tenant(actor).CreateServiceAccount(account)
+	if err != nil {
+		http.Error(w, "failed saving API key", http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(model.APIKey{ServiceAccount: created, Key: key})
+	if err != nil {
+		http.Error(w, "failed to marshal json", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	// key must not end up in caches
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write(payload)
+}
+
+// validateServiceAccount checks service account client asked to create.
+func validateServiceAccount(account model.ServiceAccount) error {
+	if account.Name == "" {
+		return fmt.Errorf("API key name is required")
+	}
+	for _, scope := range account.Scopes {
+		if !model.IsScope(scope) {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	if !account.ExpiresAt.IsZero() && !account.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("API key must expire in the future")
+	}
+	return nil
+}
+
+// revokeAPIKey makes API key referenced by key URL parameter unusable.
+func (h *HTTPServer) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	organization, ok := h.organizationFromURL(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "key"))
+	if err != nil {
+		http.Error(w, "invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	actor := ActorFromRequest(r)
+	if allowed := h.auth.Authorize(actor, "manage_api_keys", organization); !allowed {
+		h.forbidden(w, actor, "manage_api_keys", organization)
+		return
+	}
+
+	db := h.tenant(actor)
+	account, err := db.ServiceAccountByID(id)
+	if err != nil || account.OrganizationID != organization.ID {
+		http.Error(w, "unable to find API key", http.StatusNotFound)
+		return
+	}
+	if !account.RevokedAt.IsZero() {
+		http.Error(w, "API key is already revoked", http.StatusConflict)
+		return
+	}
+	if err := db.RevokeServiceAccount(id); err != nil {
+		// revoked since it was loaded
+		http.Error(w, "API key is already revoked", http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
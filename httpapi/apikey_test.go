@@ -0,0 +1,117 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/model"
+	"github.com/delicb/oso-go-tutorial/store/storetest"
+)
+
+const apiKeyData = `
+INSERT INTO organizations ("id", "name") VALUES (2, 'Other Org');
+INSERT INTO users ("id", "email", "title", "organization_id") VALUES (2, 'admin@example.com', 'admin',  1);
+INSERT INTO users ("id", "email", "title", "organization_id") VALUES (3, 'other@example.org', 'admin',  2);
+INSERT INTO expenses ("id", "user_id", "amount", "description", "organization_id", "status") VALUES (7, 1, 100, 'flight', 1, 'submitted');
+INSERT INTO expenses ("id", "user_id", "amount", "description", "organization_id", "status") VALUES (8, 3, 20, 'lunch', 2, 'submitted');
+`
+
+func TestAPIKeys(t *testing.T) {
+	auth, err := authz.NewAuthorizer(authz.Policy)
+	if err != nil {
+		t.Fatalf("failed to create authorizer: %v", err)
+	}
+	db := storetest.New(t, storetest.Fixture, apiKeyData)
+	handler := NewHTTPHandler(db, auth)
+
+	do := func(method, path, user, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("user", user)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	create := func(body string) model.APIKey {
+		rec := do(http.MethodPost, "/organizations/1/api-keys", "admin@example.com", "", body)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+		}
+		var created model.APIKey
+		if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+			t.Fatalf("failed to parse API key: %v", err)
+		}
+		return created
+	}
+
+	batch := create(`{"Name": "batch"}`)
+	exporter := create(`{"Name": "exporter", "Scopes": ["expenses:read"]}`)
+	if batch.Key == "" || batch.ServiceAccount.OrganizationID != 1 {
+		t.Fatalf("unexpected API key: %+v", batch)
+	}
+
+	// steps are executed in order, each one builds on the state left by previous
+	data := []struct {
+		name   string
+		method string
+		path   string
+		user   string
+		key    string
+		body   string
+		status int
+	}{
+		{"developer does not create keys", http.MethodPost, "/organizations/1/api-keys", "test@example.com", "", `{"Name": "x"}`, http.StatusForbidden},
+		{"key needs name", http.MethodPost, "/organizations/1/api-keys", "admin@example.com", "", `{}`, http.StatusBadRequest},
+		{"key needs known scopes", http.MethodPost, "/organizations/1/api-keys", "admin@example.com", "", `{"Name": "x", "Scopes": ["expenses:write"]}`, http.StatusBadRequest},
+		{"key can not be expired", http.MethodPost, "/organizations/1/api-keys", "admin@example.com", "", `{"Name": "x", "ExpiresAt": "2001-01-01T00:00:00Z"}`, http.StatusBadRequest},
+		{"admin of other organization does not find keys", http.MethodGet, "/organizations/1/api-keys", "other@example.org", "", "", http.StatusNotFound},
+		{"key reads expense", http.MethodGet, "/expenses/7", "", batch.Key, "", http.StatusOK},
+		{"key does not read expense of other organization", http.MethodGet, "/expenses/8", "", batch.Key, "", http.StatusNotFound},
+		{"key reads spending", http.MethodGet, "/reports/spending?group_by=user", "", batch.Key, "", http.StatusOK},
+		{"key does not submit", http.MethodPut, "/expenses/submit", "", batch.Key, `{"Amount": 1}`, http.StatusForbidden},
+		{"key does not manage keys", http.MethodGet, "/organizations/1/api-keys", "", batch.Key, "", http.StatusForbidden},
+		{"key does not act in other organization", http.MethodGet, "/orgs/2/expenses", "", batch.Key, "", http.StatusNotFound},
+		{"scoped key exports", http.MethodGet, "/expenses/export", "", exporter.Key, "", http.StatusOK},
+		{"scoped key does not read spending", http.MethodGet, "/reports/spending?group_by=user", "", exporter.Key, "", http.StatusForbidden},
+		{"unknown key is rejected", http.MethodGet, "/expenses", "", "exk_unknown", "", http.StatusUnauthorized},
+		{"admin revokes key", http.MethodDelete, "/organizations/1/api-keys/" + strconv.Itoa(batch.ServiceAccount.ID), "admin@example.com", "", "", http.StatusNoContent},
+		{"key is revoked once", http.MethodDelete, "/organizations/1/api-keys/" + strconv.Itoa(batch.ServiceAccount.ID), "admin@example.com", "", "", http.StatusConflict},
+		{"revoked key is rejected", http.MethodGet, "/expenses", "", batch.Key, "", http.StatusUnauthorized},
+		{"unknown key is not revoked", http.MethodDelete, "/organizations/1/api-keys/99", "admin@example.com", "", "", http.StatusNotFound},
+	}
+
+	for _, d := range data {
+		rec := do(d.method, d.path, d.user, d.key, d.body)
+		if rec.Code != d.status {
+			t.Fatalf("%s: expected status %d, got %d: %s", d.name, d.status, rec.Code, rec.Body.String())
+		}
+	}
+
+	// expired keys are rejected too
+	if err := db.RawExec(`UPDATE api_keys SET expires_at = '2001-01-01 00:00:00+00:00'`); err != nil {
+		t.Fatalf("failed to expire keys: %v", err)
+	}
+	if rec := do(http.MethodGet, "/expenses", "", exporter.Key, ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status %d for expired key, got %d", http.StatusUnauthorized, rec.Code)
+	}
+
+	// keys are listed, but never shown again
+	rec := do(http.MethodGet, "/organizations/1/api-keys", "admin@example.com", "", "")
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), batch.Key) {
+		t.Fatalf("unexpected list of API keys: %d %s", rec.Code, rec.Body.String())
+	}
+	var listed []model.ServiceAccount
+	if err := json.Unmarshal(rec.Body.Bytes(), &listed); err != nil {
+		t.Fatalf("failed to parse API keys: %v", err)
+	}
+	if len(listed) != 2 || listed[0].RevokedAt.IsZero() || !listed[1].RevokedAt.IsZero() {
+		t.Fatalf("unexpected API keys: %+v", listed)
+	}
+}
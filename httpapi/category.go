@@ -0,0 +1,133 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+func (h *HTTPServer) listCategories(w http.ResponseWriter, r *http.Request) {
+	organization, ok := h.organizationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	actor := ActorFromRequest(r)
+	if allowed := h.auth.Authorize(actor, "read", organization); !allowed {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	categories, err := h.tenant(actor).CategoriesByOrganization(organization.ID)
+	if err != nil {
+		http.Error(w, "failed to fetch categories", http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(categories)
+	if err != nil {
+		http.Error(w, "failed to marshal json", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(payload)
+}
+
+func (h *HTTPServer) createCategory(w http.ResponseWriter, r *http.Request) {
+	organization, ok := h.organizationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	user := UserFromRequest(r)
+	if allowed := h.auth.Authorize(user, "manage_categories", organization); !allowed {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 64*1024))
+	if err != nil {
+		http.Error(w, "unable to read provided body", http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+
+	var category model.Category
+	if err := json.Unmarshal(body, &category); err != nil {
+		http.Error(w, "failed to parse JSON", http.StatusBadRequest)
+		return
+	}
+	if category.Name == "" {
+		http.Error(w, "category name is required", http.StatusBadRequest)
+		return
+	}
+	category.OrganizationID = organization.ID
+
+	if _, err := h.categoryByName(user, category.Name); err == nil {
+		http.Error(w, "category already exists", http.StatusConflict)
+		return
+	}
+	created, err := h.tenant(user).CreateCategory(category)
+	if err != nil {
+		http.Error(w, "failed saving category", http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(created)
+	if err != nil {
+		http.Error(w, "failed to marshal json", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write(payload)
+}
+
+// organizationFromURL loads organization referenced by id URL parameter.
+// If it fails, error is written to response and false returned.
+func (h *HTTPServer) organizationFromURL(w http.ResponseWriter, r *http.Request) (model.Organization, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid organization ID", http.StatusBadRequest)
+		return model.Organization{}, false
+	}
+
+	organization, err := h.tenant(ActorFromRequest(r)).OrganizationByID(id)
+	if err != nil {
+		http.Error(w, "unable to find organization", http.StatusNotFound)
+		return model.Organization{}, false
+	}
+	return organization, true
+}
+
+// resolveCategory finds category of actor's organization by its ID or name.
+func (h *HTTPServer) resolveCategory(actor model.Actor, ref string) (model.Category, error) {
+	id, err := strconv.Atoi(ref)
+	if err != nil {
+		return h.categoryByName(actor, ref)
+	}
+	category, err := h.tenant(actor).CategoryByID(id)
+	if err != nil {
+		return model.Category{}, fmt.Errorf("unknown category %q", ref)
+	}
+	return category, nil
+}
+
+func (h *HTTPServer) categoryByName(actor model.Actor, name string) (model.Category, error) {
+	categories, err := h.tenant(actor).CategoriesByOrganization(actor.TenantID())
+	if err != nil {
+		return model.Category{}, err
+	}
+	for _, c := range categories {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+	return model.Category{}, fmt.Errorf("unknown category %q", name)
+}
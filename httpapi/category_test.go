@@ -0,0 +1,86 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/model"
+	"github.com/delicb/oso-go-tutorial/store/storetest"
+)
+
+const categoryData = `
+INSERT INTO users ("id", "email", "title", "organization_id") VALUES (2, 'accountant@example.com', 'accountant',  1);
+INSERT INTO organizations ("id", "name") VALUES (2, 'Other Org');
+INSERT INTO categories ("id", "organization_id", "name") VALUES (5, 2, 'travel');
+INSERT INTO expenses ("id", "user_id", "amount", "description", "organization_id", "status", "category_id") VALUES (7, 1, 100, 'flight', 1, 'submitted', 1);
+INSERT INTO expenses ("id", "user_id", "amount", "description", "organization_id", "status", "category_id") VALUES (8, 1, 20, 'lunch', 1, 'submitted', 2);
+INSERT INTO expenses ("id", "user_id", "amount", "description", "organization_id", "status") VALUES (9, 2, 30, 'taxi', 1, 'submitted');
+`
+
+func TestCategories(t *testing.T) {
+	auth, err := authz.NewAuthorizer(authz.Policy)
+	if err != nil {
+		t.Fatalf("failed to create authorizer: %v", err)
+	}
+	handler := NewHTTPHandler(storetest.New(t, storetest.Fixture, categoryData), auth)
+
+	// steps are executed in order
+	data := []struct {
+		name   string
+		user   string
+		method string
+		path   string
+		body   string
+		status int
+		// expected IDs for expense lists
+		ids []int
+	}{
+		{"list all readable expenses", "test@example.com", http.MethodGet, "/expenses", "", http.StatusOK, []int{7, 8}},
+		{"list by category name", "test@example.com", http.MethodGet, "/expenses?category=travel", "", http.StatusOK, []int{7}},
+		{"list by category ID", "test@example.com", http.MethodGet, "/expenses?category=2", "", http.StatusOK, []int{8}},
+		{"list by category of other organization", "test@example.com", http.MethodGet, "/expenses?category=5", "", http.StatusBadRequest, nil},
+		{"list by unknown category", "test@example.com", http.MethodGet, "/expenses?category=yachts", "", http.StatusBadRequest, nil},
+		{"accountant lists all organization expenses", "accountant@example.com", http.MethodGet, "/expenses", "", http.StatusOK, []int{7, 8, 9}},
+		{"guest lists nothing", "", http.MethodGet, "/expenses", "", http.StatusOK, []int{}},
+		{"list categories", "test@example.com", http.MethodGet, "/organizations/1/categories", "", http.StatusOK, nil},
+		{"other organization is not found", "test@example.com", http.MethodGet, "/organizations/2/categories", "", http.StatusNotFound, nil},
+		{"developer can not create category", "test@example.com", http.MethodPost, "/organizations/1/categories", `{"Name": "training"}`, http.StatusForbidden, nil},
+		{"accountant creates category", "accountant@example.com", http.MethodPost, "/organizations/1/categories", `{"Name": "training"}`, http.StatusCreated, nil},
+		{"duplicate category", "accountant@example.com", http.MethodPost, "/organizations/1/categories", `{"Name": "training"}`, http.StatusConflict, nil},
+		{"category without name", "accountant@example.com", http.MethodPost, "/organizations/1/categories", `{}`, http.StatusBadRequest, nil},
+		{"submit cheap equipment", "test@example.com", http.MethodPut, "/expenses/submit", `{"Amount": 100, "CategoryID": 3}`, http.StatusTemporaryRedirect, nil},
+		{"submit expensive equipment", "test@example.com", http.MethodPut, "/expenses/submit", `{"Amount": 900, "CategoryID": 3}`, http.StatusForbidden, nil},
+		{"category name from client is ignored", "test@example.com", http.MethodPut, "/expenses/submit", `{"Amount": 900, "CategoryID": 3, "Category": "travel"}`, http.StatusForbidden, nil},
+		{"submit with category of other organization", "test@example.com", http.MethodPut, "/expenses/submit", `{"Amount": 100, "CategoryID": 5}`, http.StatusBadRequest, nil},
+	}
+
+	for _, d := range data {
+		req := httptest.NewRequest(d.method, d.path, strings.NewReader(d.body))
+		req.Header.Set("user", d.user)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != d.status {
+			t.Fatalf("%s: expected status %d, got %d: %s", d.name, d.status, rec.Code, rec.Body.String())
+		}
+		if d.ids == nil {
+			continue
+		}
+
+		var expenses []model.Expense
+		if err := json.Unmarshal(rec.Body.Bytes(), &expenses); err != nil {
+			t.Fatalf("%s: failed to parse response: %v", d.name, err)
+		}
+		ids := []int{}
+		for _, e := range expenses {
+			ids = append(ids, e.ID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(d.ids) {
+			t.Fatalf("%s: unexpected expenses, got: %v, expected: %v", d.name, ids, d.ids)
+		}
+	}
+}
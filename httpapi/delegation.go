@@ -0,0 +1,64 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+// createDelegation lets current user grant their approval rights to another
+// user for limited time (e.g. while on vacation). Delegation starts
+// immediately, unless start is provided.
+func (h *HTTPServer) createDelegation(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 64*1024))
+	if err != nil {
+		http.Error(w, "unable to read provided body", http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+
+	var delegation model.Delegation
+	if err := json.Unmarshal(body, &delegation); err != nil {
+		http.Error(w, "failed to parse JSON", http.StatusBadRequest)
+		return
+	}
+
+	user := UserFromRequest(r)
+	if delegation.DelegatorID == 0 {
+		delegation.DelegatorID = user.ID
+	}
+	if delegation.StartsAt.IsZero() {
+		delegation.StartsAt = time.Now()
+	}
+	if !delegation.EndsAt.After(delegation.StartsAt) {
+		http.Error(w, "delegation must end after it starts", http.StatusBadRequest)
+		return
+	}
+	if _, err := h.tenant(user).UserByID(delegation.DelegateID); err != nil {
+		http.Error(w, "unable to find delegate", http.StatusBadRequest)
+		return
+	}
+
+	if allowed := h.auth.Authorize(user, "create", delegation); !allowed {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	created, err := h.tenant(user).CreateDelegation(delegation)
+	if err != nil {
+		http.Error(w, "failed saving delegation", http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(created)
+	if err != nil {
+		http.Error(w, "failed to marshal json", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write(payload)
+}
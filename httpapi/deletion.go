@@ -0,0 +1,156 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/delicb/oso-go-tutorial/model"
+	"github.com/delicb/oso-go-tutorial/store"
+)
+
+// deleteRecord returns handler soft deleting record of provided kind
+// (e.g. store.KindExpense) referenced by id URL parameter.
+func (h *HTTPServer) deleteRecord(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid "+kind+" ID", http.StatusBadRequest)
+			return
+		}
+		user := UserFromRequest(r)
+		db := h.tenant(user)
+		record, err := recordByID(db, kind, id)
+		if err != nil {
+			http.Error(w, "unable to find "+kind, http.StatusNotFound)
+			return
+		}
+
+		if allowed := h.auth.Authorize(user, "delete", record); !allowed {
+			h.forbidden(w, user, "delete", record)
+			return
+		}
+		// users have no entity tag clients could know, so they are deleted
+		// unconditionally
+		if v, ok := record.(versioned); ok && preconditionFailed(w, r, v) {
+			return
+		}
+		err = db.SoftDelete(kind, id, user.ID, rowVersionOf(record))
+		if errors.Is(err, store.ErrRecordChanged) {
+			// changed since it was authorized and its version checked
+			http.Error(w, "record was changed", http.StatusPreconditionFailed)
+			return
+		}
+		if err != nil {
+			// deleted since it was loaded
+			http.Error(w, "unable to find "+kind, http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// listDeleted responds with soft deleted records of kind from URL that
+// belong to user's organization and user can restore.
+func (h *HTTPServer) listDeleted(w http.ResponseWriter, r *http.Request) {
+	kind := chi.URLParam(r, "kind")
+	if !store.IsDeletable(kind) {
+		http.Error(w, "unknown kind", http.StatusNotFound)
+		return
+	}
+
+	user := UserFromRequest(r)
+	all, err := h.tenant(user).DeletedRecords(kind, user.OrganizationID)
+	if err != nil {
+		http.Error(w, "failed to fetch deleted records", http.StatusInternalServerError)
+		return
+	}
+	records := []store.DeletedRecord{}
+	for _, record := range all {
+		if h.auth.Authorize(user, "restore", record.Record) {
+			records = append(records, record)
+		}
+	}
+
+	payload, err := json.Marshal(records)
+	if err != nil {
+		http.Error(w, "failed to marshal json", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(payload)
+}
+
+// restoreRecord undoes soft deletion of record referenced by kind and id
+// URL parameters and responds with restored record.
+func (h *HTTPServer) restoreRecord(w http.ResponseWriter, r *http.Request) {
+	kind := chi.URLParam(r, "kind")
+	if !store.IsDeletable(kind) {
+		http.Error(w, "unknown kind", http.StatusNotFound)
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid "+kind+" ID", http.StatusBadRequest)
+		return
+	}
+	user := UserFromRequest(r)
+	record, err := h.tenant(user).DeletedRecordByID(kind, id)
+	if err != nil {
+		http.Error(w, "unable to find deleted "+kind, http.StatusNotFound)
+		return
+	}
+
+	if allowed := h.auth.Authorize(user, "restore", record.Record); !allowed {
+		h.forbidden(w, user, "restore", record.Record)
+		return
+	}
+	if err := h.tenant(user).Restore(kind, id, user.ID); err != nil {
+		// restored since it was loaded
+		http.Error(w, "unable to find deleted "+kind, http.StatusNotFound)
+		return
+	}
+
+	payload, err := json.Marshal(record.Record)
+	if err != nil {
+		http.Error(w, "failed to marshal json", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(payload)
+}
+
+// rowVersionOf returns row version of record, zero for records without one.
+func rowVersionOf(record interface{}) int {
+	switch r := record.(type) {
+	case model.Expense:
+		return r.RowVersion
+	case model.Organization:
+		return r.RowVersion
+	}
+	return 0
+}
+
+// recordByID loads record of provided kind that is not deleted.
+func recordByID(db store.DBManager, kind string, id int) (interface{}, error) {
+	var record interface{}
+	var err error
+	switch kind {
+	case store.KindUser:
+		record, err = db.UserByID(id)
+	case store.KindOrganization:
+		record, err = db.OrganizationByID(id)
+	case store.KindExpense:
+		record, err = db.ExpenseByID(id)
+	default:
+		err = fmt.Errorf("unknown kind %q", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
@@ -0,0 +1,93 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/store/storetest"
+)
+
+const deletionData = `
+INSERT INTO users ("id", "email", "title", "organization_id") VALUES (2, 'admin@example.com', 'admin',  1);
+INSERT INTO users ("id", "email", "title", "organization_id") VALUES (3, 'colleague@example.com', 'developer',  1);
+INSERT INTO organizations ("id", "name") VALUES (2, 'Other Org');
+INSERT INTO users ("id", "email", "title", "organization_id") VALUES (4, 'admin@example.org', 'admin',  2);
+INSERT INTO expenses ("id", "user_id", "amount", "description", "organization_id", "status") VALUES (7, 1, 100, 'lunch', 1, 'submitted');
+INSERT INTO expenses ("id", "user_id", "amount", "description", "organization_id", "status") VALUES (8, 3, 20, 'taxi', 1, 'submitted');
+INSERT INTO expenses ("id", "user_id", "amount", "description", "organization_id", "status") VALUES (9, 4, 30, 'hotel', 2, 'submitted');
+`
+
+func TestSoftDeletion(t *testing.T) {
+	auth, err := authz.NewAuthorizer(authz.Policy)
+	if err != nil {
+		t.Fatalf("failed to create authorizer: %v", err)
+	}
+	handler := NewHTTPHandler(storetest.New(t, storetest.Fixture, deletionData), auth)
+
+	// steps are executed in order
+	data := []struct {
+		name   string
+		user   string
+		method string
+		path   string
+		status int
+		// expected IDs of listed deleted records
+		ids []int
+	}{
+		{"colleague can not delete expense", "colleague@example.com", http.MethodDelete, "/expenses/7", http.StatusForbidden, nil},
+		{"owner deletes expense", "test@example.com", http.MethodDelete, "/expenses/7", http.StatusNoContent, nil},
+		{"deleted expense is not found", "test@example.com", http.MethodGet, "/expenses/7", http.StatusNotFound, nil},
+		{"expense is deleted once", "test@example.com", http.MethodDelete, "/expenses/7", http.StatusNotFound, nil},
+		{"user can not list deleted expenses", "test@example.com", http.MethodGet, "/admin/deleted/expense", http.StatusForbidden, nil},
+		{"admin lists deleted expenses", "admin@example.com", http.MethodGet, "/admin/deleted/expense", http.StatusOK, []int{7}},
+		{"admin of other organization lists nothing", "admin@example.org", http.MethodGet, "/admin/deleted/expense", http.StatusOK, []int{}},
+		{"unknown kind", "admin@example.com", http.MethodGet, "/admin/deleted/planet", http.StatusNotFound, nil},
+		{"admin deletes user", "admin@example.com", http.MethodDelete, "/users/3", http.StatusNoContent, nil},
+		{"deleted user is guest", "colleague@example.com", http.MethodDelete, "/expenses/8", http.StatusUnauthorized, nil},
+		{"admin can not delete themselves", "admin@example.com", http.MethodDelete, "/users/2", http.StatusForbidden, nil},
+		{"admin lists deleted users", "admin@example.com", http.MethodGet, "/admin/deleted/user", http.StatusOK, []int{3}},
+		{"admin of other organization does not find expense", "admin@example.org", http.MethodPost, "/admin/deleted/expense/7/restore", http.StatusNotFound, nil},
+		{"admin restores expense", "admin@example.com", http.MethodPost, "/admin/deleted/expense/7/restore", http.StatusOK, nil},
+		{"restored expense is found", "test@example.com", http.MethodGet, "/expenses/7", http.StatusOK, nil},
+		{"expense is restored once", "admin@example.com", http.MethodPost, "/admin/deleted/expense/7/restore", http.StatusNotFound, nil},
+		{"admin restores user", "admin@example.com", http.MethodPost, "/admin/deleted/user/3/restore", http.StatusOK, nil},
+		{"restored user is authenticated", "colleague@example.com", http.MethodDelete, "/expenses/8", http.StatusNoContent, nil},
+		{"admin deletes own organization", "admin@example.org", http.MethodDelete, "/organizations/2", http.StatusNoContent, nil},
+		{"admin of deleted organization is guest", "admin@example.org", http.MethodDelete, "/expenses/9", http.StatusUnauthorized, nil},
+	}
+
+	for _, d := range data {
+		req := httptest.NewRequest(d.method, d.path, nil)
+		req.Header.Set("user", d.user)
+		// changes are made to whatever version is current
+		req.Header.Set("If-Match", "*")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != d.status {
+			t.Fatalf("%s: expected status %d, got %d: %s", d.name, d.status, rec.Code, rec.Body.String())
+		}
+		if d.ids == nil {
+			continue
+		}
+
+		var records []struct {
+			Record struct {
+				ID int
+			}
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &records); err != nil {
+			t.Fatalf("%s: failed to parse response: %v", d.name, err)
+		}
+		ids := []int{}
+		for _, r := range records {
+			ids = append(ids, r.Record.ID)
+		}
+		if !reflect.DeepEqual(ids, d.ids) {
+			t.Fatalf("%s: expected records %v, got %v", d.name, d.ids, ids)
+		}
+	}
+}
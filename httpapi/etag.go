@@ -0,0 +1,62 @@
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+)
+
+// versioned is implemented by records with entity tag of their current
+// version (e.g. model.Expense).
+type versioned interface {
+	ETag() string
+}
+
+// notModified sets ETag header of current version of record and responds
+// with 304 Not Modified if client already has it, according to
+// If-None-Match header. Reports if response was written.
+func notModified(w http.ResponseWriter, r *http.Request, record versioned) bool {
+	etag := record.ETag()
+	w.Header().Set("ETag", etag)
+	if !matchesETag(r.Header.Get("If-None-Match"), etag, true) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// preconditionFailed makes sure client changes version of record it saw,
+// provided in If-Match header. Missing header is answered with 428
+// Precondition Required and other version with 412 Precondition Failed.
+// Reports if response was written.
+func preconditionFailed(w http.ResponseWriter, r *http.Request, record versioned) bool {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		http.Error(w, "If-Match header is required", http.StatusPreconditionRequired)
+		return true
+	}
+	if !matchesETag(ifMatch, record.ETag(), false) {
+		w.Header().Set("ETag", record.ETag())
+		http.Error(w, "record was changed", http.StatusPreconditionFailed)
+		return true
+	}
+	return false
+}
+
+// matchesETag reports if value of If-Match or If-None-Match header matches
+// provided entity tag. Weak tags match only in weak comparison, which is
+// used for If-None-Match.
+func matchesETag(header, etag string, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/store/storetest"
+)
+
+const etagData = `
+INSERT INTO users ("id", "email", "title", "organization_id") VALUES (2, 'accountant@example.com', 'accountant',  1);
+INSERT INTO expenses ("id", "user_id", "amount", "description", "organization_id", "status") VALUES (7, 1, 100, 'flight', 1, 'submitted');
+INSERT INTO expenses ("id", "user_id", "amount", "description", "organization_id", "status") VALUES (8, 1, 20, 'lunch', 1, 'submitted');
+`
+
+func TestConditionalRequests(t *testing.T) {
+	auth, err := authz.NewAuthorizer(authz.Policy)
+	if err != nil {
+		t.Fatalf("failed to create authorizer: %v", err)
+	}
+	handler := NewHTTPHandler(storetest.New(t, storetest.Fixture, etagData), auth)
+
+	// steps are executed in order
+	data := []struct {
+		name        string
+		user        string
+		method      string
+		path        string
+		ifMatch     string
+		ifNoneMatch string
+		status      int
+		// etag is expected ETag header of response, if set
+		etag string
+	}{
+		{"expense has etag", "accountant@example.com", http.MethodGet, "/expenses/7", "", "", http.StatusOK, `"1"`},
+		{"expense not modified", "accountant@example.com", http.MethodGet, "/expenses/7", "", `"1"`, http.StatusNotModified, `"1"`},
+		{"weak tag not modified", "accountant@example.com", http.MethodGet, "/expenses/7", "", `"0", W/"1"`, http.StatusNotModified, `"1"`},
+		{"organization not modified", "test@example.com", http.MethodGet, "/organizations/1", "", `"1"`, http.StatusNotModified, `"1"`},
+		{"organization modified", "test@example.com", http.MethodGet, "/organizations/1", "", `"2"`, http.StatusOK, `"1"`},
+		{"guest does not find expense", "", http.MethodGet, "/expenses/7", "", `"1"`, http.StatusNotFound, ""},
+		{"approve requires if-match", "accountant@example.com", http.MethodPost, "/expenses/7/approve", "", "", http.StatusPreconditionRequired, ""},
+		{"approve unknown version", "accountant@example.com", http.MethodPost, "/expenses/7/approve", `"2"`, "", http.StatusPreconditionFailed, `"1"`},
+		{"weak tag does not match", "accountant@example.com", http.MethodPost, "/expenses/7/approve", `W/"1"`, "", http.StatusPreconditionFailed, `"1"`},
+		{"approve current version", "accountant@example.com", http.MethodPost, "/expenses/7/approve", `"1"`, "", http.StatusOK, `"2"`},
+		{"reimburse stale version", "accountant@example.com", http.MethodPost, "/expenses/7/reimburse", `"1"`, "", http.StatusPreconditionFailed, `"2"`},
+		{"changed expense is modified", "accountant@example.com", http.MethodGet, "/expenses/7", "", `"1"`, http.StatusOK, `"2"`},
+		{"delete requires if-match", "test@example.com", http.MethodDelete, "/expenses/8", "", "", http.StatusPreconditionRequired, ""},
+		{"delete stale version", "test@example.com", http.MethodDelete, "/expenses/8", `"0"`, "", http.StatusPreconditionFailed, `"1"`},
+		{"delete current version", "test@example.com", http.MethodDelete, "/expenses/8", `"1"`, "", http.StatusNoContent, ""},
+	}
+
+	for _, d := range data {
+		req := httptest.NewRequest(d.method, d.path, nil)
+		req.Header.Set("user", d.user)
+		if d.ifMatch != "" {
+			req.Header.Set("If-Match", d.ifMatch)
+		}
+		if d.ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", d.ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != d.status {
+			t.Fatalf("%s: expected status %d, got %d: %s", d.name, d.status, rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get("ETag"); d.etag != "" && got != d.etag {
+			t.Fatalf("%s: expected etag %s, got %s", d.name, d.etag, got)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/delicb/oso-go-tutorial/model"
+	"github.com/delicb/oso-go-tutorial/store"
+)
+
+// expenseWriter writes exported expenses one by one. Close writes whatever
+// format needs after last expense and reports first write error.
+type expenseWriter interface {
+	Write(model.Expense) error
+	Close() error
+}
+
+// exportFormat describes single format expenses can be exported in.
+type exportFormat struct {
+	contentType string
+	newWriter   func(io.Writer) expenseWriter
+}
+
+// exportFormats are formats supported by export, by name used in format
+// parameter, which is also extension of exported file.
+var exportFormats = map[string]exportFormat{
+	"csv":   {"text/csv", newCSVExport},
+	"jsonl": {"application/x-ndjson", newJSONLinesExport},
+	"qif":   {"application/qif", newQIFExport},
+	"ofx":   {"application/x-ofx", newOFXExport},
+}
+
+// exportExpenses streams expenses of user's organization user is allowed to
+// read, in format from format parameter (CSV by default), optionally
+// filtered by category (ID or name).
+func (h *HTTPServer) exportExpenses(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("format")
+	if name == "" {
+		name = "csv"
+	}
+	format, ok := exportFormats[name]
+	if !ok {
+		http.Error(w, "format must be one of csv, jsonl, qif or ofx", http.StatusBadRequest)
+		return
+	}
+
+	actor := ActorFromRequest(r)
+	filter := store.ExpenseFilter{OrganizationID: actor.TenantID()}
+	if ref := r.URL.Query().Get("category"); ref != "" {
+		category, err := h.resolveCategory(actor, ref)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.CategoryID = category.ID
+	}
+
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="expenses.%s"`, name))
+	out := format.newWriter(w)
+
+	// guests do not belong to any organization, so they get empty export
+	if actor.IsAuthenticated() {
+		err := h.tenant(actor).EachExpense(filter, func(expense model.Expense) error {
+			if !h.auth.Authorize(actor, "read", expense) {
+				return nil
+			}
+			return out.Write(expense)
+		})
+		if err != nil {
+			// response is already streaming, so client gets truncated export
+			log.Printf("exporting expenses: %v", err)
+			return
+		}
+	}
+	if err := out.Close(); err != nil {
+		log.Printf("exporting expenses: %v", err)
+	}
+}
+
+// formatAmount formats whole amount as accounting tools expect, negative
+// since expenses are money spent.
+func formatAmount(amount int) string {
+	return fmt.Sprintf("%d.00", -amount)
+}
+
+type csvExport struct {
+	out *csv.Writer
+}
+
+func newCSVExport(w io.Writer) expenseWriter {
+	out := csv.NewWriter(w)
+	_ = out.Write([]string{"id", "date", "user_id", "amount", "description", "status", "category"})
+	return &csvExport{out: out}
+}
+
+func (e *csvExport) Write(expense model.Expense) error {
+	var date string
+	if !expense.CreatedAt.IsZero() {
+		date = expense.CreatedAt.Format(dateLayout)
+	}
+	return e.out.Write([]string{
+		strconv.Itoa(expense.ID), date, strconv.Itoa(expense.UserID), strconv.Itoa(expense.Amount),
+		expense.Description, string(expense.Status), expense.Category,
+	})
+}
+
+func (e *csvExport) Close() error {
+	e.out.Flush()
+	return e.out.Error()
+}
+
+type jsonLinesExport struct {
+	out *bufio.Writer
+	enc *json.Encoder
+}
+
+func newJSONLinesExport(w io.Writer) expenseWriter {
+	out := bufio.NewWriter(w)
+	return &jsonLinesExport{out: out, enc: json.NewEncoder(out)}
+}
+
+func (e *jsonLinesExport) Write(expense model.Expense) error {
+	return e.enc.Encode(expense)
+}
+
+func (e *jsonLinesExport) Close() error {
+	return e.out.Flush()
+}
+
+// qifExport writes expenses as bank transactions in Quicken Interchange Format.
+type qifExport struct {
+	out *bufio.Writer
+}
+
+func newQIFExport(w io.Writer) expenseWriter {
+	out := bufio.NewWriter(w)
+	_, _ = out.WriteString("!Type:Bank\n")
+	return &qifExport{out: out}
+}
+
+func (e *qifExport) Write(expense model.Expense) error {
+	if !expense.CreatedAt.IsZero() {
+		fmt.Fprintf(e.out, "D%s\n", expense.CreatedAt.Format("01/02/2006"))
+	}
+	fmt.Fprintf(e.out, "T%s\nN%d\nP%s\n", formatAmount(expense.Amount), expense.ID, qifLine(expense.Description))
+	if expense.Category != "" {
+		fmt.Fprintf(e.out, "L%s\n", qifLine(expense.Category))
+	}
+	_, err := e.out.WriteString("^\n")
+	return err
+}
+
+func (e *qifExport) Close() error {
+	return e.out.Flush()
+}
+
+// qifLine makes value safe to use as single QIF field, fields are line based.
+func qifLine(value string) string {
+	for i, c := range value {
+		if c == '\n' || c == '\r' {
+			return value[:i]
+		}
+	}
+	return value
+}
+
+// ofxExport writes expenses as bank statement transactions in OFX 2 format.
+type ofxExport struct {
+	out *bufio.Writer
+}
+
+func newOFXExport(w io.Writer) expenseWriter {
+	out := bufio.NewWriter(w)
+	_, _ = out.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX><BANKMSGSRSV1><STMTTRNRS><STMTRS><BANKTRANLIST>
+`)
+	return &ofxExport{out: out}
+}
+
+func (e *ofxExport) Write(expense model.Expense) error {
+	fmt.Fprintf(e.out, "<STMTTRN><TRNTYPE>DEBIT</TRNTYPE><DTPOSTED>%s</DTPOSTED><TRNAMT>%s</TRNAMT><FITID>%d</FITID>",
+		expense.CreatedAt.Format("20060102"), formatAmount(expense.Amount), expense.ID)
+	_, _ = e.out.WriteString("<NAME>")
+	_ = xml.EscapeText(e.out, []byte(expense.Description))
+	_, _ = e.out.WriteString("</NAME>")
+	if expense.Category != "" {
+		_, _ = e.out.WriteString("<MEMO>")
+		_ = xml.EscapeText(e.out, []byte(expense.Category))
+		_, _ = e.out.WriteString("</MEMO>")
+	}
+	_, err := e.out.WriteString("</STMTTRN>\n")
+	return err
+}
+
+func (e *ofxExport) Close() error {
+	_, _ = e.out.WriteString("</BANKTRANLIST></STMTRS></STMTTRNRS></BANKMSGSRSV1></OFX>\n")
+	return e.out.Flush()
+}
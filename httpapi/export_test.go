@@ -0,0 +1,92 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/store/storetest"
+)
+
+const exportData = `
+INSERT INTO users ("id", "email", "title", "organization_id") VALUES (2, 'accountant@example.com', 'accountant',  1);
+INSERT INTO expenses ("id", "user_id", "amount", "description", "organization_id", "status", "category_id", "created_at") VALUES (7, 1, 100, 'flight & "hotel"', 1, 'approved', 1, '2021-03-04 10:00:00+00:00');
+INSERT INTO expenses ("id", "user_id", "amount", "description", "organization_id", "status", "category_id", "created_at") VALUES (8, 2, 20, 'lunch', 1, 'submitted', 2, '2021-03-05 12:00:00+00:00');
+INSERT INTO expenses ("id", "user_id", "amount", "description", "organization_id", "status") VALUES (9, 1, 30, 'taxi', 1, 'draft');
+`
+
+func TestExportExpenses(t *testing.T) {
+	auth, err := authz.NewAuthorizer(authz.Policy)
+	if err != nil {
+		t.Fatalf("failed to create authorizer: %v", err)
+	}
+	handler := NewHTTPHandler(storetest.New(t, storetest.Fixture, exportData), auth)
+
+	data := []struct {
+		name        string
+		user        string
+		query       string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"csv by default", "test@example.com", "", http.StatusOK, "text/csv",
+			"id,date,user_id,amount,description,status,category\n" +
+				"7,2021-03-04,1,100,\"flight & \"\"hotel\"\"\",approved,travel\n" +
+				"9,,1,30,taxi,draft,\n"},
+		{"accountant exports organization", "accountant@example.com", "format=jsonl", http.StatusOK, "application/x-ndjson",
+			`{"ID":7,"UserID":1,"Amount":100,"Description":"flight \u0026 \"hotel\"","OrganizationID":1,"Status":"approved","CategoryID":1,"Category":"travel","ReportID":0,"CreatedAt":"2021-03-04T10:00:00Z","RowVersion":1}` + "\n" +
+				`{"ID":8,"UserID":2,"Amount":20,"Description":"lunch","OrganizationID":1,"Status":"submitted","CategoryID":2,"Category":"meals","ReportID":0,"CreatedAt":"2021-03-05T12:00:00Z","RowVersion":1}` + "\n" +
+				`{"ID":9,"UserID":1,"Amount":30,"Description":"taxi","OrganizationID":1,"Status":"draft","CategoryID":0,"Category":"","ReportID":0,"CreatedAt":"0001-01-01T00:00:00Z","RowVersion":1}` + "\n"},
+		{"by category", "accountant@example.com", "format=csv&category=meals", http.StatusOK, "text/csv",
+			"id,date,user_id,amount,description,status,category\n" +
+				"8,2021-03-05,2,20,lunch,submitted,meals\n"},
+		{"qif", "test@example.com", "format=qif", http.StatusOK, "application/qif",
+			"!Type:Bank\n" +
+				"D03/04/2021\nT-100.00\nN7\nPflight & \"hotel\"\nLtravel\n^\n" +
+				"T-30.00\nN9\nPtaxi\n^\n"},
+		{"ofx", "accountant@example.com", "format=ofx&category=travel", http.StatusOK, "application/x-ofx",
+			`<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+				`<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>` + "\n" +
+				"<OFX><BANKMSGSRSV1><STMTTRNRS><STMTRS><BANKTRANLIST>\n" +
+				"<STMTTRN><TRNTYPE>DEBIT</TRNTYPE><DTPOSTED>20210304</DTPOSTED><TRNAMT>-100.00</TRNAMT><FITID>7</FITID>" +
+				"<NAME>flight &amp; &#34;hotel&#34;</NAME><MEMO>travel</MEMO></STMTTRN>\n" +
+				"</BANKTRANLIST></STMTRS></STMTTRNRS></BANKMSGSRSV1></OFX>\n"},
+		{"guest gets empty export", "", "", http.StatusOK, "text/csv",
+			"id,date,user_id,amount,description,status,category\n"},
+		{"unknown format", "test@example.com", "format=xls", http.StatusBadRequest, "", ""},
+		{"unknown category", "test@example.com", "category=yachts", http.StatusBadRequest, "", ""},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/expenses/export?"+d.query, nil)
+			req.Header.Set("user", d.user)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != d.status {
+				t.Fatalf("expected status %d, got %d: %s", d.status, rec.Code, rec.Body.String())
+			}
+			if d.status != http.StatusOK {
+				return
+			}
+			if got := rec.Header().Get("Content-Type"); got != d.contentType {
+				t.Fatalf("unexpected content type: %s", got)
+			}
+			if got := rec.Body.String(); got != d.body {
+				t.Fatalf("unexpected body, got:\n%s\nexpected:\n%s", got, d.body)
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/expenses/export?format=qif", nil)
+	req.Header.Set("user", "test@example.com")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Content-Disposition"); !strings.Contains(got, `filename="expenses.qif"`) {
+		t.Fatalf("unexpected content disposition: %s", got)
+	}
+}
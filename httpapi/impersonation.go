@@ -0,0 +1,116 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/model"
+	"github.com/delicb/oso-go-tutorial/store"
+)
+
+// impersonateHeader holds email of user request is made as.
+const impersonateHeader = "X-Impersonate-User"
+
+// RealUserFromRequest returns user that made the request. It differs from
+// UserFromRequest only if request impersonates other user, see Impersonate.
+func RealUserFromRequest(r *http.Request) model.User {
+	if u, ok := r.Context().Value(realUserKey).(model.User); ok {
+		return u
+	}
+	return UserFromRequest(r)
+}
+
+// Impersonate is a middleware that lets authenticated user act as other
+// user of their organization, selected with impersonateHeader, if policy
+// allows "impersonate" action on that user. Rest of the request is handled
+// as made by impersonated user, user that made it stays available through
+// RealUserFromRequest. Every impersonated request is recorded to audit log
+// before it is handled, requests that can not be recorded are rejected.
+func Impersonate(db store.DBManager, auth authz.Authorizer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			email := r.Header.Get(impersonateHeader)
+			if email == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// service accounts and guests have no user to impersonate with
+			real := UserFromRequest(r)
+			if isGuest(ActorFromRequest(r)) {
+				unauthenticated(w)
+				return
+			}
+			if _, isServiceAccount := ActorFromRequest(r).(model.ServiceAccount); isServiceAccount {
+				http.Error(w, "impersonation not allowed", http.StatusForbidden)
+				return
+			}
+
+			// impersonated user acts in organization of real user
+			tenant := store.ForTenant(db, real.TenantID())
+			target, err := tenant.UserByEmail(email)
+			if err != nil {
+				http.Error(w, "unable to find impersonated user", http.StatusNotFound)
+				return
+			}
+			if !auth.Authorize(real, "impersonate", target) {
+				http.Error(w, "impersonation not allowed", http.StatusForbidden)
+				return
+			}
+
+			recorded, err := tenant.RecordImpersonation(model.Impersonation{
+				OrganizationID:  real.TenantID(),
+				RealUserID:      real.ID,
+				EffectiveUserID: target.ID,
+				Method:          r.Method,
+				Path:            r.URL.RequestURI(),
+			})
+			if err != nil {
+				log.Println("recording impersonation failed", err)
+				http.Error(w, "failed to record impersonation", http.StatusInternalServerError)
+				return
+			}
+			log.Printf("impersonation %d: %s as %s: %s %s", recorded.ID, real.Email, target.Email, recorded.Method, recorded.Path)
+
+			ctx := context.WithValue(r.Context(), realUserKey, real)
+			ctx = context.WithValue(ctx, userKey, target)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// withoutImpersonation is a middleware that rejects impersonated requests.
+// It guards handlers managing sessions, impersonating user would otherwise
+// get session of impersonated user, acting as them without audit, or end
+// their sessions.
+func withoutImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, impersonated := r.Context().Value(realUserKey).(model.User); impersonated {
+			http.Error(w, "not allowed while impersonating", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// listImpersonations responds with audit log of impersonated requests in
+// organization of current user.
+func (h *HTTPServer) listImpersonations(w http.ResponseWriter, r *http.Request) {
+	user := UserFromRequest(r)
+	impersonations, err := h.tenant(user).Impersonations(user.OrganizationID)
+	if err != nil {
+		http.Error(w, "failed to fetch impersonations", http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(impersonations)
+	if err != nil {
+		http.Error(w, "failed to marshal json", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(payload)
+}
@@ -0,0 +1,127 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/model"
+	"github.com/delicb/oso-go-tutorial/store"
+	"github.com/delicb/oso-go-tutorial/store/storetest"
+)
+
+const impersonationData = `
+INSERT INTO organizations ("id", "name") VALUES (2, 'Other Org');
+INSERT INTO users ("id", "email", "title", "organization_id") VALUES (2, 'admin@example.com', 'admin',  1);
+INSERT INTO users ("id", "email", "title", "organization_id") VALUES (3, 'root@example.com', 'admin',  1);
+INSERT INTO users ("id", "email", "title", "organization_id") VALUES (4, 'other@example.org', 'developer',  2);
+`
+
+func TestImpersonation(t *testing.T) {
+	auth, err := authz.NewAuthorizer(authz.Policy)
+	if err != nil {
+		t.Fatalf("failed to create authorizer: %v", err)
+	}
+	db := storetest.New(t, storetest.Fixture, impersonationData)
+	handler := NewHTTPHandler(db, auth)
+
+	do := func(method, path, user, impersonate, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("user", user)
+		req.Header.Set("Accept", "application/json")
+		if impersonate != "" {
+			req.Header.Set(impersonateHeader, impersonate)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// steps are executed in order, each one builds on the state left by previous
+	data := []struct {
+		name        string
+		method      string
+		path        string
+		user        string
+		impersonate string
+		body        string
+		status      int
+	}{
+		{"admin impersonates developer", http.MethodGet, "/whoami", "admin@example.com", "test@example.com", "", http.StatusOK},
+		{"impersonated user submits expense", http.MethodPut, "/expenses/submit", "admin@example.com", "test@example.com", `{"Amount": 100, "Description": "support"}`, http.StatusTemporaryRedirect},
+		{"impersonated user does not read audit", http.MethodGet, "/admin/impersonations", "admin@example.com", "test@example.com", "", http.StatusForbidden},
+		{"impersonated user does not log in", http.MethodPost, "/auth/login", "admin@example.com", "test@example.com", "", http.StatusForbidden},
+		{"impersonated user does not log out", http.MethodPost, "/auth/logout", "admin@example.com", "test@example.com", "", http.StatusForbidden},
+		{"impersonated user does not log out everywhere", http.MethodPost, "/auth/logout-everywhere", "admin@example.com", "test@example.com", "", http.StatusForbidden},
+		{"developer does not impersonate", http.MethodGet, "/whoami", "test@example.com", "admin@example.com", "", http.StatusForbidden},
+		{"guest does not impersonate", http.MethodGet, "/whoami", "", "test@example.com", "", http.StatusUnauthorized},
+		{"admin does not impersonate other admin", http.MethodGet, "/whoami", "admin@example.com", "root@example.com", "", http.StatusForbidden},
+		{"admin does not find user of other organization", http.MethodGet, "/whoami", "admin@example.com", "other@example.org", "", http.StatusNotFound},
+		{"admin does not find unknown user", http.MethodGet, "/whoami", "admin@example.com", "nobody@example.com", "", http.StatusNotFound},
+	}
+	for _, d := range data {
+		rec := do(d.method, d.path, d.user, d.impersonate, d.body)
+		if rec.Code != d.status {
+			t.Fatalf("%s: expected status %d, got %d: %s", d.name, d.status, rec.Code, rec.Body.String())
+		}
+	}
+
+	// session of impersonated user would let admin act as them without audit
+	if rec := do(http.MethodPost, "/auth/login", "admin@example.com", "test@example.com", ""); len(rec.Result().Cookies()) != 0 {
+		t.Fatalf("expected no session cookies for impersonated login, got %v", rec.Result().Cookies())
+	}
+
+	// expense is created by impersonated user
+	expenses, err := db.ListExpenses(store.ExpenseFilter{OrganizationID: 1})
+	if err != nil || len(expenses) != 1 || expenses[0].UserID != 1 {
+		t.Fatalf("expected expense of impersonated user, got %+v, %v", expenses, err)
+	}
+
+	// every impersonated request is audited with both users
+	rec := do(http.MethodGet, "/admin/impersonations", "admin@example.com", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var audit []model.Impersonation
+	if err := json.Unmarshal(rec.Body.Bytes(), &audit); err != nil {
+		t.Fatalf("failed to parse audit: %v", err)
+	}
+	paths := []string{"/whoami", "/expenses/submit", "/admin/impersonations", "/auth/login", "/auth/logout", "/auth/logout-everywhere", "/auth/login"}
+	if len(audit) != len(paths) {
+		t.Fatalf("expected %d audited requests, got %+v", len(paths), audit)
+	}
+	for i, entry := range audit {
+		if entry.RealUserID != 2 || entry.EffectiveUserID != 1 || entry.OrganizationID != 1 || entry.Path != paths[i] {
+			t.Fatalf("unexpected audit entry: %+v", entry)
+		}
+	}
+}
+
+func TestRealUserFromRequest(t *testing.T) {
+	auth, err := authz.NewAuthorizer(authz.Policy)
+	if err != nil {
+		t.Fatalf("failed to create authorizer: %v", err)
+	}
+	db := storetest.New(t, storetest.Fixture, impersonationData)
+
+	var effective, real model.User
+	handler := Authenticate(db, nil, true)(Impersonate(db, auth)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		effective, real = UserFromRequest(r), RealUserFromRequest(r)
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("user", "admin@example.com")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if effective.ID != 2 || real.ID != 2 {
+		t.Fatalf("expected both users to be admin without impersonation, got %+v and %+v", effective, real)
+	}
+
+	req.Header.Set(impersonateHeader, "test@example.com")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if effective.ID != 1 || real.ID != 2 {
+		t.Fatalf("expected admin impersonating developer, got %+v and %+v", effective, real)
+	}
+}
@@ -0,0 +1,208 @@
+package httpapi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+// importRow is parsed row of imported file, err is set for rows that
+// could not be parsed.
+type importRow struct {
+	expense model.Expense
+	err     error
+}
+
+// importExpenses creates expenses from CSV (Content-Type text/csv) or JSON
+// lines (any other content type) body. Every row is validated and
+// authorized as if it was created with PUT /expenses/submit, rows that pass
+// are created in single transaction and response reports outcome of every row.
+func (h *HTTPServer) importExpenses(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 10*1024*1024))
+	if err != nil {
+		http.Error(w, "unable to read provided body", http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+
+	user := UserFromRequest(r)
+	var rows []importRow
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		rows, err = h.parseCSVRows(user, body)
+	} else {
+		rows, err = parseJSONRows(body)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for i := range rows {
+		if rows[i].err == nil {
+			rows[i].expense, _, rows[i].err = h.prepareExpense(user, rows[i].expense)
+		}
+	}
+	h.authorizeImportTotal(user, rows)
+
+	var valid []model.Expense
+	for _, row := range rows {
+		if row.err == nil {
+			valid = append(valid, row.expense)
+		}
+	}
+	created, err := h.tenant(user).CreateExpenses(valid)
+	if err != nil {
+		http.Error(w, "failed saving expenses", http.StatusInternalServerError)
+		return
+	}
+
+	report := model.ImportReport{Rows: make([]model.ImportRow, 0, len(rows))}
+	for i, row := range rows {
+		result := model.ImportRow{Row: i + 1}
+		if row.err != nil {
+			result.Error = row.err.Error()
+			report.Failed++
+		} else {
+			result.Expense = &created[report.Imported]
+			report.Imported++
+		}
+		report.Rows = append(report.Rows, result)
+	}
+
+	payload, err := json.Marshal(report)
+	if err != nil {
+		http.Error(w, "failed to marshal json", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(payload)
+}
+
+// authorizeImportTotal checks submitted rows together, like single expense
+// of their total, so limits (e.g. monthly spending) can not be avoided by
+// importing many expenses at once. If it is not allowed, all submitted
+// rows fail.
+func (h *HTTPServer) authorizeImportTotal(user model.User, rows []importRow) {
+	total := model.Expense{
+		UserID:         user.ID,
+		OrganizationID: user.OrganizationID,
+		Description:    "import",
+		Status:         model.StatusSubmitted,
+	}
+	submitted := 0
+	for _, row := range rows {
+		if row.err == nil && row.expense.Status == model.StatusSubmitted {
+			total.Amount += row.expense.Amount
+			submitted++
+		}
+	}
+	if submitted < 2 || h.auth.Authorize(user, model.ActionSubmit, total) {
+		return
+	}
+
+	err := fmt.Errorf("submitted rows together: %s", h.denial(user, model.ActionSubmit, total))
+	for i := range rows {
+		if rows[i].err == nil && rows[i].expense.Status == model.StatusSubmitted {
+			rows[i].err = err
+		}
+	}
+}
+
+// parseJSONRows parses expenses in JSON lines format, each non empty line
+// has the same format as body of PUT /expenses/submit.
+func parseJSONRows(body []byte) ([]importRow, error) {
+	var rows []importRow
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var row importRow
+		if err := json.Unmarshal(line, &row.expense); err != nil {
+			row.err = errors.New("failed to parse JSON")
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+// parseCSVRows parses expenses from CSV with header. Columns are amount
+// (required), description, status and category (ID or name).
+func (h *HTTPServer) parseCSVRows(user model.User, body []byte) ([]importRow, error) {
+	reader := csv.NewReader(bytes.NewReader(body))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSV header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "amount", "description", "status", "category":
+			columns[name] = i
+		default:
+			return nil, fmt.Errorf("unknown CSV column %q", name)
+		}
+	}
+	if _, ok := columns["amount"]; !ok {
+		return nil, errors.New("CSV column amount is required")
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CSV: %w", err)
+		}
+		rows = append(rows, h.csvRow(user, columns, record))
+	}
+}
+
+func (h *HTTPServer) csvRow(user model.User, columns map[string]int, record []string) importRow {
+	field := func(name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var row importRow
+	amount, err := strconv.Atoi(field("amount"))
+	if err != nil {
+		row.err = fmt.Errorf("invalid amount %q", field("amount"))
+		return row
+	}
+	row.expense.Amount = amount
+	row.expense.Description = field("description")
+	row.expense.Status = model.ExpenseStatus(field("status"))
+	if ref := field("category"); ref != "" {
+		category, err := h.resolveCategory(user, ref)
+		if err != nil {
+			row.err = err
+			return row
+		}
+		row.expense.CategoryID = category.ID
+	}
+	return row
+}
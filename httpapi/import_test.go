@@ -0,0 +1,120 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/model"
+	"github.com/delicb/oso-go-tutorial/store"
+	"github.com/delicb/oso-go-tutorial/store/storetest"
+)
+
+func TestImportExpenses(t *testing.T) {
+	db := storetest.New(t, storetest.Fixture)
+	auth, err := authz.NewAuthorizer(authz.Policy, authz.WithSpending(db))
+	if err != nil {
+		t.Fatalf("failed to create authorizer: %v", err)
+	}
+	handler := NewHTTPHandler(db, auth)
+
+	// steps are executed in order, on the same database
+	data := []struct {
+		name        string
+		user        string
+		contentType string
+		body        string
+		status      int
+		// expected errors of rows, empty for imported rows
+		errors []string
+	}{
+		{"guest can not import", "", "text/csv", "amount\n100\n", http.StatusUnauthorized, nil},
+		{"unknown column", "test@example.com", "text/csv", "amount,planet\n100,mars\n", http.StatusBadRequest, nil},
+		{"missing amount column", "test@example.com", "text/csv", "description\nlunch\n", http.StatusBadRequest, nil},
+		{"csv", "test@example.com", "text/csv",
+			"amount,description,status,category\n" +
+				"100,lunch,,meals\n" +
+				"abc,broken\n" +
+				"900,laptop,,equipment\n" +
+				"50,taxi,draft\n" +
+				"10,boat,,yachts\n" +
+				"10,refund,approved,travel\n",
+			http.StatusOK, []string{
+				"",
+				`invalid amount "abc"`,
+				"forbidden: only admins can submit equipment over 500",
+				"",
+				`unknown category "yachts"`,
+				"expense can only be created as draft or submitted",
+			}},
+		{"json lines", "test@example.com", "application/x-ndjson",
+			`{"Amount": 200, "Description": "hotel", "CategoryID": 1}` + "\n\n" +
+				`{"Amount": 20, "UserID": 2}` + "\n" +
+				`not json` + "\n",
+			http.StatusOK, []string{
+				"",
+				"setting user ID for expense not allowed",
+				"failed to parse JSON",
+			}},
+		{"rows over limit together", "test@example.com", "application/x-ndjson",
+			`{"Amount": 3000}` + "\n" + `{"Amount": 3000}` + "\n" + `{"Amount": 3000, "Status": "draft"}` + "\n",
+			http.StatusOK, []string{
+				"submitted rows together: forbidden: engineers may not submit more than 5000 per month",
+				"submitted rows together: forbidden: engineers may not submit more than 5000 per month",
+				"",
+			}},
+		{"empty", "test@example.com", "text/csv", "", http.StatusOK, []string{}},
+	}
+
+	for _, d := range data {
+		req := httptest.NewRequest(http.MethodPost, "/expenses/import", strings.NewReader(d.body))
+		req.Header.Set("user", d.user)
+		req.Header.Set("Content-Type", d.contentType)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != d.status {
+			t.Fatalf("%s: expected status %d, got %d: %s", d.name, d.status, rec.Code, rec.Body.String())
+		}
+		if d.errors == nil {
+			continue
+		}
+
+		var report model.ImportReport
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatalf("%s: failed to parse response: %v", d.name, err)
+		}
+		if len(report.Rows) != len(d.errors) {
+			t.Fatalf("%s: unexpected rows: %+v", d.name, report.Rows)
+		}
+		imported := 0
+		for i, row := range report.Rows {
+			if row.Row != i+1 || row.Error != d.errors[i] {
+				t.Fatalf("%s: unexpected row %d: %+v", d.name, i+1, row)
+			}
+			if row.Error == "" {
+				imported++
+				if row.Expense == nil || row.Expense.ID == 0 || row.Expense.UserID != 1 {
+					t.Fatalf("%s: row %d has no created expense: %+v", d.name, i+1, row)
+				}
+			}
+		}
+		if report.Imported != imported || report.Failed != len(d.errors)-imported {
+			t.Fatalf("%s: unexpected counts: %+v", d.name, report)
+		}
+	}
+
+	expenses, err := db.ListExpenses(store.ExpenseFilter{})
+	if err != nil {
+		t.Fatalf("failed to list expenses: %v", err)
+	}
+	var amounts []int
+	for _, e := range expenses {
+		amounts = append(amounts, e.Amount)
+	}
+	if len(amounts) != 4 || amounts[0] != 100 || amounts[1] != 50 || amounts[2] != 200 || amounts[3] != 3000 {
+		t.Fatalf("unexpected stored expenses: %v", amounts)
+	}
+}
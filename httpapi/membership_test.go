@@ -0,0 +1,81 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/model"
+	"github.com/delicb/oso-go-tutorial/store/storetest"
+)
+
+// consultant is developer in organization 1 and accountant of client
+// (organization 2)
+const membershipData = `
+INSERT INTO organizations ("id", "name") VALUES (2, 'Client'), (3, 'Other Client');
+INSERT INTO users ("id", "email", "title", "organization_id") VALUES (2, 'consultant@example.com', 'developer',  1);
+INSERT INTO users ("id", "email", "title", "organization_id") VALUES (3, 'dev@client.example.com', 'developer',  2);
+INSERT INTO memberships ("user_id", "organization_id", "title") VALUES (2, 2, 'accountant');
+INSERT INTO expenses ("id", "user_id", "amount", "description", "organization_id", "status") VALUES (7, 3, 100, 'lunch', 2, 'submitted');
+`
+
+func TestActiveOrganization(t *testing.T) {
+	auth, err := authz.NewAuthorizer(authz.Policy)
+	if err != nil {
+		t.Fatalf("failed to create authorizer: %v", err)
+	}
+	handler := NewHTTPHandler(storetest.New(t, storetest.Fixture, membershipData), auth)
+
+	// steps are executed in order, each one builds on the state left by previous
+	data := []struct {
+		name         string
+		user         string
+		organization string
+		method       string
+		path         string
+		status       int
+	}{
+		{"home organization is active by default", "consultant@example.com", "", http.MethodGet, "/expenses/7", http.StatusNotFound},
+		{"organization selected with header", "consultant@example.com", "2", http.MethodGet, "/expenses/7", http.StatusOK},
+		{"organization selected with path prefix", "consultant@example.com", "", http.MethodGet, "/orgs/2/expenses/7", http.StatusOK},
+		{"prefix takes precedence over header", "consultant@example.com", "1", http.MethodGet, "/orgs/2/expenses/7", http.StatusOK},
+		{"title of active organization is used", "consultant@example.com", "", http.MethodPost, "/orgs/2/expenses/7/approve", http.StatusOK},
+		{"home organization is readable", "consultant@example.com", "", http.MethodGet, "/orgs/1/organizations/1", http.StatusOK},
+		{"other organizations are not readable", "consultant@example.com", "", http.MethodGet, "/orgs/2/organizations/1", http.StatusNotFound},
+		{"non-member does not find organization", "test@example.com", "2", http.MethodGet, "/expenses", http.StatusNotFound},
+		{"unknown organization is not found", "consultant@example.com", "", http.MethodGet, "/orgs/3/expenses", http.StatusNotFound},
+		{"invalid organization in path", "consultant@example.com", "", http.MethodGet, "/orgs/client/expenses", http.StatusBadRequest},
+		{"invalid organization in header", "consultant@example.com", "client", http.MethodGet, "/expenses", http.StatusBadRequest},
+		{"guest is not affected by selection", "", "2", http.MethodGet, "/", http.StatusOK},
+	}
+
+	for _, d := range data {
+		req := httptest.NewRequest(d.method, d.path, nil)
+		req.Header.Set("user", d.user)
+		if d.organization != "" {
+			req.Header.Set("X-Organization", d.organization)
+		}
+		// changes are made to whatever version is current
+		req.Header.Set("If-Match", "*")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != d.status {
+			t.Fatalf("%s: expected status %d, got %d: %s", d.name, d.status, rec.Code, rec.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/orgs/2/whoami", nil)
+	req.Header.Set("user", "consultant@example.com")
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var user model.User
+	if err := json.Unmarshal(rec.Body.Bytes(), &user); err != nil {
+		t.Fatalf("failed to parse user: %v", err)
+	}
+	if user.OrganizationID != 2 || user.Title != "accountant" || len(user.Memberships) != 2 {
+		t.Fatalf("unexpected user acting in client organization: %+v", user)
+	}
+}
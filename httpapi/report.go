@@ -0,0 +1,227 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/delicb/oso-go-tutorial/model"
+	"github.com/delicb/oso-go-tutorial/store"
+)
+
+// expenseReportPayload is expense report with expenses that are part of it.
+type expenseReportPayload struct {
+	model.ExpenseReport
+	Expenses []model.Expense
+}
+
+// createExpenseReport creates empty draft report of current user.
+func (h *HTTPServer) createExpenseReport(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 64*1024))
+	if err != nil {
+		http.Error(w, "unable to read provided body", http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+
+	var report model.ExpenseReport
+	if err := json.Unmarshal(body, &report); err != nil {
+		http.Error(w, "failed to parse JSON", http.StatusBadRequest)
+		return
+	}
+	if report.Title == "" {
+		http.Error(w, "report title is required", http.StatusBadRequest)
+		return
+	}
+
+	// reports always start empty, as drafts of current user
+	user := UserFromRequest(r)
+	report.UserID = user.ID
+	report.OrganizationID = user.OrganizationID
+	report.Status = model.StatusDraft
+	report.Total = 0
+
+	created, err := h.tenant(user).CreateExpenseReport(report)
+	if err != nil {
+		http.Error(w, "failed saving report", http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(created)
+	if err != nil {
+		http.Error(w, "failed to marshal json", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write(payload)
+}
+
+// getExpenseReport responds with report and all expenses in it.
+func (h *HTTPServer) getExpenseReport(w http.ResponseWriter, r *http.Request) {
+	report, ok := h.expenseReportFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if allowed := h.auth.Authorize(UserFromRequest(r), "read", report); !allowed {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	h.writeExpenseReport(w, r, report)
+}
+
+// addExpenseToReport makes draft expense of report owner part of the report.
+func (h *HTTPServer) addExpenseToReport(w http.ResponseWriter, r *http.Request) {
+	report, ok := h.expenseReportFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	user := UserFromRequest(r)
+	if allowed := h.auth.Authorize(user, "update", report); !allowed {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if report.Status != model.StatusDraft {
+		http.Error(w, "expenses can only be added to draft reports", http.StatusConflict)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 64*1024))
+	if err != nil {
+		http.Error(w, "unable to read provided body", http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+
+	var in struct {
+		ExpenseID int
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		http.Error(w, "failed to parse JSON", http.StatusBadRequest)
+		return
+	}
+
+	expense, err := h.tenant(user).ExpenseByID(in.ExpenseID)
+	if err != nil || expense.UserID != report.UserID {
+		http.Error(w, fmt.Sprintf("unknown expense %d", in.ExpenseID), http.StatusBadRequest)
+		return
+	}
+	if expense.Status != model.StatusDraft || expense.ReportID != 0 {
+		http.Error(w, "only draft expenses outside of reports can be added", http.StatusConflict)
+		return
+	}
+	if err := h.tenant(user).AddExpenseToReport(report.ID, expense.ID, user.ID); err != nil {
+		// expense changed since it was loaded
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	updated, err := h.tenant(user).ExpenseReportByID(report.ID)
+	if err != nil {
+		http.Error(w, "failed to fetch report", http.StatusInternalServerError)
+		return
+	}
+	h.writeExpenseReport(w, r, updated)
+}
+
+// transitionExpenseReport performs approval workflow action from URL on a
+// report and all expenses in it. Action has to be allowed on the report as
+// a whole and on every expense in it.
+func (h *HTTPServer) transitionExpenseReport(w http.ResponseWriter, r *http.Request) {
+	action := chi.URLParam(r, "action")
+	if !model.IsWorkflowAction(action) {
+		http.Error(w, "unknown action", http.StatusNotFound)
+		return
+	}
+	report, ok := h.expenseReportFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	user := UserFromRequest(r)
+	if allowed := h.auth.Authorize(user, action, report); !allowed {
+		h.forbidden(w, user, action, report)
+		return
+	}
+
+	expenses, err := h.tenant(user).ListExpenses(store.ExpenseFilter{ReportID: report.ID})
+	if err != nil {
+		http.Error(w, "failed to fetch expenses", http.StatusInternalServerError)
+		return
+	}
+	for _, expense := range expenses {
+		if allowed := h.auth.Authorize(user, action, expense); !allowed {
+			h.forbidden(w, user, action, expense)
+			return
+		}
+	}
+
+	to, err := report.Transition(action)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if action == model.ActionSubmit && len(expenses) == 0 {
+		http.Error(w, "can not submit empty report", http.StatusConflict)
+		return
+	}
+	updated, err := h.tenant(user).TransitionExpenseReport(report.ID, model.ExpenseEvent{
+		UserID: user.ID,
+		Action: action,
+		From:   report.Status,
+		To:     to,
+	})
+	if errors.Is(err, model.ErrInvalidTransition) {
+		// report or its expenses changed since they were loaded
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed saving report", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeExpenseReport(w, r, updated)
+}
+
+// writeExpenseReport responds with report and expenses in it.
+func (h *HTTPServer) writeExpenseReport(w http.ResponseWriter, r *http.Request, report model.ExpenseReport) {
+	expenses, err := h.tenant(UserFromRequest(r)).ListExpenses(store.ExpenseFilter{ReportID: report.ID})
+	if err != nil {
+		http.Error(w, "failed to fetch expenses", http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(expenseReportPayload{ExpenseReport: report, Expenses: expenses})
+	if err != nil {
+		http.Error(w, "failed to marshal json", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(payload)
+}
+
+// expenseReportFromURL loads report referenced by id URL parameter.
+// If it fails, error is written to response and false returned.
+func (h *HTTPServer) expenseReportFromURL(w http.ResponseWriter, r *http.Request) (model.ExpenseReport, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid report ID", http.StatusBadRequest)
+		return model.ExpenseReport{}, false
+	}
+
+	report, err := h.tenant(UserFromRequest(r)).ExpenseReportByID(id)
+	if err != nil {
+		http.Error(w, "unable to find report", http.StatusNotFound)
+		return model.ExpenseReport{}, false
+	}
+	return report, true
+}
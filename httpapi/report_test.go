@@ -0,0 +1,98 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/model"
+	"github.com/delicb/oso-go-tutorial/store/storetest"
+)
+
+const reportData = `
+INSERT INTO users ("id", "email", "title", "organization_id") VALUES (3, 'manager@example.com', 'manager',  1);
+INSERT INTO users ("id", "email", "title", "organization_id") VALUES (4, 'colleague@example.com', 'developer',  1);
+UPDATE users SET manager_id = 3 WHERE id = 1;
+INSERT INTO expenses ("id", "user_id", "amount", "description", "organization_id", "status") VALUES (10, 1, 100, 'hotel', 1, 'draft');
+INSERT INTO expenses ("id", "user_id", "amount", "description", "organization_id", "status") VALUES (11, 1, 200, 'flight', 1, 'draft');
+INSERT INTO expenses ("id", "user_id", "amount", "description", "organization_id", "status") VALUES (12, 4, 50, 'taxi', 1, 'draft');
+INSERT INTO expenses ("id", "user_id", "amount", "description", "organization_id", "status") VALUES (13, 1, 20, 'lunch', 1, 'submitted');
+`
+
+func TestExpenseReports(t *testing.T) {
+	db := storetest.New(t, storetest.Fixture, reportData)
+	auth, err := authz.NewAuthorizer(authz.Policy, authz.WithHierarchy(db), authz.WithReports(db))
+	if err != nil {
+		t.Fatalf("failed to create authorizer: %v", err)
+	}
+	handler := NewHTTPHandler(db, auth)
+
+	// steps are executed in order, on the same report
+	data := []struct {
+		name   string
+		user   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"guest can not create report", "", http.MethodPost, "/expense-reports", `{"Title": "trip"}`, http.StatusUnauthorized},
+		{"report without title", "test@example.com", http.MethodPost, "/expense-reports", `{}`, http.StatusBadRequest},
+		{"create report", "test@example.com", http.MethodPost, "/expense-reports", `{"Title": "trip"}`, http.StatusCreated},
+		{"colleague can not add expenses", "colleague@example.com", http.MethodPost, "/expense-reports/1/expenses", `{"ExpenseID": 12}`, http.StatusForbidden},
+		{"add expense of other user", "test@example.com", http.MethodPost, "/expense-reports/1/expenses", `{"ExpenseID": 12}`, http.StatusBadRequest},
+		{"add submitted expense", "test@example.com", http.MethodPost, "/expense-reports/1/expenses", `{"ExpenseID": 13}`, http.StatusConflict},
+		{"add expense", "test@example.com", http.MethodPost, "/expense-reports/1/expenses", `{"ExpenseID": 10}`, http.StatusOK},
+		{"add another expense", "test@example.com", http.MethodPost, "/expense-reports/1/expenses", `{"ExpenseID": 11}`, http.StatusOK},
+		{"add expense twice", "test@example.com", http.MethodPost, "/expense-reports/1/expenses", `{"ExpenseID": 10}`, http.StatusConflict},
+		{"colleague can not read report", "colleague@example.com", http.MethodGet, "/expense-reports/1", "", http.StatusForbidden},
+		{"expense in report is not submitted alone", "test@example.com", http.MethodPost, "/expenses/10/submit", "", http.StatusConflict},
+		{"approve draft report", "manager@example.com", http.MethodPost, "/expense-reports/1/approve", "", http.StatusConflict},
+		{"submit report", "test@example.com", http.MethodPost, "/expense-reports/1/submit", "", http.StatusOK},
+		{"add expense to submitted report", "test@example.com", http.MethodPost, "/expense-reports/1/expenses", `{"ExpenseID": 12}`, http.StatusConflict},
+		{"manager reads expense in report", "manager@example.com", http.MethodGet, "/expenses/10", "", http.StatusOK},
+		{"expense in report is not approved alone", "manager@example.com", http.MethodPost, "/expenses/10/approve", "", http.StatusConflict},
+		{"colleague can not approve report", "colleague@example.com", http.MethodPost, "/expense-reports/1/approve", "", http.StatusForbidden},
+		{"owner can not approve report", "test@example.com", http.MethodPost, "/expense-reports/1/approve", "", http.StatusForbidden},
+		{"manager approves report", "manager@example.com", http.MethodPost, "/expense-reports/1/approve", "", http.StatusOK},
+		{"unknown action", "manager@example.com", http.MethodPost, "/expense-reports/1/destroy", "", http.StatusNotFound},
+		{"unknown report", "test@example.com", http.MethodGet, "/expense-reports/42", "", http.StatusNotFound},
+		{"create empty report", "test@example.com", http.MethodPost, "/expense-reports", `{"Title": "empty"}`, http.StatusCreated},
+		{"submit empty report", "test@example.com", http.MethodPost, "/expense-reports/2/submit", "", http.StatusConflict},
+	}
+
+	for _, d := range data {
+		req := httptest.NewRequest(d.method, d.path, strings.NewReader(d.body))
+		req.Header.Set("user", d.user)
+		// changes are made to whatever version is current
+		req.Header.Set("If-Match", "*")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != d.status {
+			t.Fatalf("%s: expected status %d, got %d: %s", d.name, d.status, rec.Code, rec.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/expense-reports/1", nil)
+	req.Header.Set("user", "test@example.com")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("failed to get report: %d: %s", rec.Code, rec.Body.String())
+	}
+	var report expenseReportPayload
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if report.Status != model.StatusApproved || report.Total != 300 || len(report.Expenses) != 2 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	for _, e := range report.Expenses {
+		if e.Status != model.StatusApproved {
+			t.Fatalf("expense was not approved with report: %+v", e)
+		}
+	}
+}
@@ -0,0 +1,580 @@
+// Package httpapi exposes expenses functionality over HTTP.
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/model"
+	"github.com/delicb/oso-go-tutorial/store"
+)
+
+// HTTPServer provides HTTP endpoints functionality
+type HTTPServer struct {
+	// db is not scoped to any organization, handlers use tenant instead.
+	db   store.DBManager
+	auth authz.Authorizer
+	// sso is nil if login with identity provider is not configured.
+	sso *SSO
+	// secureCookies marks cookies to be sent over HTTPS only.
+	secureCookies bool
+}
+
+// Option configures HTTP server.
+type Option func(*HTTPServer)
+
+// WithSecureCookies sets if session and login cookies are sent over HTTPS
+// only, which they are by default. Server behind TLS terminating proxy
+// receives plain HTTP, but browsers still talk HTTPS with it, so only
+// development servers accessed over plain HTTP should disable it.
+func WithSecureCookies(secure bool) Option {
+	return func(h *HTTPServer) {
+		h.secureCookies = secure
+	}
+}
+
+// WithSSO enables login with OpenID Connect identity provider and
+// authentication with ID tokens it issues.
+func WithSSO(sso *SSO) Option {
+	return func(h *HTTPServer) {
+		h.sso = sso
+	}
+}
+
+// tenant returns database scoped to organization of provided (current)
+// actor, so data of other organizations is never reached, even if policy
+// would allow it.
+func (h *HTTPServer) tenant(actor model.Actor) store.DBManager {
+	return store.ForTenant(h.db, actor.TenantID())
+}
+
+// NewHTTPHandler returns handler that serves all HTTP endpoints with
+// authentication and authorization built-in.
+func NewHTTPHandler(db store.DBManager, auth authz.Authorizer, opts ...Option) http.Handler {
+	server := &HTTPServer{
+		db:            db,
+		auth:          auth,
+		secureCookies: true,
+	}
+	for _, opt := range opts {
+		opt(server)
+	}
+
+	mux := chi.NewMux()
+	mux.Use(middleware.Recoverer)
+	mux.Use(middleware.Logger)
+	mux.Use(Authenticate(db, server.sso, server.secureCookies))
+	mux.Use(Impersonate(db, auth))
+	mux.Use(Authorize(auth))
+
+	mux.Put(`/expenses/submit`, server.createExpense)
+	mux.Post(`/expenses/import`, server.importExpenses)
+	mux.Get(`/expenses`, server.listExpenses)
+	mux.Get(`/expenses/export`, server.exportExpenses)
+	mux.Get(`/expenses/{id:[0-9]+}`, server.getExpense)
+	mux.Delete(`/expenses/{id:[0-9]+}`, server.deleteRecord(store.KindExpense))
+	mux.Get(`/expenses/{id:[0-9]+}/history`, server.expenseHistory)
+	mux.Get(`/expenses/{id:[0-9]+}/versions`, server.expenseVersions)
+	mux.Get(`/expenses/{id:[0-9]+}/versions/diff`, server.expenseVersionDiff)
+	mux.Post(`/expenses/{id:[0-9]+}/{action:[a-z]+}`, server.transitionExpense)
+	mux.Post(`/expense-reports`, server.createExpenseReport)
+	mux.Get(`/expense-reports/{id:[0-9]+}`, server.getExpenseReport)
+	mux.Post(`/expense-reports/{id:[0-9]+}/expenses`, server.addExpenseToReport)
+	mux.Post(`/expense-reports/{id:[0-9]+}/{action:[a-z]+}`, server.transitionExpenseReport)
+	mux.Get(`/reports/spending`, server.spendingReport)
+	mux.Get(`/organizations/{id:[0-9]+}`, server.getOrganization)
+	mux.Delete(`/organizations/{id:[0-9]+}`, server.deleteRecord(store.KindOrganization))
+	mux.Delete(`/users/{id:[0-9]+}`, server.deleteRecord(store.KindUser))
+	mux.Get(`/organizations/{id:[0-9]+}/categories`, server.listCategories)
+	mux.Post(`/organizations/{id:[0-9]+}/categories`, server.createCategory)
+	mux.Get(`/organizations/{id:[0-9]+}/api-keys`, server.listAPIKeys)
+	mux.Post(`/organizations/{id:[0-9]+}/api-keys`, server.createAPIKey)
+	mux.Delete(`/organizations/{id:[0-9]+}/api-keys/{key:[0-9]+}`, server.revokeAPIKey)
+	mux.Post(`/delegations`, server.createDelegation)
+	mux.Get(`/admin/deleted/{kind}`, server.listDeleted)
+	mux.Get(`/admin/impersonations`, server.listImpersonations)
+	mux.Post(`/admin/deleted/{kind}/{id:[0-9]+}/restore`, server.restoreRecord)
+	mux.Get(`/whoami`, server.whoami)
+	mux.Get("/", server.hello)
+
+	// sessions belong to user making request, never to impersonated one
+	sessions := mux.With(withoutImpersonation)
+	sessions.Post(`/auth/login`, server.createSession)
+	sessions.Post(`/auth/logout`, server.logout)
+	sessions.Post(`/auth/logout-everywhere`, server.logoutEverywhere)
+	if server.sso != nil {
+		mux.Get(`/auth/login`, server.login)
+		mux.Get(`/auth/callback`, server.callback)
+	}
+
+	// explaining decisions is only possible if authorizer supports tracing
+	if explainer, ok := auth.(authz.Explainer); ok {
+		mux.Post(`/admin/authz/explain`, server.explainHandler(explainer))
+	}
+
+	return mux
+}
+
+func (h *HTTPServer) hello(w http.ResponseWriter, r *http.Request) {
+	user := UserFromRequest(r)
+	if !user.IsAuthenticated() {
+		_, _ = fmt.Fprint(w, "hello guest user")
+	} else {
+		_, _ = fmt.Fprintf(w, "hello %s", user.Email)
+	}
+}
+
+func (h *HTTPServer) whoami(w http.ResponseWriter, r *http.Request) {
+	user := UserFromRequest(r)
+
+	// API clients ask for JSON, humans get a sentence
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		payload, err := json.Marshal(user)
+		if err != nil {
+			http.Error(w, "failed to marshal json", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(payload)
+		return
+	}
+
+	if !user.IsAuthenticated() {
+		_, _ = fmt.Fprint(w, "guest user")
+		return
+	}
+	organization, err := h.tenant(user).OrganizationByID(user.OrganizationID)
+	if err != nil {
+		http.Error(w, "failed to fetch organization", http.StatusInternalServerError)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "You are %s, the %s at %s", user.Email, user.Title, organization.Name)
+}
+
+func (h *HTTPServer) getExpense(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid expense ID", http.StatusBadRequest)
+		return
+	}
+
+	actor := ActorFromRequest(r)
+	expense, err := h.tenant(actor).ExpenseByID(id)
+	if err != nil {
+		http.Error(w, "unable to find expense", http.StatusNotFound)
+		return
+	}
+
+	if allowed := h.auth.Authorize(actor, "read", expense); !allowed {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if notModified(w, r, expense) {
+		return
+	}
+
+	payload, err := json.Marshal(expense)
+	if err != nil {
+		http.Error(w, "failed to marshal json", http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write(payload)
+}
+
+// listExpenses responds with expenses of user's organization that user is
+// allowed to read, optionally filtered by category (ID or name).
+func (h *HTTPServer) listExpenses(w http.ResponseWriter, r *http.Request) {
+	actor := ActorFromRequest(r)
+	expenses := []model.Expense{}
+
+	// guests do not belong to any organization, so there is nothing to list
+	if actor.IsAuthenticated() {
+		filter := store.ExpenseFilter{OrganizationID: actor.TenantID()}
+		if ref := r.URL.Query().Get("category"); ref != "" {
+			category, err := h.resolveCategory(actor, ref)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			filter.CategoryID = category.ID
+		}
+
+		all, err := h.tenant(actor).ListExpenses(filter)
+		if err != nil {
+			http.Error(w, "failed to fetch expenses", http.StatusInternalServerError)
+			return
+		}
+		for _, expense := range all {
+			if h.auth.Authorize(actor, "read", expense) {
+				expenses = append(expenses, expense)
+			}
+		}
+	}
+
+	payload, err := json.Marshal(expenses)
+	if err != nil {
+		http.Error(w, "failed to marshal json", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(payload)
+}
+
+func (h *HTTPServer) createExpense(w http.ResponseWriter, r *http.Request) {
+	// read body and parse json into a struct
+	bodyReader := io.LimitReader(r.Body, 1024*1024)
+	body, err := io.ReadAll(bodyReader)
+	if err != nil {
+		http.Error(w, "unable to read provided body", http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+
+	var expense model.Expense
+	if err := json.Unmarshal(body, &expense); err != nil {
+		http.Error(w, "failed to parse JSON", http.StatusBadRequest)
+		log.Println("json parse error", err)
+		return
+	}
+
+	user := UserFromRequest(r)
+	expense, status, err := h.prepareExpense(user, expense)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	if ex, err := h.tenant(user).CreateExpense(expense); err != nil {
+		http.Error(w, "failed saving expense", http.StatusInternalServerError)
+		return
+	} else {
+		// redirect to expense that was just created
+		http.Redirect(w, r, fmt.Sprintf("/expenses/%d", ex.ID), http.StatusTemporaryRedirect)
+		return
+	}
+}
+
+// prepareExpense validates expense user creates and fills in fields server
+// is responsible for. If expense can not be created, HTTP status and error
+// to respond with are returned.
+func (h *HTTPServer) prepareExpense(user model.User, expense model.Expense) (model.Expense, int, error) {
+	// verify if userID is provided in payload, since it should not be, we want to
+	// set current user ID
+	if expense.UserID != 0 {
+		return model.Expense{}, http.StatusBadRequest, errors.New("setting user ID for expense not allowed")
+	}
+	expense.UserID = user.ID
+	expense.OrganizationID = user.OrganizationID
+
+	// expense can be saved as draft and submitted later, other statuses
+	// are only reachable through workflow actions
+	switch expense.Status {
+	case "":
+		expense.Status = model.StatusSubmitted
+	case model.StatusDraft, model.StatusSubmitted:
+	default:
+		return model.Expense{}, http.StatusBadRequest, errors.New("expense can only be created as draft or submitted")
+	}
+
+	// category name is never taken from client, policy relies on it
+	expense.Category = ""
+	if expense.CategoryID != 0 {
+		category, err := h.resolveCategory(user, strconv.Itoa(expense.CategoryID))
+		if err != nil {
+			return model.Expense{}, http.StatusBadRequest, err
+		}
+		expense.Category = category.Name
+	}
+
+	// submitting is subject to policy, e.g. spending limits
+	if expense.Status == model.StatusSubmitted {
+		if allowed := h.auth.Authorize(user, model.ActionSubmit, expense); !allowed {
+			return model.Expense{}, http.StatusForbidden, errors.New(h.denial(user, model.ActionSubmit, expense))
+		}
+	}
+	return expense, 0, nil
+}
+
+func (h *HTTPServer) getOrganization(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid organization ID", http.StatusBadRequest)
+		return
+	}
+
+	actor := ActorFromRequest(r)
+	organization, err := h.tenant(actor).OrganizationByID(id)
+	if err != nil {
+		http.Error(w, "unable to find organization", http.StatusNotFound)
+		return
+	}
+
+	if allowed := h.auth.Authorize(actor, "read", organization); !allowed {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if notModified(w, r, organization) {
+		return
+	}
+
+	payload, err := json.Marshal(organization)
+	if err != nil {
+		http.Error(w, "failed to marshal json", http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write(payload)
+}
+
+// forbidden responds with 403 Forbidden, including reasons of denial if
+// authorizer can provide them.
+func (h *HTTPServer) forbidden(w http.ResponseWriter, actor, action, resource interface{}) {
+	http.Error(w, h.denial(actor, action, resource), http.StatusForbidden)
+}
+
+// denial returns message describing denied action, with reasons of denial
+// if authorizer can provide them.
+func (h *HTTPServer) denial(actor, action, resource interface{}) string {
+	message := "forbidden"
+	if reasoner, ok := h.auth.(authz.Reasoner); ok {
+		if reasons := reasoner.DenyReasons(actor, action, resource); len(reasons) > 0 {
+			message += ": " + strings.Join(reasons, "; ")
+		}
+	}
+	return message
+}
+
+// middlewares
+
+// unique type to use for context keys for authnz purposes
+type ctxKey string
+
+// context keys for user, service account and session token in context,
+// and for user that made the request when it impersonates other user
+const (
+	userKey           ctxKey = "user"
+	realUserKey       ctxKey = "real user"
+	serviceAccountKey ctxKey = "service account"
+	sessionTokenKey   ctxKey = "session token"
+)
+
+// UserFromRequest returns user that is attached to a context.
+// Note that user instance is always returned, but it might be empty
+// for non-authorized users. User should call IsAuthenticated method on
+// user in order to check if user is authenticated. For impersonated
+// requests, impersonated user is returned (see RealUserFromRequest).
+func UserFromRequest(r *http.Request) model.User {
+	val := r.Context().Value(userKey)
+	if u, ok := val.(model.User); ok {
+		return u
+	}
+	return model.User{}
+}
+
+// ActorFromRequest returns actor request is made by, service account if
+// request was authenticated with API key and user (possibly guest)
+// otherwise.
+func ActorFromRequest(r *http.Request) model.Actor {
+	if sa, ok := r.Context().Value(serviceAccountKey).(model.ServiceAccount); ok {
+		return sa
+	}
+	return UserFromRequest(r)
+}
+
+// Authenticate checks if user provided in "User" header exists
+// and attaches instances of a user to context for next handler
+// in chain to use. Requests with API key (bearer token in Authorization
+// header) are authenticated as service account instead, invalid, revoked
+// and expired keys are rejected with 401 Unauthorized. Session cookie
+// takes precedence over "User" header, and requests changing data with it
+// need CSRF token (see validCSRF). If sso is not nil,
+// ID tokens issued by its identity provider are accepted as bearer tokens
+// too and authenticate user they identify. Users that are members of
+// multiple organizations act in organization request selects (see
+// selectOrganization), or in organization they were created in if request
+// selects none. Session cookies are set as secure if secureCookies is set
+// (see WithSecureCookies).
+func Authenticate(db store.DBManager, sso *SSO, secureCookies bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r, organizationID, err := selectOrganization(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			token, hasToken := bearerToken(r)
+			var userFromDB model.User
+			switch {
+			case hasToken && sso != nil && isIDToken(token):
+				claims, err := sso.provider.Verify(r.Context(), token)
+				if err == nil {
+					userFromDB, err = sso.user(db, claims)
+				}
+				if err != nil {
+					w.Header().Set("WWW-Authenticate", authenticateChallenge+`, error="invalid_token"`)
+					http.Error(w, "invalid ID token", http.StatusUnauthorized)
+					return
+				}
+
+			case hasToken:
+				sa, err := db.ServiceAccountByKey(token)
+				if err != nil || !sa.IsActive(time.Now()) {
+					w.Header().Set("WWW-Authenticate", authenticateChallenge+`, error="invalid_token"`)
+					http.Error(w, "invalid API key", http.StatusUnauthorized)
+					return
+				}
+				// service accounts act only in organization of their key
+				if organizationID != 0 && organizationID != sa.OrganizationID {
+					http.Error(w, "unable to find organization", http.StatusNotFound)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), serviceAccountKey, sa)))
+				return
+
+			default:
+				if session, token, ok := sessionFromRequest(db, w, r, secureCookies); ok {
+					if !validCSRF(r, session) {
+						http.Error(w, "invalid CSRF token", http.StatusForbidden)
+						return
+					}
+					if userFromDB, err = db.UserByID(session.UserID); err == nil {
+						token = rotateSession(db, w, session, token, secureCookies)
+						r = r.WithContext(context.WithValue(r.Context(), sessionTokenKey, token))
+						break
+					}
+				}
+				userFromDB, err = db.UserByEmail(r.Header.Get("user"))
+				if err != nil {
+					// guest
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			if organizationID != 0 {
+				member, ok := userFromDB.InOrganization(organizationID)
+				if !ok {
+					// organizations user is not member of do not exist for them
+					http.Error(w, "unable to find organization", http.StatusNotFound)
+					return
+				}
+				userFromDB = member
+			}
+			ctx := context.WithValue(r.Context(), userKey, userFromDB)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// bearerToken returns API key or ID token request is authenticated with,
+// if any.
+func bearerToken(r *http.Request) (string, bool) {
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || parts[1] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// isIDToken reports if bearer token is ID token (JWT) and not API key,
+// which never contains dots.
+func isIDToken(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// organizationHeader selects organization user acts in, for requests
+// without /orgs/{org} path prefix.
+const organizationHeader = "X-Organization"
+
+// selectOrganization returns ID of organization request selects, zero if
+// none. Organization is selected with /orgs/{org} path prefix, which is
+// removed from returned request, so the rest of the path is routed and
+// authorized as usual, or with organizationHeader. Prefix takes precedence.
+func selectOrganization(r *http.Request) (*http.Request, int, error) {
+	if rest := strings.TrimPrefix(r.URL.Path, "/orgs/"); rest != r.URL.Path {
+		segment, path := rest, "/"
+		if i := strings.Index(rest, "/"); i >= 0 {
+			segment, path = rest[:i], rest[i:]
+		}
+		id, err := strconv.Atoi(segment)
+		if err != nil || id <= 0 {
+			return r, 0, fmt.Errorf("invalid organization %q", segment)
+		}
+
+		u := *r.URL
+		u.Path, u.RawPath = path, ""
+		r = r.WithContext(r.Context())
+		r.URL = &u
+		return r, id, nil
+	}
+
+	header := r.Header.Get(organizationHeader)
+	if header == "" {
+		return r, 0, nil
+	}
+	id, err := strconv.Atoi(header)
+	if err != nil || id <= 0 {
+		return r, 0, fmt.Errorf("invalid organization %q", header)
+	}
+	return r, id, nil
+}
+
+// authenticateChallenge is sent to guests that have to authenticate.
+const authenticateChallenge = `Bearer realm="expenses"`
+
+// Authorize is a middleware for checking if currently logged in user
+// (from context) has a permission to send request to a path. Guests that
+// would be allowed after authenticating get 401 Unauthorized, if authorizer
+// can tell (see authz.AuthenticationAdvisor), everyone else 403 Forbidden.
+func Authorize(auth authz.Authorizer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			actor := ActorFromRequest(r)
+			allowed := auth.Authorize(actor, r.Method, r)
+			if !allowed {
+				if isGuest(actor) && allowedIfAuthenticated(auth, r.Method, r) {
+					unauthenticated(w)
+					return
+				}
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+
+			// allow access
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// unauthenticated responds that request has to be authenticated.
+func unauthenticated(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", authenticateChallenge)
+	http.Error(w, "unauthenticated", http.StatusUnauthorized)
+}
+
+// isGuest reports if actor did not authenticate.
+func isGuest(actor interface{}) bool {
+	user, ok := actor.(model.User)
+	return ok && !user.IsAuthenticated()
+}
+
+// allowedIfAuthenticated reports if authorizer knows that authenticated
+// user would be allowed to perform action on resource.
+func allowedIfAuthenticated(auth authz.Authorizer, action, resource interface{}) bool {
+	advisor, ok := auth.(authz.AuthenticationAdvisor)
+	return ok && advisor.AllowedIfAuthenticated(action, resource)
+}
@@ -0,0 +1,334 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/model"
+	"github.com/delicb/oso-go-tutorial/store"
+)
+
+// mock authorization manager
+type authMock struct {
+	mock bool
+}
+
+func (m *authMock) Authorize(actor, action, resource interface{}) bool {
+	return m.mock
+}
+
+// advisorMock is authMock that knows if authenticating would help.
+type advisorMock struct {
+	authMock
+	ifAuthenticated bool
+}
+
+func (m *advisorMock) AllowedIfAuthenticated(action, resource interface{}) bool {
+	return m.ifAuthenticated
+}
+
+// mock db manager
+type dbMock struct {
+	user         model.User
+	organization model.Organization
+	expense      model.Expense
+	err          error
+}
+
+func (d dbMock) UserByID(i int) (model.User, error) {
+	return d.user, d.err
+}
+
+func (d dbMock) UserByEmail(s string) (model.User, error) {
+	return d.user, d.err
+}
+
+func (d dbMock) OrganizationByID(i int) (model.Organization, error) {
+	return d.organization, d.err
+}
+
+func (d dbMock) ExpenseByID(i int) (model.Expense, error) {
+	return d.expense, d.err
+}
+
+func (d dbMock) CreateExpense(expense model.Expense) (model.Expense, error) {
+	panic("implement me")
+}
+
+func (d dbMock) CreateExpenses(expenses []model.Expense) ([]model.Expense, error) {
+	panic("implement me")
+}
+
+func (d dbMock) TransitionExpense(event model.ExpenseEvent, rowVersion int) (model.Expense, error) {
+	panic("implement me")
+}
+
+func (d dbMock) ExpenseHistory(i int) ([]model.ExpenseEvent, error) {
+	panic("implement me")
+}
+
+func (d dbMock) ExpenseVersions(i int) ([]model.ExpenseVersion, error) {
+	panic("implement me")
+}
+
+func (d dbMock) ReportsTo(userID, managerID int) (bool, error) {
+	panic("implement me")
+}
+
+func (d dbMock) ActiveDelegators(delegateID int, at time.Time) ([]int, error) {
+	panic("implement me")
+}
+
+func (d dbMock) CreateDelegation(delegation model.Delegation) (model.Delegation, error) {
+	panic("implement me")
+}
+
+func (d dbMock) ListExpenses(filter store.ExpenseFilter) ([]model.Expense, error) {
+	panic("implement me")
+}
+
+func (d dbMock) EachExpense(filter store.ExpenseFilter, fn func(model.Expense) error) error {
+	panic("implement me")
+}
+
+func (d dbMock) CategoryByID(i int) (model.Category, error) {
+	panic("implement me")
+}
+
+func (d dbMock) CategoriesByOrganization(i int) ([]model.Category, error) {
+	panic("implement me")
+}
+
+func (d dbMock) CreateCategory(category model.Category) (model.Category, error) {
+	panic("implement me")
+}
+
+func (d dbMock) ExpenseReportByID(i int) (model.ExpenseReport, error) {
+	panic("implement me")
+}
+
+func (d dbMock) CreateExpenseReport(report model.ExpenseReport) (model.ExpenseReport, error) {
+	panic("implement me")
+}
+
+func (d dbMock) AddExpenseToReport(reportID, expenseID, userID int) error {
+	panic("implement me")
+}
+
+func (d dbMock) TransitionExpenseReport(reportID int, event model.ExpenseEvent) (model.ExpenseReport, error) {
+	panic("implement me")
+}
+
+func (d dbMock) SpentInMonth(userID int, month time.Time) (int, error) {
+	panic("implement me")
+}
+
+func (d dbMock) SpendingTotals(query store.SpendingQuery) ([]store.SpendingTotal, error) {
+	panic("implement me")
+}
+
+func (d dbMock) CreateUser(in model.User) (model.User, error) {
+	panic("implement me")
+}
+
+func (d dbMock) Titles(organizationID int) ([]string, error) {
+	panic("implement me")
+}
+
+func (d dbMock) CreateServiceAccount(in model.ServiceAccount) (model.ServiceAccount, string, error) {
+	panic("implement me")
+}
+
+func (d dbMock) ServiceAccountByID(id int) (model.ServiceAccount, error) {
+	panic("implement me")
+}
+
+func (d dbMock) ServiceAccountByKey(key string) (model.ServiceAccount, error) {
+	return model.ServiceAccount{}, d.err
+}
+
+func (d dbMock) ServiceAccounts(organizationID int) ([]model.ServiceAccount, error) {
+	panic("implement me")
+}
+
+func (d dbMock) RevokeServiceAccount(id int) error {
+	panic("implement me")
+}
+
+func (d dbMock) CreateSession(in model.Session) (model.Session, string, error) {
+	panic("implement me")
+}
+
+func (d dbMock) SessionByToken(token string) (model.Session, error) {
+	return model.Session{}, d.err
+}
+
+func (d dbMock) RotateSession(token string) (string, error) {
+	panic("implement me")
+}
+
+func (d dbMock) RevokeSession(token string) error {
+	panic("implement me")
+}
+
+func (d dbMock) RevokeUserSessions(userID int) (int, error) {
+	panic("implement me")
+}
+
+func (d dbMock) RecordImpersonation(in model.Impersonation) (model.Impersonation, error) {
+	panic("implement me")
+}
+
+func (d dbMock) Impersonations(organizationID int) ([]model.Impersonation, error) {
+	panic("implement me")
+}
+
+func (d dbMock) SoftDelete(kind string, id, userID, rowVersion int) error {
+	panic("implement me")
+}
+
+func (d dbMock) Restore(kind string, id, userID int) error {
+	panic("implement me")
+}
+
+func (d dbMock) DeletedRecords(kind string, organizationID int) ([]store.DeletedRecord, error) {
+	panic("implement me")
+}
+
+func (d dbMock) DeletedRecordByID(kind string, id int) (store.DeletedRecord, error) {
+	panic("implement me")
+}
+
+func (d dbMock) PurgeDeleted(before time.Time) (int, error) {
+	panic("implement me")
+}
+
+func TestServer(t *testing.T) {
+	handler := NewHTTPHandler(&dbMock{err: sql.ErrNoRows}, &authMock{true})
+
+	server := httptest.NewServer(handler)
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("failed to get response from server: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d", resp.StatusCode)
+	}
+	content, _ := io.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if !strings.Contains(string(content), "hello guest") {
+		t.Fatalf("got unexpected response from server: %v", string(content))
+	}
+}
+
+func userRecorderHandler(out *model.User) http.Handler {
+	return http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		*out = UserFromRequest(r)
+	})
+}
+
+func TestAuthenticate_HasUser(t *testing.T) {
+	data := []struct {
+		name          string
+		db            store.DBManager
+		expectedEmail string
+	}{
+		{
+			"regular user",
+			dbMock{user: model.User{Email: "test@example.com"}},
+			"test@example.com",
+		},
+		{
+			"db error",
+			dbMock{err: sql.ErrNoRows},
+			"",
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.name, func(t *testing.T) {
+			authenticator := Authenticate(d.db, nil, true)
+			var recordedUser model.User
+			req, _ := http.NewRequest(http.MethodGet, "/", nil)
+			authenticator(userRecorderHandler(&recordedUser)).ServeHTTP(nil, req)
+
+			if recordedUser.Email != d.expectedEmail {
+				t.Fatalf("unexpected email, expected %q, got %q", d.expectedEmail, recordedUser.Email)
+			}
+
+		})
+	}
+}
+
+func statusCodeHandler(statusCode int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(statusCode)
+	})
+}
+
+func TestAuthorize(t *testing.T) {
+	data := []struct {
+		name               string
+		auth               authz.Authorizer
+		user               model.User
+		expectedStatusCode int
+	}{
+		{
+			"allowed",
+			&authMock{true},
+			model.User{},
+			http.StatusOK,
+		},
+		{
+			"not allowed",
+			&authMock{false},
+			model.User{},
+			http.StatusForbidden,
+		},
+		{
+			"guest has to authenticate",
+			&advisorMock{authMock{false}, true},
+			model.User{},
+			http.StatusUnauthorized,
+		},
+		{
+			"guest not allowed even if authenticated",
+			&advisorMock{authMock{false}, false},
+			model.User{},
+			http.StatusForbidden,
+		},
+		{
+			"authenticated user not allowed",
+			&advisorMock{authMock{false}, true},
+			model.User{ID: 1, Email: "test@example.com"},
+			http.StatusForbidden,
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.name, func(t *testing.T) {
+			authorizer := Authorize(d.auth)
+			req, _ := http.NewRequest(http.MethodGet, "/", nil)
+			req = req.WithContext(context.WithValue(req.Context(), userKey, d.user))
+			rec := httptest.NewRecorder()
+			authorizer(statusCodeHandler(http.StatusOK)).ServeHTTP(rec, req)
+
+			if rec.Code != d.expectedStatusCode {
+				t.Fatalf("wront status code, expected %d, got %d", d.expectedStatusCode, rec.Code)
+			}
+			if challenge := rec.Header().Get("WWW-Authenticate"); (challenge != "") != (d.expectedStatusCode == http.StatusUnauthorized) {
+				t.Fatalf("unexpected WWW-Authenticate header %q", challenge)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package httpapi
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/delicb/oso-go-tutorial/model"
+	"github.com/delicb/oso-go-tutorial/store"
+)
+
+const (
+	// sessionCookie holds session token, it is never readable by scripts.
+	sessionCookie = "session"
+	// csrfCookie holds CSRF token of session for frontend to read and send
+	// back in csrfHeader, which other sites can not do.
+	csrfCookie = "csrf_token"
+	csrfHeader = "X-CSRF-Token"
+)
+
+const (
+	// sessionLifetime is how long session lasts after login, regardless of use.
+	sessionLifetime = 12 * time.Hour
+	// sessionRotation is how often session token is replaced while in use,
+	// so stolen tokens stop working soon.
+	sessionRotation = 15 * time.Minute
+)
+
+// sessionFromRequest returns active session request's cookie belongs to and
+// its token. Cookies of unknown, expired and revoked sessions are cleared.
+func sessionFromRequest(db store.DBManager, w http.ResponseWriter, r *http.Request, secureCookies bool) (model.Session, string, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil || cookie.Value == "" {
+		return model.Session{}, "", false
+	}
+	session, err := db.SessionByToken(cookie.Value)
+	if err != nil || !session.IsActive(time.Now()) {
+		clearSessionCookies(w, secureCookies)
+		return model.Session{}, "", false
+	}
+	return session, cookie.Value, true
+}
+
+// validCSRF reports if request authenticated with session may proceed.
+// Methods that change data have to provide session's CSRF token, browsers
+// send cookies with requests other sites make, but not custom headers.
+func validCSRF(r *http.Request, session model.Session) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	token := r.Header.Get(csrfHeader)
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(session.CSRFToken)) == 1
+}
+
+// rotateSession replaces session token if it was not replaced in last
+// sessionRotation and returns token request continues with. Requests sent
+// in parallel still carry replaced token, store accepts it for a while
+// (see store.RotatedTokenGrace) and they do not rotate it again.
+func rotateSession(db store.DBManager, w http.ResponseWriter, session model.Session, token string, secureCookies bool) string {
+	if time.Since(session.RotatedAt) < sessionRotation {
+		return token
+	}
+	rotated, err := db.RotateSession(token)
+	if err != nil {
+		// old token is still valid, rotation is retried on next request
+		log.Println("rotating session failed", err)
+		return token
+	}
+	setSessionCookies(w, rotated, session, secureCookies)
+	return rotated
+}
+
+func setSessionCookies(w http.ResponseWriter, token string, session model.Session, secure bool) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    session.CSRFToken,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func clearSessionCookies(w http.ResponseWriter, secure bool) {
+	for _, name := range []string{sessionCookie, csrfCookie} {
+		http.SetCookie(w, &http.Cookie{Name: name, Path: "/", MaxAge: -1, HttpOnly: name == sessionCookie, Secure: secure})
+	}
+}
+
+// sessionTokenFromRequest returns token of session request is authenticated
+// with, empty if request is not authenticated with session.
+func sessionTokenFromRequest(r *http.Request) string {
+	token, _ := r.Context().Value(sessionTokenKey).(string)
+	return token
+}
+
+// startSession starts new session of user and sets its cookies.
+func (h *HTTPServer) startSession(w http.ResponseWriter, user model.User) (model.Session, error) {
+	session, token, err := h.tenant(user).CreateSession(model.Session{
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(sessionLifetime),
+	})
+	if err != nil {
+		return model.Session{}, err
+	}
+	setSessionCookies(w, token, session, h.secureCookies)
+	return session, nil
+}
+
+// sessionResponse is body of successful login.
+type sessionResponse struct {
+	ExpiresAt time.Time
+	CSRFToken string
+	User      model.User
+}
+
+// createSession starts session of user request is authenticated as, so
+// browsers can use cookie instead. Session request is made with, if any, is
+// ended, new session always gets new token.
+func (h *HTTPServer) createSession(w http.ResponseWriter, r *http.Request) {
+	user := UserFromRequest(r)
+	if token := sessionTokenFromRequest(r); token != "" {
+		if err := h.tenant(user).RevokeSession(token); err != nil {
+			log.Println("ending replaced session failed", err)
+		}
+	}
+
+	session, err := h.startSession(w, user)
+	if err != nil {
+		http.Error(w, "failed to start session", http.StatusInternalServerError)
+		return
+	}
+	payload, err := json.Marshal(sessionResponse{ExpiresAt: session.ExpiresAt, CSRFToken: session.CSRFToken, User: user})
+	if err != nil {
+		http.Error(w, "failed to marshal json", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write(payload)
+}
+
+// logout ends session request is made with.
+func (h *HTTPServer) logout(w http.ResponseWriter, r *http.Request) {
+	token := sessionTokenFromRequest(r)
+	if token == "" {
+		http.Error(w, "not logged in with session", http.StatusBadRequest)
+		return
+	}
+	if err := h.tenant(UserFromRequest(r)).RevokeSession(token); err != nil {
+		http.Error(w, "failed to end session", http.StatusInternalServerError)
+		return
+	}
+	clearSessionCookies(w, h.secureCookies)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// logoutEverywhere ends all sessions of user, e.g. when one of user's
+// devices is lost.
+func (h *HTTPServer) logoutEverywhere(w http.ResponseWriter, r *http.Request) {
+	user := UserFromRequest(r)
+	ended, err := h.tenant(user).RevokeUserSessions(user.ID)
+	if err != nil {
+		http.Error(w, "failed to end sessions", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("ended %d sessions of %s", ended, user.Email)
+	clearSessionCookies(w, h.secureCookies)
+	w.WriteHeader(http.StatusNoContent)
+}
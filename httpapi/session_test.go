@@ -0,0 +1,225 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/model"
+	"github.com/delicb/oso-go-tutorial/store/storetest"
+)
+
+func TestSessions(t *testing.T) {
+	auth, err := authz.NewAuthorizer(authz.Policy)
+	if err != nil {
+		t.Fatalf("failed to create authorizer: %v", err)
+	}
+	db := storetest.New(t, storetest.Fixture)
+	// cookies are secure by default, browsers send them only over HTTPS
+	server := httptest.NewTLSServer(NewHTTPHandler(db, auth))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+
+	// browser keeps cookies and does not follow redirects, so they can be checked
+	browser := func() *http.Client {
+		jar, _ := cookiejar.New(nil)
+		return &http.Client{Transport: server.Client().Transport, Jar: jar, CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+	}
+	do := func(client *http.Client, method, path string, headers map[string]string, body string) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		content, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(content)
+	}
+	whoami := func(client *http.Client) model.User {
+		t.Helper()
+		_, body := do(client, http.MethodGet, "/whoami", map[string]string{"Accept": "application/json"}, "")
+		var user model.User
+		if err := json.Unmarshal([]byte(body), &user); err != nil {
+			t.Fatalf("failed to parse user: %v", err)
+		}
+		return user
+	}
+	login := func(client *http.Client) sessionResponse {
+		t.Helper()
+		status, body := do(client, http.MethodPost, "/auth/login", map[string]string{"user": "test@example.com"}, "")
+		if status != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, status, body)
+		}
+		var session sessionResponse
+		if err := json.Unmarshal([]byte(body), &session); err != nil {
+			t.Fatalf("failed to parse session: %v", err)
+		}
+		return session
+	}
+	sessionToken := func(client *http.Client) string {
+		for _, c := range client.Jar.Cookies(serverURL) {
+			if c.Name == sessionCookie {
+				return c.Value
+			}
+		}
+		return ""
+	}
+
+	if status, _ := do(browser(), http.MethodPost, "/auth/login", nil, ""); status != http.StatusUnauthorized {
+		t.Fatalf("expected guest not to start session, got %d", status)
+	}
+
+	first := browser()
+	session := login(first)
+	if session.CSRFToken == "" || session.User.Email != "test@example.com" {
+		t.Fatalf("unexpected session: %+v", session)
+	}
+	if user := whoami(first); user.Email != "test@example.com" {
+		t.Fatalf("expected session to authenticate user, got %+v", user)
+	}
+
+	// steps are executed in order, each one builds on the state left by previous
+	csrf := map[string]string{csrfHeader: session.CSRFToken}
+	data := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string]string
+		body    string
+		status  int
+	}{
+		{"submitting without CSRF token is rejected", http.MethodPut, "/expenses/submit", nil, `{"Amount": 100}`, http.StatusForbidden},
+		{"submitting with wrong CSRF token is rejected", http.MethodPut, "/expenses/submit", map[string]string{csrfHeader: "wrong"}, `{"Amount": 100}`, http.StatusForbidden},
+		{"submitting with CSRF token", http.MethodPut, "/expenses/submit", csrf, `{"Amount": 100}`, http.StatusTemporaryRedirect},
+		{"reading does not need CSRF token", http.MethodGet, "/expenses", nil, "", http.StatusOK},
+		{"logging out needs CSRF token", http.MethodPost, "/auth/logout", nil, "", http.StatusForbidden},
+	}
+	for _, d := range data {
+		if status, body := do(first, d.method, d.path, d.headers, d.body); status != d.status {
+			t.Fatalf("%s: expected status %d, got %d: %s", d.name, d.status, status, body)
+		}
+	}
+
+	// tokens in use are rotated, old ones stop working after a while
+	before := sessionToken(first)
+	if err := db.RawExec(`UPDATE sessions SET rotated_at = '2001-01-01 00:00:00+00:00'`); err != nil {
+		t.Fatalf("failed to age session: %v", err)
+	}
+	if user := whoami(first); user.Email != "test@example.com" {
+		t.Fatalf("expected rotated session to authenticate user, got %+v", user)
+	}
+	after := sessionToken(first)
+	if after == "" || after == before {
+		t.Fatalf("expected session token to be rotated")
+	}
+	// requests sent in parallel still carry old token
+	parallel := browser()
+	parallel.Jar.SetCookies(serverURL, []*http.Cookie{{Name: sessionCookie, Value: before}})
+	if user := whoami(parallel); user.Email != "test@example.com" {
+		t.Fatalf("expected old session token to work right after rotation, got %+v", user)
+	}
+	if token := sessionToken(parallel); token != before {
+		t.Fatalf("expected old session token not to be rotated again")
+	}
+	if err := db.RawExec(`UPDATE sessions SET rotated_at = '2001-01-01 00:00:00+00:00'`); err != nil {
+		t.Fatalf("failed to age session: %v", err)
+	}
+	stolen := browser()
+	stolen.Jar.SetCookies(serverURL, []*http.Cookie{{Name: sessionCookie, Value: before}})
+	if user := whoami(stolen); user.IsAuthenticated() {
+		t.Fatalf("expected old session token to stop working, got %+v", user)
+	}
+	if user := whoami(first); user.Email != "test@example.com" {
+		t.Fatalf("expected session to continue after rotation, got %+v", user)
+	}
+
+	// logging out ends only current session
+	second := browser()
+	secondSession := login(second)
+	if status, body := do(first, http.MethodPost, "/auth/logout", csrf, ""); status != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusNoContent, status, body)
+	}
+	if user := whoami(first); user.IsAuthenticated() {
+		t.Fatalf("expected user to be logged out, got %+v", user)
+	}
+	if user := whoami(second); !user.IsAuthenticated() {
+		t.Fatalf("expected other session to continue")
+	}
+	if status, _ := do(browser(), http.MethodPost, "/auth/logout", map[string]string{"user": "test@example.com"}, ""); status != http.StatusBadRequest {
+		t.Fatalf("expected status %d for logout without session, got %d", http.StatusBadRequest, status)
+	}
+
+	// logging out everywhere ends all sessions, even from other device
+	third := browser()
+	login(third)
+	if status, body := do(second, http.MethodPost, "/auth/logout-everywhere", map[string]string{csrfHeader: secondSession.CSRFToken}, ""); status != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusNoContent, status, body)
+	}
+	for _, client := range []*http.Client{second, third} {
+		if user := whoami(client); user.IsAuthenticated() {
+			t.Fatalf("expected all sessions to end, got %+v", user)
+		}
+	}
+
+	// expired sessions do not authenticate and their cookies are cleared
+	expired := browser()
+	login(expired)
+	if err := db.RawExec(`UPDATE sessions SET expires_at = '2001-01-01 00:00:00+00:00'`); err != nil {
+		t.Fatalf("failed to expire sessions: %v", err)
+	}
+	if user := whoami(expired); user.IsAuthenticated() {
+		t.Fatalf("expected expired session not to authenticate, got %+v", user)
+	}
+	if token := sessionToken(expired); token != "" {
+		t.Fatalf("expected cookie of expired session to be cleared")
+	}
+}
+
+func TestSessions_SecureCookies(t *testing.T) {
+	auth, err := authz.NewAuthorizer(authz.Policy)
+	if err != nil {
+		t.Fatalf("failed to create authorizer: %v", err)
+	}
+	db := storetest.New(t, storetest.Fixture)
+
+	// server behind TLS terminating proxy receives plain HTTP, cookies have
+	// to be secure anyway
+	data := []struct {
+		name   string
+		opts   []Option
+		secure bool
+	}{
+		{"secure by default", nil, true},
+		{"insecure for plain HTTP", []Option{WithSecureCookies(false)}, false},
+	}
+	for _, d := range data {
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+		req.Header.Set("user", "test@example.com")
+		rr := httptest.NewRecorder()
+		NewHTTPHandler(db, auth, d.opts...).ServeHTTP(rr, req)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("%s: expected status %d, got %d: %s", d.name, http.StatusCreated, rr.Code, rr.Body.String())
+		}
+		cookies := rr.Result().Cookies()
+		if len(cookies) != 2 {
+			t.Fatalf("%s: expected session and CSRF cookies, got %v", d.name, cookies)
+		}
+		for _, c := range cookies {
+			if c.Secure != d.secure {
+				t.Fatalf("%s: expected cookie %s to be secure: %v", d.name, c.Name, d.secure)
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package httpapi
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/delicb/oso-go-tutorial/store"
+)
+
+// dateLayout is format of from and to parameters of spending report.
+const dateLayout = "2006-01-02"
+
+// spendingReport responds with totals of spent money, grouped by user,
+// category or month (group_by parameter) of expenses created between from
+// and to dates (both inclusive). Only expenses user can read are counted.
+// Responds with CSV if client accepts text/csv, with JSON otherwise.
+func (h *HTTPServer) spendingReport(w http.ResponseWriter, r *http.Request) {
+	query := store.SpendingQuery{GroupBy: r.URL.Query().Get("group_by")}
+	if !store.IsGrouping(query.GroupBy) {
+		http.Error(w, "group_by must be one of user, category or month", http.StatusBadRequest)
+		return
+	}
+	var err error
+	if query.From, err = parseDate(r.URL.Query().Get("from")); err != nil {
+		http.Error(w, "invalid from date: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if query.To, err = parseDate(r.URL.Query().Get("to")); err != nil {
+		http.Error(w, "invalid to date: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !query.To.IsZero() {
+		// whole last day is included
+		query.To = query.To.AddDate(0, 0, 1)
+	}
+
+	actor := ActorFromRequest(r)
+	expenses, err := h.tenant(actor).ListExpenses(store.ExpenseFilter{OrganizationID: actor.TenantID()})
+	if err != nil {
+		http.Error(w, "failed to fetch expenses", http.StatusInternalServerError)
+		return
+	}
+	query.ExpenseIDs = []int{}
+	for _, expense := range expenses {
+		if h.auth.Authorize(actor, "read", expense) {
+			query.ExpenseIDs = append(query.ExpenseIDs, expense.ID)
+		}
+	}
+
+	totals, err := h.tenant(actor).SpendingTotals(query)
+	if err != nil {
+		http.Error(w, "failed to aggregate expenses", http.StatusInternalServerError)
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		w.Header().Set("Content-Type", "text/csv")
+		out := csv.NewWriter(w)
+		_ = out.Write([]string{query.GroupBy, "total", "count"})
+		for _, t := range totals {
+			_ = out.Write([]string{t.Key, strconv.Itoa(t.Total), strconv.Itoa(t.Count)})
+		}
+		out.Flush()
+		return
+	}
+
+	payload, err := json.Marshal(totals)
+	if err != nil {
+		http.Error(w, "failed to marshal json", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(payload)
+}
+
+// parseDate parses date in dateLayout as midnight UTC. Empty value is
+// returned as zero time.
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	date, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected format %s", dateLayout)
+	}
+	return date, nil
+}
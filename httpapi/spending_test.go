@@ -0,0 +1,88 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/store/storetest"
+)
+
+const spendingData = `
+INSERT INTO users ("id", "email", "title", "organization_id") VALUES (2, 'accountant@example.com', 'accountant',  1);
+INSERT INTO users ("id", "email", "title", "organization_id") VALUES (3, 'colleague@example.com', 'developer',  1);
+`
+
+func TestSpendingReport(t *testing.T) {
+	auth, err := authz.NewAuthorizer(authz.Policy)
+	if err != nil {
+		t.Fatalf("failed to create authorizer: %v", err)
+	}
+	handler := NewHTTPHandler(storetest.New(t, storetest.Fixture, spendingData), auth)
+
+	// expenses are created through API, so they have creation time in history
+	for _, e := range []struct {
+		user string
+		body string
+	}{
+		{"test@example.com", `{"Amount": 100, "CategoryID": 1}`},
+		{"test@example.com", `{"Amount": 20, "CategoryID": 2}`},
+		{"colleague@example.com", `{"Amount": 300, "CategoryID": 1}`},
+		{"colleague@example.com", `{"Amount": 5, "Status": "draft"}`},
+	} {
+		req := httptest.NewRequest(http.MethodPut, "/expenses/submit", strings.NewReader(e.body))
+		req.Header.Set("user", e.user)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusTemporaryRedirect {
+			t.Fatalf("failed to create expense: %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	today := time.Now().UTC().Format("2006-01-02")
+	month := time.Now().UTC().Format("2006-01")
+
+	data := []struct {
+		name   string
+		user   string
+		query  string
+		accept string
+		status int
+		body   string
+	}{
+		{"guest", "", "group_by=user", "", http.StatusUnauthorized, ""},
+		{"missing grouping", "test@example.com", "", "", http.StatusBadRequest, ""},
+		{"invalid date", "test@example.com", "group_by=user&from=yesterday", "", http.StatusBadRequest, ""},
+		{"own expenses by user", "test@example.com", "group_by=user", "", http.StatusOK,
+			`[{"Key":"test@example.com","Total":120,"Count":2}]`},
+		{"accountant by user", "accountant@example.com", "group_by=user", "", http.StatusOK,
+			`[{"Key":"colleague@example.com","Total":300,"Count":1},{"Key":"test@example.com","Total":120,"Count":2}]`},
+		{"accountant by category", "accountant@example.com", "group_by=category", "", http.StatusOK,
+			`[{"Key":"meals","Total":20,"Count":1},{"Key":"travel","Total":400,"Count":2}]`},
+		{"accountant by month", "accountant@example.com", "group_by=month&from=" + today + "&to=" + today, "", http.StatusOK,
+			`[{"Key":"` + month + `","Total":420,"Count":3}]`},
+		{"period without expenses", "accountant@example.com", "group_by=month&to=2000-01-01", "", http.StatusOK, `[]`},
+		{"csv", "accountant@example.com", "group_by=category", "text/csv", http.StatusOK,
+			"category,total,count\nmeals,20,1\ntravel,400,2\n"},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/reports/spending?"+d.query, nil)
+			req.Header.Set("user", d.user)
+			req.Header.Set("Accept", d.accept)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != d.status {
+				t.Fatalf("expected status %d, got %d: %s", d.status, rec.Code, rec.Body.String())
+			}
+			if d.body != "" && rec.Body.String() != d.body {
+				t.Fatalf("unexpected body, got: %q, expected: %q", rec.Body.String(), d.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package httpapi
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/delicb/oso-go-tutorial/model"
+	"github.com/delicb/oso-go-tutorial/oidc"
+	"github.com/delicb/oso-go-tutorial/store"
+)
+
+// stateCookie binds login to browser it was started in, so authorization
+// codes can not be injected into someone else's login.
+const stateCookie = "oidc_state"
+
+// loginTimeout is how long users have to log in with identity provider.
+const loginTimeout = 10 * time.Minute
+
+// maxPendingLogins limits logins in progress kept in memory, anyone can
+// start a login.
+const maxPendingLogins = 10000
+
+// errTooManyLogins is returned when login can not start, because too many
+// are already in progress.
+var errTooManyLogins = errors.New("too many logins in progress")
+
+// Provisioning configures how users logging in with identity provider for
+// the first time are created.
+type Provisioning struct {
+	// OrganizationID is organization new users are created in.
+	OrganizationID int
+	// GroupTitles maps groups from ID token to titles, first group of
+	// user with a title gives title of new user.
+	GroupTitles map[string]string
+	// DefaultTitle is title of users in no mapped group, "developer" if empty.
+	DefaultTitle string
+}
+
+// SSO logs users in with OpenID Connect identity provider. Users are
+// identified by verified email, users unknown to application are created
+// just in time, as configured by Provisioning.
+type SSO struct {
+	provider     *oidc.Provider
+	provisioning Provisioning
+
+	mu sync.Mutex
+	// pending logins by state, at most maxPending of them
+	pending    map[string]pendingLogin
+	maxPending int
+}
+
+// pendingLogin holds secrets of login started with identity provider.
+type pendingLogin struct {
+	nonce     string
+	verifier  string
+	expiresAt time.Time
+}
+
+// NewSSO returns SSO that logs users in with provided identity provider.
+func NewSSO(provider *oidc.Provider, provisioning Provisioning) *SSO {
+	if provisioning.DefaultTitle == "" {
+		provisioning.DefaultTitle = "developer"
+	}
+	return &SSO{
+		provider:     provider,
+		provisioning: provisioning,
+		pending:      make(map[string]pendingLogin),
+		maxPending:   maxPendingLogins,
+	}
+}
+
+// start records new pending login and returns its state, or
+// errTooManyLogins if too many logins are in progress.
+func (s *SSO) start() (string, pendingLogin, error) {
+	var login pendingLogin
+	state, err := oidc.RandomToken()
+	if err != nil {
+		return "", login, err
+	}
+	if login.nonce, err = oidc.RandomToken(); err != nil {
+		return "", login, err
+	}
+	if login.verifier, err = oidc.RandomToken(); err != nil {
+		return "", login, err
+	}
+	now := time.Now()
+	login.expiresAt = now.Add(loginTimeout)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// abandoned logins are dropped as new ones start
+	for st, l := range s.pending {
+		if now.After(l.expiresAt) {
+			delete(s.pending, st)
+		}
+	}
+	if len(s.pending) >= s.maxPending {
+		return "", pendingLogin{}, errTooManyLogins
+	}
+	s.pending[state] = login
+	return state, login, nil
+}
+
+// finish removes pending login with provided state and returns it, if it
+// has not expired.
+func (s *SSO) finish(state string) (pendingLogin, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	login, ok := s.pending[state]
+	delete(s.pending, state)
+	if !ok || time.Now().After(login.expiresAt) {
+		return pendingLogin{}, false
+	}
+	return login, true
+}
+
+// user returns user provided claims identify, creating it if it does not
+// exist. Titles are mapped from groups only for new users, afterwards
+// they are managed in application.
+func (s *SSO) user(db store.DBManager, claims oidc.Claims) (model.User, error) {
+	// email is only trusted if provider verified it
+	if claims.Email == "" || !claims.EmailVerified {
+		return model.User{}, errors.New("identity provider did not verify email")
+	}
+	if user, err := db.UserByEmail(claims.Email); err == nil {
+		return user, nil
+	}
+
+	title := s.provisioning.DefaultTitle
+	for _, group := range claims.Groups {
+		if t, ok := s.provisioning.GroupTitles[group]; ok {
+			title = t
+			break
+		}
+	}
+	tenant := store.ForTenant(db, s.provisioning.OrganizationID)
+	user, err := tenant.CreateUser(model.User{
+		Email:          claims.Email,
+		Title:          title,
+		OrganizationID: s.provisioning.OrganizationID,
+	})
+	if err != nil {
+		return model.User{}, fmt.Errorf("provisioning user: %w", err)
+	}
+	log.Printf("provisioned user %s (%s) from %s", user.Email, user.Title, claims.Issuer)
+	return user, nil
+}
+
+// login redirects to identity provider, which redirects back to callback.
+func (h *HTTPServer) login(w http.ResponseWriter, r *http.Request) {
+	state, login, err := h.sso.start()
+	if errors.Is(err, errTooManyLogins) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to start login", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookie,
+		Value:    state,
+		Path:     "/auth",
+		MaxAge:   int(loginTimeout.Seconds()),
+		HttpOnly: true,
+		Secure:   h.secureCookies,
+		// cookie has to be sent on redirect back from identity provider
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, h.sso.provider.AuthCodeURL(state, login.nonce, login.verifier), http.StatusFound)
+}
+
+// loginResponse is body of successful callback. ID token authenticates
+// further requests as bearer token until it expires, browsers use session
+// cookie set with response instead.
+type loginResponse struct {
+	IDToken   string
+	ExpiresAt time.Time
+	CSRFToken string
+	User      model.User
+}
+
+// callback finishes login with authorization code identity provider
+// redirected back with.
+func (h *HTTPServer) callback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	http.SetCookie(w, &http.Cookie{Name: stateCookie, Path: "/auth", MaxAge: -1, HttpOnly: true, Secure: h.secureCookies})
+
+	cookie, err := r.Cookie(stateCookie)
+	state := query.Get("state")
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		http.Error(w, "invalid login state", http.StatusBadRequest)
+		return
+	}
+	login, ok := h.sso.finish(state)
+	if !ok {
+		http.Error(w, "login expired or already finished", http.StatusBadRequest)
+		return
+	}
+	if reason := query.Get("error"); reason != "" {
+		http.Error(w, "login failed: "+reason, http.StatusUnauthorized)
+		return
+	}
+
+	rawIDToken, err := h.sso.provider.Exchange(r.Context(), query.Get("code"), login.verifier)
+	if err != nil {
+		log.Println("exchanging authorization code failed", err)
+		http.Error(w, "login failed", http.StatusUnauthorized)
+		return
+	}
+	claims, err := h.sso.provider.Verify(r.Context(), rawIDToken)
+	if err != nil {
+		log.Println("verifying ID token failed", err)
+		http.Error(w, "login failed", http.StatusUnauthorized)
+		return
+	}
+	// nonce ties ID token to this login, so tokens can not be replayed
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(login.nonce)) != 1 {
+		http.Error(w, "login failed", http.StatusUnauthorized)
+		return
+	}
+	user, err := h.sso.user(h.db, claims)
+	if err != nil {
+		log.Println("login of", claims.Email, "failed:", err)
+		http.Error(w, "login failed", http.StatusForbidden)
+		return
+	}
+
+	session, err := h.startSession(w, user)
+	if err != nil {
+		http.Error(w, "failed to start session", http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(loginResponse{
+		IDToken:   rawIDToken,
+		ExpiresAt: claims.ExpiresAt,
+		CSRFToken: session.CSRFToken,
+		User:      user,
+	})
+	if err != nil {
+		http.Error(w, "failed to marshal json", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(payload)
+}
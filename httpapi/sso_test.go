@@ -0,0 +1,212 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/model"
+	"github.com/delicb/oso-go-tutorial/oidc"
+	"github.com/delicb/oso-go-tutorial/oidc/oidctest"
+	"github.com/delicb/oso-go-tutorial/store/storetest"
+)
+
+func TestSSO(t *testing.T) {
+	auth, err := authz.NewAuthorizer(authz.Policy)
+	if err != nil {
+		t.Fatalf("failed to create authorizer: %v", err)
+	}
+	db := storetest.New(t, storetest.Fixture)
+	idp := oidctest.New(t, "expenses")
+
+	// redirect URL has to be known before handler is created
+	var handler http.Handler
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}))
+	defer app.Close()
+	provider, err := oidc.NewProvider(context.Background(), oidc.Config{
+		Issuer:      idp.Issuer(),
+		ClientID:    "expenses",
+		RedirectURL: app.URL + "/auth/callback",
+	})
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+	// application runs on plain HTTP test server
+	handler = NewHTTPHandler(db, auth, WithSecureCookies(false), WithSSO(NewSSO(provider, Provisioning{
+		OrganizationID: 1,
+		GroupTitles:    map[string]string{"finance": "accountant"},
+	})))
+
+	// login follows redirects to identity provider and back in a browser
+	// like client
+	login := func(t *testing.T) (*http.Client, *http.Response) {
+		t.Helper()
+		jar, _ := cookiejar.New(nil)
+		client := &http.Client{Jar: jar}
+		resp, err := client.Get(app.URL + "/auth/login")
+		if err != nil {
+			t.Fatalf("failed to log in: %v", err)
+		}
+		return client, resp
+	}
+	loggedIn := func(t *testing.T) loginResponse {
+		t.Helper()
+		_, resp := login(t)
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+		var body loginResponse
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to parse login response: %v", err)
+		}
+		return body
+	}
+	whoami := func(t *testing.T, token string) (int, model.User) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, app.URL+"/whoami", nil)
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("failed to call whoami: %v", err)
+		}
+		defer resp.Body.Close()
+		var user model.User
+		_ = json.NewDecoder(resp.Body).Decode(&user)
+		return resp.StatusCode, user
+	}
+
+	t.Run("login denied by provider", func(t *testing.T) {
+		_, resp := login(t)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("expected status %d, got %d", http.StatusUnauthorized, resp.StatusCode)
+		}
+	})
+
+	t.Run("new user is provisioned", func(t *testing.T) {
+		idp.SignIn(oidctest.Identity{Subject: "carol-1", Email: "carol@example.com", Groups: []string{"staff", "finance"}})
+		body := loggedIn(t)
+		if body.IDToken == "" || body.User.ID == 0 || body.User.Email != "carol@example.com" ||
+			body.User.Title != "accountant" || body.User.OrganizationID != 1 {
+			t.Fatalf("unexpected login response: %+v", body)
+		}
+
+		// ID token authenticates further requests
+		status, user := whoami(t, body.IDToken)
+		if status != http.StatusOK || user.ID != body.User.ID {
+			t.Fatalf("unexpected whoami response %d: %+v", status, user)
+		}
+		// and user is created once
+		if again := loggedIn(t); again.User.ID != body.User.ID {
+			t.Fatalf("expected same user, got %+v", again.User)
+		}
+	})
+
+	t.Run("existing user keeps title", func(t *testing.T) {
+		idp.SignIn(oidctest.Identity{Subject: "test-1", Email: "test@example.com", Groups: []string{"finance"}})
+		body := loggedIn(t)
+		if body.User.ID != 1 || body.User.Title != "developer" {
+			t.Fatalf("unexpected user: %+v", body.User)
+		}
+	})
+
+	t.Run("login starts session", func(t *testing.T) {
+		client, resp := login(t)
+		resp.Body.Close()
+		req, _ := http.NewRequest(http.MethodGet, app.URL+"/whoami", nil)
+		req.Header.Set("Accept", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("failed to call whoami: %v", err)
+		}
+		defer resp.Body.Close()
+		var user model.User
+		if err := json.NewDecoder(resp.Body).Decode(&user); err != nil || user.Email != "test@example.com" {
+			t.Fatalf("expected session of logged in user, got %+v, %v", user, err)
+		}
+	})
+
+	t.Run("callback is bound to browser and used once", func(t *testing.T) {
+		client, resp := login(t)
+		resp.Body.Close()
+		callback := resp.Request.URL.String()
+
+		// replaying callback in the same browser fails, login is finished
+		replayed, err := client.Get(callback)
+		if err != nil {
+			t.Fatalf("failed to replay callback: %v", err)
+		}
+		replayed.Body.Close()
+		if replayed.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected status %d for replayed callback, got %d", http.StatusBadRequest, replayed.StatusCode)
+		}
+
+		// other browser does not have state cookie
+		injected, err := http.Get(callback)
+		if err != nil {
+			t.Fatalf("failed to call callback: %v", err)
+		}
+		injected.Body.Close()
+		if injected.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected status %d for callback without state, got %d", http.StatusBadRequest, injected.StatusCode)
+		}
+	})
+
+	t.Run("invalid ID tokens are rejected", func(t *testing.T) {
+		unverified := idp.Claims(oidctest.Identity{Subject: "eve-1", Email: "eve@example.com"}, "")
+		unverified["email_verified"] = false
+		expired := idp.Claims(oidctest.Identity{Subject: "test-1", Email: "test@example.com"}, "")
+		expired["exp"] = 1
+		other := oidctest.New(t, "expenses")
+
+		tokens := map[string]string{
+			"unverified email": idp.Sign(unverified),
+			"expired":          idp.Sign(expired),
+			"other provider":   other.Sign(other.Claims(oidctest.Identity{Subject: "test-1", Email: "test@example.com"}, "")),
+		}
+		for name, token := range tokens {
+			if status, _ := whoami(t, token); status != http.StatusUnauthorized {
+				t.Fatalf("%s: expected status %d, got %d", name, http.StatusUnauthorized, status)
+			}
+		}
+		if _, err := db.UserByEmail("eve@example.com"); err == nil {
+			t.Fatalf("expected user with unverified email not to be provisioned")
+		}
+	})
+}
+
+func TestSSO_PendingLimit(t *testing.T) {
+	sso := NewSSO(nil, Provisioning{})
+	sso.maxPending = 2
+
+	first, _, err := sso.start()
+	if err != nil {
+		t.Fatalf("failed to start login: %v", err)
+	}
+	if _, _, err := sso.start(); err != nil {
+		t.Fatalf("failed to start login: %v", err)
+	}
+	if _, _, err := sso.start(); !errors.Is(err, errTooManyLogins) {
+		t.Fatalf("expected too many logins error, got %v", err)
+	}
+
+	// expired logins make room for new ones
+	sso.mu.Lock()
+	login := sso.pending[first]
+	login.expiresAt = time.Now().Add(-time.Second)
+	sso.pending[first] = login
+	sso.mu.Unlock()
+	if _, _, err := sso.start(); err != nil {
+		t.Fatalf("failed to start login after one expired: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/model"
+	"github.com/delicb/oso-go-tutorial/store"
+	"github.com/delicb/oso-go-tutorial/store/storetest"
+)
+
+// brokenPolicy allows everything, as if some rule of real policy was wrong.
+const brokenPolicy = `allow(_actor, _action, _resource);`
+
+const tenantData = `
+INSERT INTO organizations ("id", "name") VALUES (2, 'Other Org');
+INSERT INTO users ("id", "email", "title", "organization_id") VALUES (2, 'other@example.org', 'admin',  2);
+INSERT INTO expenses ("id", "user_id", "amount", "description", "organization_id", "status") VALUES (7, 1, 100, 'flight', 1, 'submitted');
+INSERT INTO expenses ("id", "user_id", "amount", "description", "organization_id", "status") VALUES (8, 2, 20, 'lunch', 2, 'submitted');
+INSERT INTO expense_reports ("id", "user_id", "organization_id", "title", "status") VALUES (1, 1, 1, 'trip', 'draft');
+`
+
+func TestTenantIsolation(t *testing.T) {
+	auth, err := authz.NewAuthorizer(brokenPolicy)
+	if err != nil {
+		t.Fatalf("failed to create authorizer: %v", err)
+	}
+	db := storetest.New(t, storetest.Fixture, tenantData)
+	handler := NewHTTPHandler(db, auth)
+
+	// user of organization 2 tries to reach data of organization 1
+	data := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"read expense", http.MethodGet, "/expenses/7", ""},
+		{"read history", http.MethodGet, "/expenses/7/history", ""},
+		{"read versions", http.MethodGet, "/expenses/7/versions", ""},
+		{"approve expense", http.MethodPost, "/expenses/7/approve", ""},
+		{"delete expense", http.MethodDelete, "/expenses/7", ""},
+		{"read organization", http.MethodGet, "/organizations/1", ""},
+		{"delete organization", http.MethodDelete, "/organizations/1", ""},
+		{"delete user", http.MethodDelete, "/users/1", ""},
+		{"read categories", http.MethodGet, "/organizations/1/categories", ""},
+		{"create category", http.MethodPost, "/organizations/1/categories", `{"Name": "yachts"}`},
+		{"read report", http.MethodGet, "/expense-reports/1", ""},
+		{"add expense to report", http.MethodPost, "/expense-reports/1/expenses", `{"ExpenseID": 8}`},
+		{"submit report", http.MethodPost, "/expense-reports/1/submit", ""},
+		{"restore expense", http.MethodPost, "/admin/deleted/expense/7/restore", ""},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.name, func(t *testing.T) {
+			req := httptest.NewRequest(d.method, d.path, strings.NewReader(d.body))
+			req.Header.Set("user", "other@example.org")
+			req.Header.Set("If-Match", "*")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusNotFound {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusNotFound, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	// lists contain only data of user's organization
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("user", "other@example.org")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", path, rec.Code, rec.Body.String())
+		}
+		return rec
+	}
+	var listed []model.Expense
+	if err := json.Unmarshal(get("/expenses").Body.Bytes(), &listed); err != nil {
+		t.Fatalf("failed to parse expenses: %v", err)
+	}
+	if len(listed) != 1 || listed[0].ID != 8 {
+		t.Fatalf("expected only expense of own organization, got: %v", listed)
+	}
+	decoder := json.NewDecoder(get("/expenses/export?format=jsonl").Body)
+	var exported []int
+	for decoder.More() {
+		var e model.Expense
+		if err := decoder.Decode(&e); err != nil {
+			t.Fatalf("failed to parse export: %v", err)
+		}
+		exported = append(exported, e.ID)
+	}
+	if len(exported) != 1 || exported[0] != 8 {
+		t.Fatalf("expected only expense of own organization in export, got: %v", exported)
+	}
+
+	var totals []store.SpendingTotal
+	if err := json.Unmarshal(get("/reports/spending?group_by=user").Body.Bytes(), &totals); err != nil {
+		t.Fatalf("failed to parse spending report: %v", err)
+	}
+	if len(totals) != 1 || totals[0].Key != "other@example.org" {
+		t.Fatalf("expected only spending of own organization, got: %v", totals)
+	}
+
+	// nothing of organization 1 was changed
+	expense, err := db.ExpenseByID(7)
+	if err != nil || expense.Status != model.StatusSubmitted {
+		t.Fatalf("expense of other organization was changed: %+v, %v", expense, err)
+	}
+}
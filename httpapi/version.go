@@ -0,0 +1,107 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+// expenseVersions responds with all versions of an expense, available to
+// everyone who can read the expense.
+func (h *HTTPServer) expenseVersions(w http.ResponseWriter, r *http.Request) {
+	versions, ok := h.readableExpenseVersions(w, r)
+	if !ok {
+		return
+	}
+
+	payload, err := json.Marshal(versions)
+	if err != nil {
+		http.Error(w, "failed to marshal json", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(payload)
+}
+
+// expenseVersionDiff responds with changes of an expense between versions
+// provided in from and to query parameters. Latest version is compared to
+// the one before it by default.
+func (h *HTTPServer) expenseVersionDiff(w http.ResponseWriter, r *http.Request) {
+	versions, ok := h.readableExpenseVersions(w, r)
+	if !ok {
+		return
+	}
+
+	to, err := versionParam(r, "to", len(versions))
+	if err != nil {
+		http.Error(w, "invalid to version", http.StatusBadRequest)
+		return
+	}
+	from, err := versionParam(r, "from", to-1)
+	if err != nil {
+		http.Error(w, "invalid from version", http.StatusBadRequest)
+		return
+	}
+	if from >= to {
+		http.Error(w, "from version must be older than to version", http.StatusBadRequest)
+		return
+	}
+	// versions are numbered from 1, without gaps
+	if from < 1 || to > len(versions) {
+		http.Error(w, "unable to find version", http.StatusNotFound)
+		return
+	}
+
+	payload, err := json.Marshal(versions[from-1].Diff(versions[to-1]))
+	if err != nil {
+		http.Error(w, "failed to marshal json", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(payload)
+}
+
+// readableExpenseVersions loads versions of expense referenced by id URL
+// parameter, if current user can read the expense. If it fails, error is
+// written to response and false returned.
+func (h *HTTPServer) readableExpenseVersions(w http.ResponseWriter, r *http.Request) ([]model.ExpenseVersion, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid expense ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	user := UserFromRequest(r)
+	db := h.tenant(user)
+	expense, err := db.ExpenseByID(id)
+	if err != nil {
+		http.Error(w, "unable to find expense", http.StatusNotFound)
+		return nil, false
+	}
+
+	if allowed := h.auth.Authorize(user, "read", expense); !allowed {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return nil, false
+	}
+
+	versions, err := db.ExpenseVersions(expense.ID)
+	if err != nil {
+		http.Error(w, "failed to fetch expense versions", http.StatusInternalServerError)
+		return nil, false
+	}
+	return versions, true
+}
+
+// versionParam returns version number from query parameter, or provided
+// default if parameter is not set.
+func versionParam(r *http.Request, name string, def int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	return strconv.Atoi(value)
+}
@@ -0,0 +1,115 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/model"
+	"github.com/delicb/oso-go-tutorial/store/storetest"
+)
+
+const versionData = `
+INSERT INTO users ("id", "email", "title", "organization_id") VALUES (3, 'manager@example.com', 'manager',  1);
+INSERT INTO users ("id", "email", "title", "organization_id") VALUES (4, 'colleague@example.com', 'developer',  1);
+UPDATE users SET manager_id = 3 WHERE id = 1;
+`
+
+func TestExpenseVersions(t *testing.T) {
+	db := storetest.New(t, storetest.Fixture, versionData)
+	auth, err := authz.NewAuthorizer(authz.Policy, authz.WithHierarchy(db))
+	if err != nil {
+		t.Fatalf("failed to create authorizer: %v", err)
+	}
+	handler := NewHTTPHandler(db, auth)
+
+	expense, err := db.CreateExpense(model.Expense{UserID: 1, OrganizationID: 1, Amount: 100, Status: model.StatusDraft})
+	if err != nil {
+		t.Fatalf("failed to create expense: %v", err)
+	}
+	if expense.ID != 1 {
+		t.Fatalf("unexpected expense ID %d", expense.ID)
+	}
+
+	// steps are executed in order, on the same expense
+	data := []struct {
+		name   string
+		user   string
+		path   string
+		status int
+		// changes are expected in diff response, if set
+		changes []model.FieldChange
+	}{
+		{"colleague can not read versions", "colleague@example.com", "/expenses/1/versions", http.StatusForbidden, nil},
+		{"unknown expense", "test@example.com", "/expenses/42/versions", http.StatusNotFound, nil},
+		{"latest change", "test@example.com", "/expenses/1/versions/diff", http.StatusOK, []model.FieldChange{
+			{Field: "Status", From: "submitted", To: "approved"},
+		}},
+		{"changes between versions", "manager@example.com", "/expenses/1/versions/diff?from=1&to=2", http.StatusOK, []model.FieldChange{
+			{Field: "Status", From: "draft", To: "submitted"},
+		}},
+		{"same version", "test@example.com", "/expenses/1/versions/diff?from=2&to=2", http.StatusBadRequest, nil},
+		{"colleague can not diff versions", "colleague@example.com", "/expenses/1/versions/diff", http.StatusForbidden, nil},
+		{"versions in wrong order", "test@example.com", "/expenses/1/versions/diff?from=3&to=1", http.StatusBadRequest, nil},
+		{"invalid version", "test@example.com", "/expenses/1/versions/diff?to=latest", http.StatusBadRequest, nil},
+		{"unknown version", "test@example.com", "/expenses/1/versions/diff?from=1&to=4", http.StatusNotFound, nil},
+	}
+
+	for _, step := range []struct{ user, path string }{
+		{"test@example.com", "/expenses/1/submit"},
+		{"manager@example.com", "/expenses/1/approve"},
+	} {
+		req := httptest.NewRequest(http.MethodPost, step.path, nil)
+		req.Header.Set("user", step.user)
+		// changes are made to whatever version is current
+		req.Header.Set("If-Match", "*")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", step.path, rec.Code, rec.Body.String())
+		}
+	}
+
+	for _, d := range data {
+		req := httptest.NewRequest(http.MethodGet, d.path, nil)
+		req.Header.Set("user", d.user)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != d.status {
+			t.Fatalf("%s: expected status %d, got %d: %s", d.name, d.status, rec.Code, rec.Body.String())
+		}
+		if d.changes == nil {
+			continue
+		}
+		var diff model.VersionDiff
+		if err := json.Unmarshal(rec.Body.Bytes(), &diff); err != nil {
+			t.Fatalf("%s: failed to parse response: %v", d.name, err)
+		}
+		if !reflect.DeepEqual(diff.Changes, d.changes) {
+			t.Fatalf("%s: expected changes %v, got %v", d.name, d.changes, diff.Changes)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/expenses/1/versions", nil)
+	req.Header.Set("user", "test@example.com")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("failed to get versions: %d: %s", rec.Code, rec.Body.String())
+	}
+	var versions []model.ExpenseVersion
+	if err := json.Unmarshal(rec.Body.Bytes(), &versions); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	// every change is recorded with user who made it
+	var users []int
+	for _, v := range versions {
+		users = append(users, v.UserID)
+	}
+	if !reflect.DeepEqual(users, []int{1, 1, 3}) {
+		t.Fatalf("unexpected authors of versions: %+v", versions)
+	}
+}
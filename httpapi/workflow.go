@@ -0,0 +1,124 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/delicb/oso-go-tutorial/model"
+	"github.com/delicb/oso-go-tutorial/store"
+)
+
+// transitionExpense performs approval workflow action from URL (e.g.
+// approve) on an expense and responds with updated expense.
+func (h *HTTPServer) transitionExpense(w http.ResponseWriter, r *http.Request) {
+	action := chi.URLParam(r, "action")
+	if !model.IsWorkflowAction(action) {
+		http.Error(w, "unknown action", http.StatusNotFound)
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid expense ID", http.StatusBadRequest)
+		return
+	}
+
+	user := UserFromRequest(r)
+	db := h.tenant(user)
+	expense, err := db.ExpenseByID(id)
+	if err != nil {
+		http.Error(w, "unable to find expense", http.StatusNotFound)
+		return
+	}
+
+	if allowed := h.auth.Authorize(user, action, expense); !allowed {
+		h.forbidden(w, user, action, expense)
+		return
+	}
+	if preconditionFailed(w, r, expense) {
+		return
+	}
+
+	// expenses in reports move through workflow only together with report
+	if expense.ReportID != 0 {
+		http.Error(w, fmt.Sprintf("expense is part of report %d", expense.ReportID), http.StatusConflict)
+		return
+	}
+
+	to, err := expense.Transition(action)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	updated, err := db.TransitionExpense(model.ExpenseEvent{
+		ExpenseID: expense.ID,
+		UserID:    user.ID,
+		Action:    action,
+		From:      expense.Status,
+		To:        to,
+	}, expense.RowVersion)
+	if errors.Is(err, store.ErrRecordChanged) {
+		// expense changed since it was authorized and its version checked
+		http.Error(w, "record was changed", http.StatusPreconditionFailed)
+		return
+	}
+	if errors.Is(err, model.ErrInvalidTransition) {
+		// expense changed since it was loaded
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed saving expense", http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(updated)
+	if err != nil {
+		http.Error(w, "failed to marshal json", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", updated.ETag())
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(payload)
+}
+
+// expenseHistory responds with status changes of an expense, available to
+// everyone who can read the expense.
+func (h *HTTPServer) expenseHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid expense ID", http.StatusBadRequest)
+		return
+	}
+
+	user := UserFromRequest(r)
+	db := h.tenant(user)
+	expense, err := db.ExpenseByID(id)
+	if err != nil {
+		http.Error(w, "unable to find expense", http.StatusNotFound)
+		return
+	}
+
+	if allowed := h.auth.Authorize(user, "read", expense); !allowed {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	history, err := db.ExpenseHistory(expense.ID)
+	if err != nil {
+		http.Error(w, "failed to fetch expense history", http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(history)
+	if err != nil {
+		http.Error(w, "failed to marshal json", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(payload)
+}
@@ -0,0 +1,175 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/delicb/oso-go-tutorial/authz"
+	"github.com/delicb/oso-go-tutorial/model"
+	"github.com/delicb/oso-go-tutorial/store/storetest"
+)
+
+const workflowData = `
+INSERT INTO users ("id", "email", "title", "organization_id") VALUES (2, 'accountant@example.com', 'accountant',  1);
+INSERT INTO expenses ("id", "user_id", "amount", "description", "organization_id", "status") VALUES (7, 1, 100, 'lunch', 1, 'draft');
+`
+
+func TestExpenseWorkflow(t *testing.T) {
+	auth, err := authz.NewAuthorizer(authz.Policy)
+	if err != nil {
+		t.Fatalf("failed to create authorizer: %v", err)
+	}
+	handler := NewHTTPHandler(storetest.New(t, storetest.Fixture, workflowData), auth)
+
+	// steps are executed in order, on the same expense
+	data := []struct {
+		name   string
+		user   string
+		method string
+		path   string
+		status int
+	}{
+		{"accountant can not submit others draft", "accountant@example.com", http.MethodPost, "/expenses/7/submit", http.StatusForbidden},
+		{"submitter submits draft", "test@example.com", http.MethodPost, "/expenses/7/submit", http.StatusOK},
+		{"submitted expense can not be submitted again", "test@example.com", http.MethodPost, "/expenses/7/submit", http.StatusConflict},
+		{"submitter can not approve", "test@example.com", http.MethodPost, "/expenses/7/approve", http.StatusForbidden},
+		{"submitted expense can not be reimbursed", "accountant@example.com", http.MethodPost, "/expenses/7/reimburse", http.StatusConflict},
+		{"unknown action", "accountant@example.com", http.MethodPost, "/expenses/7/delete", http.StatusForbidden},
+		{"accountant approves", "accountant@example.com", http.MethodPost, "/expenses/7/approve", http.StatusOK},
+		{"approved expense can not be rejected", "accountant@example.com", http.MethodPost, "/expenses/7/reject", http.StatusConflict},
+		{"accountant reimburses", "accountant@example.com", http.MethodPost, "/expenses/7/reimburse", http.StatusOK},
+		{"missing expense", "accountant@example.com", http.MethodPost, "/expenses/99/approve", http.StatusNotFound},
+		{"accountant reads history", "accountant@example.com", http.MethodGet, "/expenses/7/history", http.StatusOK},
+		{"guest does not find history", "", http.MethodGet, "/expenses/7/history", http.StatusNotFound},
+	}
+
+	for _, d := range data {
+		req := httptest.NewRequest(d.method, d.path, nil)
+		req.Header.Set("user", d.user)
+		// changes are made to whatever version is current
+		req.Header.Set("If-Match", "*")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != d.status {
+			t.Fatalf("%s: expected status %d, got %d: %s", d.name, d.status, rec.Code, rec.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/expenses/7/history", nil)
+	req.Header.Set("user", "test@example.com")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var history []model.ExpenseEvent
+	if err := json.Unmarshal(rec.Body.Bytes(), &history); err != nil {
+		t.Fatalf("failed to parse history: %v", err)
+	}
+	var actions []string
+	for _, e := range history {
+		actions = append(actions, e.Action)
+	}
+	expected := []string{"submit", "approve", "reimburse"}
+	if len(actions) != len(expected) {
+		t.Fatalf("unexpected history actions: %v", actions)
+	}
+	for i := range expected {
+		if actions[i] != expected[i] {
+			t.Fatalf("unexpected history actions: %v", actions)
+		}
+	}
+	if history[1].UserID != 2 || history[1].From != model.StatusSubmitted || history[1].To != model.StatusApproved {
+		t.Fatalf("unexpected approve event: %+v", history[1])
+	}
+}
+
+const hierarchyData = `
+INSERT INTO users ("id", "email", "title", "organization_id") VALUES (3, 'manager@example.com', 'manager',  1);
+INSERT INTO users ("id", "email", "title", "organization_id") VALUES (4, 'stand-in@example.com', 'developer',  1);
+UPDATE users SET manager_id = 3 WHERE id = 1;
+INSERT INTO expenses ("id", "user_id", "amount", "description", "organization_id", "status") VALUES (8, 1, 100, 'lunch', 1, 'submitted');
+INSERT INTO expenses ("id", "user_id", "amount", "description", "organization_id", "status") VALUES (9, 1, 200, 'dinner', 1, 'submitted');
+`
+
+func TestManagerApproval(t *testing.T) {
+	db := storetest.New(t, storetest.Fixture, hierarchyData)
+	auth, err := authz.NewAuthorizer(authz.Policy, authz.WithHierarchy(db))
+	if err != nil {
+		t.Fatalf("failed to create authorizer: %v", err)
+	}
+	handler := NewHTTPHandler(db, auth)
+
+	// steps are executed in order
+	data := []struct {
+		name   string
+		user   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"manager approves report expense", "manager@example.com", http.MethodPost, "/expenses/8/approve", "", http.StatusOK},
+		{"stand-in can not approve before delegation", "stand-in@example.com", http.MethodPost, "/expenses/9/approve", "", http.StatusForbidden},
+		{"delegation must end after it starts", "manager@example.com", http.MethodPost, "/delegations", `{"DelegateID": 4, "EndsAt": "2000-01-01T00:00:00Z"}`, http.StatusBadRequest},
+		{"delegation to unknown user", "manager@example.com", http.MethodPost, "/delegations", `{"DelegateID": 99, "EndsAt": "2100-01-01T00:00:00Z"}`, http.StatusBadRequest},
+		{"delegation of others rights", "stand-in@example.com", http.MethodPost, "/delegations", `{"DelegatorID": 3, "DelegateID": 4, "EndsAt": "2100-01-01T00:00:00Z"}`, http.StatusForbidden},
+		{"manager delegates approvals", "manager@example.com", http.MethodPost, "/delegations", `{"DelegateID": 4, "EndsAt": "2100-01-01T00:00:00Z"}`, http.StatusCreated},
+		{"stand-in approves after delegation", "stand-in@example.com", http.MethodPost, "/expenses/9/approve", "", http.StatusOK},
+	}
+
+	for _, d := range data {
+		req := httptest.NewRequest(d.method, d.path, strings.NewReader(d.body))
+		req.Header.Set("user", d.user)
+		// changes are made to whatever version is current
+		req.Header.Set("If-Match", "*")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != d.status {
+			t.Fatalf("%s: expected status %d, got %d: %s", d.name, d.status, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestSpendingLimit(t *testing.T) {
+	db := storetest.New(t, storetest.Fixture)
+	auth, err := authz.NewAuthorizer(authz.Policy, authz.WithSpending(db))
+	if err != nil {
+		t.Fatalf("failed to create authorizer: %v", err)
+	}
+	handler := NewHTTPHandler(db, auth)
+
+	// fixture user is developer, limited to 5000 per month, steps are executed in order
+	data := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"submit within limit", `{"Amount": 4000}`, http.StatusTemporaryRedirect},
+		{"draft is not limited", `{"Amount": 4000, "Status": "draft"}`, http.StatusTemporaryRedirect},
+		{"submit over limit", `{"Amount": 1001}`, http.StatusForbidden},
+		{"submit up to limit", `{"Amount": 1000}`, http.StatusTemporaryRedirect},
+	}
+	for _, d := range data {
+		req := httptest.NewRequest(http.MethodPut, "/expenses/submit", strings.NewReader(d.body))
+		req.Header.Set("user", "test@example.com")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != d.status {
+			t.Fatalf("%s: expected status %d, got %d: %s", d.name, d.status, rec.Code, rec.Body.String())
+		}
+		if rec.Code == http.StatusForbidden && !strings.Contains(rec.Body.String(), "5000 per month") {
+			t.Fatalf("%s: expected reason in response, got: %s", d.name, rec.Body.String())
+		}
+	}
+
+	// draft created above can not be submitted any more
+	req := httptest.NewRequest(http.MethodPost, "/expenses/2/submit", nil)
+	req.Header.Set("user", "test@example.com")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "5000 per month") {
+		t.Fatalf("expected draft submit to be forbidden with reason, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// Impersonation is request admin made as other user, recorded for audit.
+type Impersonation struct {
+	ID             int
+	OrganizationID int
+	// RealUserID is ID of admin that made the request.
+	RealUserID int
+	// EffectiveUserID is ID of user request was made as.
+	EffectiveUserID int
+	Method          string
+	Path            string
+	CreatedAt       time.Time
+}
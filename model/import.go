@@ -0,0 +1,20 @@
+package model
+
+// ImportRow is outcome of importing single row of bulk import.
+type ImportRow struct {
+	// Row is 1-based number of data row in imported file, CSV header and
+	// empty lines are not counted.
+	Row int
+	// Expense is created expense, set only if row was imported.
+	Expense *Expense `json:",omitempty"`
+	// Error describes why row was not imported.
+	Error string `json:",omitempty"`
+}
+
+// ImportReport is result of bulk import of expenses, with outcome of
+// every row.
+type ImportReport struct {
+	Imported int
+	Failed   int
+	Rows     []ImportRow
+}
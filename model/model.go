@@ -0,0 +1,190 @@
+// Package model contains domain types shared between server and API client.
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// Actor is anyone requests are made by, users and service accounts.
+type Actor interface {
+	IsAuthenticated() bool
+	// TenantID returns ID of organization actor acts in, data of other
+	// organizations is not reachable by actor.
+	TenantID() int
+}
+
+// User is model representing user in database, HTTP and auth.
+// Empty user is valid, but considered unauthenticated.
+type User struct {
+	ID    int
+	Email string
+	// Title and OrganizationID are of organization user currently acts in,
+	// by default organization user was created in.
+	Title          string
+	OrganizationID int
+	// ManagerID is ID of user's direct manager, zero if user has none.
+	ManagerID int
+	// Memberships are all organizations user belongs to, ordered by
+	// organization ID.
+	Memberships []Membership
+}
+
+func (u User) String() string {
+	return fmt.Sprintf("<User: %s (id: %d)>", u.Email, u.ID)
+}
+
+// IsAuthenticated implements logic to tell apart authenticated and guest users.
+// In this implementation, if user has email set, they are considered authenticated.
+func (u User) IsAuthenticated() bool {
+	return u.Email != ""
+}
+
+// TenantID returns ID of organization user currently acts in.
+func (u User) TenantID() int {
+	return u.OrganizationID
+}
+
+// MembershipIn returns membership of user in organization with provided ID,
+// and false if user is not its member.
+func (u User) MembershipIn(organizationID int) (Membership, bool) {
+	for _, m := range u.Memberships {
+		if m.OrganizationID == organizationID {
+			return m, true
+		}
+	}
+	return Membership{}, false
+}
+
+// InOrganization returns copy of user acting in organization with provided
+// ID, with title user has there. False is returned if user is not member of
+// organization.
+func (u User) InOrganization(organizationID int) (User, bool) {
+	m, ok := u.MembershipIn(organizationID)
+	if !ok {
+		return User{}, false
+	}
+	u.OrganizationID = m.OrganizationID
+	u.Title = m.Title
+	return u, true
+}
+
+// Membership of user in organization, users have different titles in
+// different organizations (e.g. consultant is accountant of one client and
+// director of other).
+type Membership struct {
+	OrganizationID int
+	Title          string
+}
+
+// Organization model
+type Organization struct {
+	ID   int
+	Name string
+	// RowVersion is incremented on every change of organization.
+	RowVersion int
+}
+
+func (o Organization) String() string {
+	return fmt.Sprintf("<Organization: %s (id: %d)>", o.Name, o.ID)
+}
+
+// ETag returns HTTP entity tag of current version of organization.
+func (o Organization) ETag() string {
+	return etag(o.RowVersion)
+}
+
+// Expense model
+type Expense struct {
+	ID          int
+	UserID      int
+	Amount      int
+	Description string
+	// OrganizationID is organization of user that submitted the expense.
+	OrganizationID int
+	Status         ExpenseStatus
+	CategoryID     int
+	// Category is name of category, filled when expense is loaded.
+	Category string
+	// ReportID is ID of report expense is part of, zero if it is standalone.
+	ReportID int
+	// CreatedAt is time expense was created, zero for expenses created
+	// before it was tracked.
+	CreatedAt time.Time
+	// RowVersion is incremented on every change of expense, it is zero for
+	// expenses that are not current (e.g. snapshots in ExpenseVersion).
+	RowVersion int
+}
+
+func (e Expense) String() string {
+	return fmt.Sprintf("<Expense: %d (amount: %d, user: %d)>", e.ID, e.Amount, e.UserID)
+}
+
+// ETag returns HTTP entity tag of current version of expense.
+func (e Expense) ETag() string {
+	return etag(e.RowVersion)
+}
+
+// etag formats row version as strong entity tag, tags are compared only
+// between versions of the same record.
+func etag(rowVersion int) string {
+	return fmt.Sprintf(`"%d"`, rowVersion)
+}
+
+// ExpenseReport groups expenses (e.g. of a trip) that go through approval
+// workflow together. All expenses in report are submitted by report owner.
+type ExpenseReport struct {
+	ID             int
+	UserID         int
+	OrganizationID int
+	Title          string
+	Status         ExpenseStatus
+	// Total is sum of amounts of expenses in report, filled when report is loaded.
+	Total int
+}
+
+func (r ExpenseReport) String() string {
+	return fmt.Sprintf("<ExpenseReport: %d (total: %d, user: %d)>", r.ID, r.Total, r.UserID)
+}
+
+// Summary returns expense standing for the whole report, with total amount
+// of its expenses, so report can be authorized as single expense.
+func (r ExpenseReport) Summary() Expense {
+	return Expense{
+		UserID:         r.UserID,
+		OrganizationID: r.OrganizationID,
+		Amount:         r.Total,
+		Description:    r.Title,
+		Status:         r.Status,
+	}
+}
+
+// Category of expenses (e.g. travel), managed per organization.
+type Category struct {
+	ID             int
+	OrganizationID int
+	Name           string
+}
+
+func (c Category) String() string {
+	return fmt.Sprintf("<Category: %s (id: %d)>", c.Name, c.ID)
+}
+
+// Delegation grants approval rights of delegator (e.g. manager on vacation)
+// to delegate, for a limited time.
+type Delegation struct {
+	ID          int
+	DelegatorID int
+	DelegateID  int
+	StartsAt    time.Time
+	EndsAt      time.Time
+}
+
+func (d Delegation) String() string {
+	return fmt.Sprintf("<Delegation: %d (from: %d, to: %d)>", d.ID, d.DelegatorID, d.DelegateID)
+}
+
+// IsActive reports if delegation is in effect at provided time.
+func (d Delegation) IsActive(at time.Time) bool {
+	return !at.Before(d.StartsAt) && at.Before(d.EndsAt)
+}
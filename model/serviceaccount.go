@@ -0,0 +1,81 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// Scopes API keys can be limited to. Keys without scopes have all of them.
+const (
+	ScopeExpensesRead      = "expenses:read"
+	ScopeReportsRead       = "reports:read"
+	ScopeOrganizationsRead = "organizations:read"
+)
+
+// ServiceAccount is actor authenticated with API key, used by programs
+// (e.g. batch jobs) instead of humans. Every API key is its own service
+// account in organization key was created for.
+type ServiceAccount struct {
+	ID             int
+	OrganizationID int
+	Name           string
+	// Scopes key is limited to, all scopes if empty.
+	Scopes []string
+	// ExpiresAt is time key stops working, zero if it never expires.
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	// RevokedAt is time key was revoked, zero for keys in use.
+	RevokedAt time.Time
+}
+
+func (sa ServiceAccount) String() string {
+	return fmt.Sprintf("<ServiceAccount: %s (id: %d)>", sa.Name, sa.ID)
+}
+
+// IsAuthenticated is always true, service accounts exist only for valid keys.
+func (sa ServiceAccount) IsAuthenticated() bool {
+	return true
+}
+
+// TenantID returns ID of organization key was created for.
+func (sa ServiceAccount) TenantID() int {
+	return sa.OrganizationID
+}
+
+// HasScope reports if key is allowed provided scope.
+func (sa ServiceAccount) HasScope(scope string) bool {
+	if len(sa.Scopes) == 0 {
+		return true
+	}
+	for _, s := range sa.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsActive reports if key can be used at provided time, i.e. if it is
+// neither revoked nor expired.
+func (sa ServiceAccount) IsActive(at time.Time) bool {
+	if !sa.RevokedAt.IsZero() && !at.Before(sa.RevokedAt) {
+		return false
+	}
+	return sa.ExpiresAt.IsZero() || at.Before(sa.ExpiresAt)
+}
+
+// IsScope reports if provided string is one of known scopes.
+func IsScope(scope string) bool {
+	switch scope {
+	case ScopeExpensesRead, ScopeReportsRead, ScopeOrganizationsRead:
+		return true
+	}
+	return false
+}
+
+// APIKey is newly created API key with service account it authenticates
+// as. Only hash of key is stored, so key is available only on creation.
+type APIKey struct {
+	ServiceAccount ServiceAccount
+	Key            string
+}
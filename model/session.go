@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// Session of user logged in with cookie. Session token itself is known
+// only to browser, CSRFToken has to accompany requests changing data.
+type Session struct {
+	ID        int
+	UserID    int
+	CSRFToken string
+	CreatedAt time.Time
+	// RotatedAt is time session token was last replaced with new one.
+	RotatedAt time.Time
+	ExpiresAt time.Time
+	// RevokedAt is time user logged out, zero for sessions in use.
+	RevokedAt time.Time
+}
+
+// IsActive reports if session can be used at provided time, i.e. if it is
+// neither revoked nor expired.
+func (s Session) IsActive(at time.Time) bool {
+	if !s.RevokedAt.IsZero() && !at.Before(s.RevokedAt) {
+		return false
+	}
+	return at.Before(s.ExpiresAt)
+}
@@ -0,0 +1,55 @@
+package model
+
+import "time"
+
+// ExpenseVersion is snapshot of expense taken after every change of it.
+type ExpenseVersion struct {
+	// Version numbers versions of single expense, starting from 1.
+	Version int
+	// UserID is ID of user whose change created the version.
+	UserID    int
+	CreatedAt time.Time
+	// Deleted reports if expense was soft deleted in this version.
+	Deleted bool
+	Expense Expense
+}
+
+// FieldChange is change of single expense field between two versions.
+type FieldChange struct {
+	Field string
+	From  interface{}
+	To    interface{}
+}
+
+// VersionDiff lists changes of expense between two of its versions.
+type VersionDiff struct {
+	ExpenseID int
+	From      int
+	To        int
+	Changes   []FieldChange
+}
+
+// Diff returns changes of fields users can change between version v and
+// provided later version.
+func (v ExpenseVersion) Diff(to ExpenseVersion) VersionDiff {
+	diff := VersionDiff{
+		ExpenseID: v.Expense.ID,
+		From:      v.Version,
+		To:        to.Version,
+		Changes:   []FieldChange{},
+	}
+	fields := []FieldChange{
+		{"Amount", v.Expense.Amount, to.Expense.Amount},
+		{"Description", v.Expense.Description, to.Expense.Description},
+		{"Status", v.Expense.Status, to.Expense.Status},
+		{"Category", v.Expense.Category, to.Expense.Category},
+		{"ReportID", v.Expense.ReportID, to.Expense.ReportID},
+		{"Deleted", v.Deleted, to.Deleted},
+	}
+	for _, f := range fields {
+		if f.From != f.To {
+			diff.Changes = append(diff.Changes, f)
+		}
+	}
+	return diff
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpenseVersion_Diff(t *testing.T) {
+	base := ExpenseVersion{Version: 1, Expense: Expense{ID: 7, Amount: 100, Description: "lunch", Status: StatusDraft}}
+
+	data := []struct {
+		name    string
+		to      func(v ExpenseVersion) ExpenseVersion
+		changes []FieldChange
+	}{
+		{"no changes", func(v ExpenseVersion) ExpenseVersion { return v }, []FieldChange{}},
+		{"amount", func(v ExpenseVersion) ExpenseVersion {
+			v.Expense.Amount = 150
+			return v
+		}, []FieldChange{{"Amount", 100, 150}}},
+		{"status and report", func(v ExpenseVersion) ExpenseVersion {
+			v.Expense.Status = StatusSubmitted
+			v.Expense.ReportID = 3
+			return v
+		}, []FieldChange{{"Status", StatusDraft, StatusSubmitted}, {"ReportID", 0, 3}}},
+		{"deleted", func(v ExpenseVersion) ExpenseVersion {
+			v.Deleted = true
+			return v
+		}, []FieldChange{{"Deleted", false, true}}},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.name, func(t *testing.T) {
+			to := d.to(base)
+			to.Version = 2
+			diff := base.Diff(to)
+			if diff.ExpenseID != 7 || diff.From != 1 || diff.To != 2 {
+				t.Fatalf("unexpected versions in diff: %+v", diff)
+			}
+			if !reflect.DeepEqual(diff.Changes, d.changes) {
+				t.Fatalf("unexpected changes, got: %v, expected: %v", diff.Changes, d.changes)
+			}
+		})
+	}
+}
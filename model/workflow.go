@@ -0,0 +1,88 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ExpenseStatus is state of expense in approval workflow.
+type ExpenseStatus string
+
+// Expense statuses. Expenses start as drafts (or are submitted right away),
+// submitted expenses are approved or rejected and approved ones reimbursed.
+const (
+	StatusDraft      ExpenseStatus = "draft"
+	StatusSubmitted  ExpenseStatus = "submitted"
+	StatusApproved   ExpenseStatus = "approved"
+	StatusRejected   ExpenseStatus = "rejected"
+	StatusReimbursed ExpenseStatus = "reimbursed"
+)
+
+// Workflow actions, each moves expense from one status to another. Actions
+// are also used as authorization actions, e.g. "approve" an expense.
+const (
+	ActionSubmit    = "submit"
+	ActionApprove   = "approve"
+	ActionReject    = "reject"
+	ActionReimburse = "reimburse"
+)
+
+// ActionCreate is action recorded in history when expense is created.
+const ActionCreate = "create"
+
+var transitions = map[string]struct {
+	from, to ExpenseStatus
+}{
+	ActionSubmit:    {StatusDraft, StatusSubmitted},
+	ActionApprove:   {StatusSubmitted, StatusApproved},
+	ActionReject:    {StatusSubmitted, StatusRejected},
+	ActionReimburse: {StatusApproved, StatusReimbursed},
+}
+
+// ErrUnknownAction is returned for actions that are not part of workflow.
+var ErrUnknownAction = errors.New("unknown workflow action")
+
+// ErrInvalidTransition is returned when action is not possible in current
+// status of expense.
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// IsWorkflowAction reports if provided action is part of approval workflow.
+func IsWorkflowAction(action string) bool {
+	_, ok := transitions[action]
+	return ok
+}
+
+// Transition returns status expense would end up in after provided action.
+func (e Expense) Transition(action string) (ExpenseStatus, error) {
+	return transition(e.Status, action, "expense")
+}
+
+// Transition returns status report (and all expenses in it) would end up
+// in after provided action.
+func (r ExpenseReport) Transition(action string) (ExpenseStatus, error) {
+	return transition(r.Status, action, "report")
+}
+
+func transition(from ExpenseStatus, action, what string) (ExpenseStatus, error) {
+	t, ok := transitions[action]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownAction, action)
+	}
+	if from != t.from {
+		return "", fmt.Errorf("%w: can not %s %s %s", ErrInvalidTransition, action, from, what)
+	}
+	return t.to, nil
+}
+
+// ExpenseEvent is single entry in history of expense status changes.
+type ExpenseEvent struct {
+	ID        int
+	ExpenseID int
+	// UserID is ID of user who performed the action.
+	UserID    int
+	Action    string
+	From      ExpenseStatus
+	To        ExpenseStatus
+	CreatedAt time.Time
+}
@@ -0,0 +1,38 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestExpense_Transition(t *testing.T) {
+	data := []struct {
+		from   ExpenseStatus
+		action string
+		to     ExpenseStatus
+		err    error
+	}{
+		{StatusDraft, ActionSubmit, StatusSubmitted, nil},
+		{StatusSubmitted, ActionApprove, StatusApproved, nil},
+		{StatusSubmitted, ActionReject, StatusRejected, nil},
+		{StatusApproved, ActionReimburse, StatusReimbursed, nil},
+		{StatusDraft, ActionApprove, "", ErrInvalidTransition},
+		{StatusRejected, ActionReimburse, "", ErrInvalidTransition},
+		{StatusReimbursed, ActionSubmit, "", ErrInvalidTransition},
+		{StatusSubmitted, "delete", "", ErrUnknownAction},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(fmt.Sprintf("%s %s", d.action, d.from), func(t *testing.T) {
+			to, err := Expense{Status: d.from}.Transition(d.action)
+			if !errors.Is(err, d.err) {
+				t.Fatalf("unexpected error, got: %v, expected: %v", err, d.err)
+			}
+			if to != d.to {
+				t.Fatalf("unexpected status, got: %q, expected: %q", to, d.to)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+// Package oidc implements relying party side of OpenID Connect: login with
+// authorization code flow with PKCE and validation of ID tokens against
+// keys identity provider publishes (JWKS).
+//
+// Only what this application needs is implemented, ID tokens have to be
+// signed with RS256.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config of client registered with identity provider.
+type Config struct {
+	// Issuer is URL of identity provider, discovery document is loaded
+	// from its /.well-known/openid-configuration.
+	Issuer   string
+	ClientID string
+	// ClientSecret is optional, public clients rely on PKCE only.
+	ClientSecret string
+	// RedirectURL is where provider sends users back with authorization code.
+	RedirectURL string
+	// Scopes requested on login, "openid", "email" and "profile" by default.
+	Scopes []string
+	// HTTPClient is used for requests to provider, http.DefaultClient if nil.
+	HTTPClient *http.Client
+	// KeyRefreshInterval is minimum time between loads of provider keys,
+	// one minute by default. Tokens with unknown key ID are rejected without
+	// loading keys again until it passes.
+	KeyRefreshInterval time.Duration
+}
+
+// Claims of ID token application uses.
+type Claims struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Groups        []string
+	Nonce         string
+	ExpiresAt     time.Time
+}
+
+// Provider is identity provider application is registered with. It is
+// safe for concurrent use.
+type Provider struct {
+	config   Config
+	metadata metadata
+
+	mu   sync.Mutex
+	keys map[string]*rsa.PublicKey
+	// keysLoadedAt is when keys were last requested from provider
+	keysLoadedAt time.Time
+	// loading is closed when keys requested from provider are loaded
+	loading chan struct{}
+}
+
+// metadata is part of discovery document provider is used through.
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewProvider loads discovery document of provider configured issuer.
+func NewProvider(ctx context.Context, config Config) (*Provider, error) {
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	if config.KeyRefreshInterval == 0 {
+		config.KeyRefreshInterval = time.Minute
+	}
+
+	p := &Provider{config: config}
+	discovery := strings.TrimSuffix(config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, discovery, &p.metadata); err != nil {
+		return nil, fmt.Errorf("loading discovery document: %w", err)
+	}
+	// tokens are only trusted if issued by exactly configured issuer
+	if p.metadata.Issuer != config.Issuer {
+		return nil, fmt.Errorf("provider issuer %q does not match configured %q", p.metadata.Issuer, config.Issuer)
+	}
+	if p.metadata.AuthorizationEndpoint == "" || p.metadata.TokenEndpoint == "" || p.metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document of %q is missing endpoints", config.Issuer)
+	}
+	return p, nil
+}
+
+// RandomToken returns random URL safe string, usable as state, nonce and
+// PKCE code verifier.
+func RandomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge returns S256 PKCE challenge for provided code verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns URL of provider's login page users are redirected
+// to. State is returned back with authorization code, nonce is returned in
+// ID token and verifier has to be provided to Exchange.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {CodeChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(p.metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.metadata.AuthorizationEndpoint + separator + query.Encode()
+}
+
+// Exchange trades authorization code for tokens and returns raw ID token.
+// ID token is not verified, caller has to Verify it.
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"client_id":     {p.config.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("creating token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.config.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("exchanging code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1024*1024)).Decode(&tokens); err != nil {
+		return "", fmt.Errorf("decoding token response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || tokens.Error != "" {
+		return "", fmt.Errorf("exchanging code: %s: %s (status %d)", tokens.Error, tokens.ErrorDescription, resp.StatusCode)
+	}
+	if tokens.IDToken == "" {
+		return "", fmt.Errorf("token response has no ID token")
+	}
+	return tokens.IDToken, nil
+}
+
+// getJSON decodes JSON response of GET request to provided URL into out.
+func (p *Provider) getJSON(ctx context.Context, u string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.config.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s responded with %d", u, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1024*1024)).Decode(out)
+}
@@ -0,0 +1,232 @@
+package oidc_test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/delicb/oso-go-tutorial/oidc"
+	"github.com/delicb/oso-go-tutorial/oidc/oidctest"
+)
+
+const (
+	clientID    = "expenses"
+	redirectURL = "http://expenses.test/auth/callback"
+)
+
+var alice = oidctest.Identity{Subject: "alice-1", Email: "alice@example.com", Groups: []string{"accounting"}}
+
+func newProvider(t *testing.T) (*oidctest.Provider, *oidc.Provider) {
+	t.Helper()
+	return newProviderWithRefresh(t, 0)
+}
+
+// newProviderWithRefresh creates provider loading keys at most once per
+// keyRefresh, zero keeps default.
+func newProviderWithRefresh(t *testing.T, keyRefresh time.Duration) (*oidctest.Provider, *oidc.Provider) {
+	t.Helper()
+	idp := oidctest.New(t, clientID)
+	provider, err := oidc.NewProvider(context.Background(), oidc.Config{
+		Issuer:             idp.Issuer(),
+		ClientID:           clientID,
+		RedirectURL:        redirectURL,
+		KeyRefreshInterval: keyRefresh,
+	})
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+	return idp, provider
+}
+
+// authorize follows provider's redirect back to application and returns
+// query of callback request.
+func authorize(t *testing.T, authCodeURL string) url.Values {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authCodeURL)
+	if err != nil {
+		t.Fatalf("failed to authorize: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("expected redirect, got %d", resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("failed to parse redirect: %v", err)
+	}
+	if !strings.HasPrefix(location.String(), redirectURL) {
+		t.Fatalf("expected redirect to %q, got %q", redirectURL, location)
+	}
+	return location.Query()
+}
+
+func TestProvider_Login(t *testing.T) {
+	idp, provider := newProvider(t)
+	ctx := context.Background()
+
+	// without signed in user provider denies access
+	callback := authorize(t, provider.AuthCodeURL("state-1", "nonce-1", "verifier-1"))
+	if callback.Get("error") != "access_denied" || callback.Get("state") != "state-1" {
+		t.Fatalf("expected access to be denied, got %v", callback)
+	}
+
+	idp.SignIn(alice)
+	callback = authorize(t, provider.AuthCodeURL("state-2", "nonce-2", "verifier-2"))
+	if callback.Get("state") != "state-2" || callback.Get("code") == "" {
+		t.Fatalf("expected code, got %v", callback)
+	}
+	if _, err := provider.Exchange(ctx, callback.Get("code"), "other-verifier"); err == nil {
+		t.Fatalf("expected exchange with wrong verifier to fail")
+	}
+	// code is gone after failed exchange
+	if _, err := provider.Exchange(ctx, callback.Get("code"), "verifier-2"); err == nil {
+		t.Fatalf("expected code to be used once")
+	}
+
+	callback = authorize(t, provider.AuthCodeURL("state-3", "nonce-3", "verifier-3"))
+	raw, err := provider.Exchange(ctx, callback.Get("code"), "verifier-3")
+	if err != nil {
+		t.Fatalf("failed to exchange code: %v", err)
+	}
+	claims, err := provider.Verify(ctx, raw)
+	if err != nil {
+		t.Fatalf("failed to verify ID token: %v", err)
+	}
+	if claims.Subject != alice.Subject || claims.Email != alice.Email || !claims.EmailVerified ||
+		claims.Nonce != "nonce-3" || len(claims.Groups) != 1 || claims.Groups[0] != "accounting" {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+}
+
+func TestProvider_Verify(t *testing.T) {
+	idp, provider := newProvider(t)
+	other := oidctest.New(t, clientID)
+	ctx := context.Background()
+
+	valid := idp.Sign(idp.Claims(alice, ""))
+	parts := strings.Split(valid, ".")
+
+	data := []struct {
+		name  string
+		token func() string
+	}{
+		{"malformed", func() string { return "not-a-token" }},
+		{"wrong audience", func() string {
+			claims := idp.Claims(alice, "")
+			claims["aud"] = "other-client"
+			return idp.Sign(claims)
+		}},
+		{"multiple audiences without azp", func() string {
+			claims := idp.Claims(alice, "")
+			claims["aud"] = []string{clientID, "other-client"}
+			return idp.Sign(claims)
+		}},
+		{"expired", func() string {
+			claims := idp.Claims(alice, "")
+			claims["exp"] = time.Now().Add(-time.Hour).Unix()
+			return idp.Sign(claims)
+		}},
+		{"issued in the future", func() string {
+			claims := idp.Claims(alice, "")
+			claims["iat"] = time.Now().Add(time.Hour).Unix()
+			return idp.Sign(claims)
+		}},
+		{"wrong issuer", func() string {
+			claims := idp.Claims(alice, "")
+			claims["iss"] = other.Issuer()
+			return idp.Sign(claims)
+		}},
+		{"no subject", func() string {
+			claims := idp.Claims(alice, "")
+			delete(claims, "sub")
+			return idp.Sign(claims)
+		}},
+		{"signed by other provider", func() string {
+			return other.Sign(idp.Claims(alice, ""))
+		}},
+		{"tampered payload", func() string {
+			claims := strings.Replace(parts[1], parts[1][:4], "eyJz", 1)
+			return parts[0] + "." + claims + "." + parts[2]
+		}},
+		{"algorithm none", func() string {
+			header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"key-1"}`))
+			return header + "." + parts[1] + "."
+		}},
+	}
+
+	for _, d := range data {
+		if _, err := provider.Verify(ctx, d.token()); !errors.Is(err, oidc.ErrInvalidToken) {
+			t.Fatalf("%s: expected invalid token, got %v", d.name, err)
+		}
+	}
+
+	claims := idp.Claims(alice, "")
+	claims["aud"] = []string{clientID, "other-client"}
+	claims["azp"] = clientID
+	if _, err := provider.Verify(ctx, idp.Sign(claims)); err != nil {
+		t.Fatalf("expected token authorized for client to be valid, got %v", err)
+	}
+}
+
+func TestProvider_KeyRotation(t *testing.T) {
+	idp, provider := newProviderWithRefresh(t, time.Nanosecond)
+	ctx := context.Background()
+
+	before := idp.Sign(idp.Claims(alice, ""))
+	if _, err := provider.Verify(ctx, before); err != nil {
+		t.Fatalf("failed to verify ID token: %v", err)
+	}
+
+	// provider is not asked for keys again until unknown key is used
+	idp.RotateKey()
+	after := idp.Sign(idp.Claims(alice, ""))
+	if _, err := provider.Verify(ctx, after); err != nil {
+		t.Fatalf("failed to verify ID token signed with new key: %v", err)
+	}
+	if _, err := provider.Verify(ctx, before); err != nil {
+		t.Fatalf("failed to verify ID token signed with old key: %v", err)
+	}
+}
+
+func TestProvider_KeyRefreshInterval(t *testing.T) {
+	idp, provider := newProvider(t)
+	ctx := context.Background()
+
+	if _, err := provider.Verify(ctx, idp.Sign(idp.Claims(alice, ""))); err != nil {
+		t.Fatalf("failed to verify ID token: %v", err)
+	}
+	// tokens with unknown keys do not reach provider until interval passes
+	idp.RotateKey()
+	rotated := idp.Sign(idp.Claims(alice, ""))
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := provider.Verify(ctx, rotated); !errors.Is(err, oidc.ErrInvalidToken) {
+				t.Errorf("expected invalid token error, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if requests := idp.KeyRequests(); requests != 1 {
+		t.Fatalf("expected keys to be requested once, got %d", requests)
+	}
+}
+
+func TestNewProvider_IssuerMismatch(t *testing.T) {
+	idp := oidctest.New(t, clientID)
+	_, err := oidc.NewProvider(context.Background(), oidc.Config{Issuer: idp.Issuer() + "/", ClientID: clientID})
+	if err == nil {
+		t.Fatalf("expected error for issuer not matching discovery document")
+	}
+}
@@ -0,0 +1,262 @@
+// Package oidctest provides fake OpenID Connect identity provider for tests
+// of packages that log users in with oidc.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/delicb/oso-go-tutorial/oidc"
+)
+
+// Identity of user fake provider authenticates.
+type Identity struct {
+	Subject string
+	Email   string
+	Groups  []string
+}
+
+// Provider is identity provider running on httptest server. It has no
+// login page, authorization requests are granted to identity set with
+// SignIn right away.
+type Provider struct {
+	server   *httptest.Server
+	clientID string
+
+	mu          sync.Mutex
+	keys        []signingKey // current key is last
+	keyRequests int
+	identity    *Identity
+	grants      map[string]grant
+}
+
+type signingKey struct {
+	id  string
+	key *rsa.PrivateKey
+}
+
+// grant is issued authorization code waiting to be exchanged.
+type grant struct {
+	identity      Identity
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+}
+
+// New starts provider with single registered client, stopped when test ends.
+func New(t *testing.T, clientID string) *Provider {
+	t.Helper()
+	p := &Provider{clientID: clientID, grants: make(map[string]grant)}
+	p.RotateKey()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	mux.HandleFunc("/jwks", p.jwks)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// Issuer returns issuer URL of provider, configured as oidc.Config.Issuer.
+func (p *Provider) Issuer() string {
+	return p.server.URL
+}
+
+// SignIn sets identity authorization requests are granted to. Until it is
+// called, requests are denied.
+func (p *Provider) SignIn(identity Identity) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.identity = &identity
+}
+
+// RotateKey starts signing tokens with new key. Previous keys are still
+// published, so tokens signed with them stay valid.
+func (p *Provider) RotateKey() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(fmt.Sprintf("generating key: %v", err))
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = append(p.keys, signingKey{id: fmt.Sprintf("key-%d", len(p.keys)+1), key: key})
+}
+
+// KeyRequests returns how many times keys of provider were requested.
+func (p *Provider) KeyRequests() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.keyRequests
+}
+
+// Claims returns claims of valid ID token for provided identity, tests
+// change them to get invalid tokens.
+func (p *Provider) Claims(identity Identity, nonce string) map[string]interface{} {
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":            p.Issuer(),
+		"sub":            identity.Subject,
+		"aud":            p.clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"email":          identity.Email,
+		"email_verified": true,
+		"groups":         identity.Groups,
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	return claims
+}
+
+// Sign returns ID token with provided claims, signed with current key.
+func (p *Provider) Sign(claims map[string]interface{}) string {
+	p.mu.Lock()
+	current := p.keys[len(p.keys)-1]
+	p.mu.Unlock()
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": current.id})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		panic(fmt.Sprintf("marshaling claims: %v", err))
+	}
+	signed := encode(header) + "." + encode(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, current.key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(fmt.Sprintf("signing token: %v", err))
+	}
+	return signed + "." + encode(signature)
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.Issuer(),
+		"authorization_endpoint":                p.Issuer() + "/authorize",
+		"token_endpoint":                        p.Issuer() + "/token",
+		"jwks_uri":                              p.Issuer() + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if q.Get("client_id") != p.clientID || err != nil || !redirectURI.IsAbs() {
+		http.Error(w, "unknown client or redirect URI", http.StatusBadRequest)
+		return
+	}
+
+	response := url.Values{"state": {q.Get("state")}}
+	p.mu.Lock()
+	identity := p.identity
+	switch {
+	case q.Get("response_type") != "code":
+		response.Set("error", "unsupported_response_type")
+	case q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "":
+		// PKCE is required
+		response.Set("error", "invalid_request")
+	case identity == nil:
+		response.Set("error", "access_denied")
+	default:
+		code, err := oidc.RandomToken()
+		if err != nil {
+			p.mu.Unlock()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		p.grants[code] = grant{
+			identity:      *identity,
+			redirectURI:   redirectURI.String(),
+			nonce:         q.Get("nonce"),
+			codeChallenge: q.Get("code_challenge"),
+		}
+		response.Set("code", code)
+	}
+	p.mu.Unlock()
+
+	redirectURI.RawQuery = response.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	p.mu.Lock()
+	code := r.PostForm.Get("code")
+	g, ok := p.grants[code]
+	// codes are used once, even if exchange fails
+	delete(p.grants, code)
+	p.mu.Unlock()
+
+	switch {
+	case r.PostForm.Get("grant_type") != "authorization_code":
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+	case r.PostForm.Get("client_id") != p.clientID:
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+	case !ok || r.PostForm.Get("redirect_uri") != g.redirectURI:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+	case oidc.CodeChallenge(r.PostForm.Get("code_verifier")) != g.codeChallenge:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+	default:
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"access_token": "not-used",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     p.Sign(p.Claims(g.identity, g.nonce)),
+		})
+	}
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, _ *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keyRequests++
+
+	keys := []map[string]string{}
+	for _, k := range p.keys {
+		keys = append(keys, map[string]string{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": k.id,
+			"n":   encode(k.key.N.Bytes()),
+			"e":   encode(big.NewInt(int64(k.key.E)).Bytes()),
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"keys": keys})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
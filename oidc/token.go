@@ -0,0 +1,230 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is returned (wrapped) for ID tokens that fail validation.
+var ErrInvalidToken = errors.New("invalid ID token")
+
+// clockSkew is tolerated difference between clocks of provider and application.
+const clockSkew = time.Minute
+
+// header of JWS in compact serialization.
+type header struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// payload holds registered claims of ID token and those mapped to Claims.
+type payload struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	AuthorizedBy  string   `json:"azp"`
+	ExpiresAt     int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Groups        []string `json:"groups"`
+}
+
+// audience claim is either single string or list of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// Verify checks signature of raw ID token and that it was issued by
+// provider, for this client and is not expired, and returns its claims.
+// Nonce is not checked, it is known only to caller.
+func (p *Provider) Verify(ctx context.Context, rawIDToken string) (Claims, error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return Claims{}, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return Claims{}, fmt.Errorf("%w: decoding header: %v", ErrInvalidToken, err)
+	}
+	// algorithm is never taken from token, "none" and HMAC with public key
+	// as secret are classic attacks
+	if h.Algorithm != "RS256" {
+		return Claims{}, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, h.Algorithm)
+	}
+	key, err := p.key(ctx, h.KeyID)
+	if err != nil {
+		return Claims{}, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: decoding signature: %v", ErrInvalidToken, err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return Claims{}, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+
+	var pl payload
+	if err := decodeSegment(parts[1], &pl); err != nil {
+		return Claims{}, fmt.Errorf("%w: decoding payload: %v", ErrInvalidToken, err)
+	}
+	if pl.Issuer != p.metadata.Issuer {
+		return Claims{}, fmt.Errorf("%w: issued by %q", ErrInvalidToken, pl.Issuer)
+	}
+	if !pl.Audience.contains(p.config.ClientID) {
+		return Claims{}, fmt.Errorf("%w: not issued for this client", ErrInvalidToken)
+	}
+	if len(pl.Audience) > 1 && pl.AuthorizedBy != p.config.ClientID {
+		return Claims{}, fmt.Errorf("%w: not authorized for this client", ErrInvalidToken)
+	}
+	if pl.Subject == "" {
+		return Claims{}, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+	now := time.Now()
+	expiresAt := time.Unix(pl.ExpiresAt, 0)
+	if pl.ExpiresAt == 0 || now.After(expiresAt.Add(clockSkew)) {
+		return Claims{}, fmt.Errorf("%w: expired", ErrInvalidToken)
+	}
+	if time.Unix(pl.IssuedAt, 0).After(now.Add(clockSkew)) {
+		return Claims{}, fmt.Errorf("%w: issued in the future", ErrInvalidToken)
+	}
+
+	return Claims{
+		Issuer:        pl.Issuer,
+		Subject:       pl.Subject,
+		Email:         pl.Email,
+		EmailVerified: pl.EmailVerified,
+		Groups:        pl.Groups,
+		Nonce:         pl.Nonce,
+		ExpiresAt:     expiresAt,
+	}, nil
+}
+
+func decodeSegment(segment string, out interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// key returns provider's key with provided ID. Keys are loaded again when
+// key is not known, providers publish new keys before they start using them.
+// Loads are at least KeyRefreshInterval apart, so tokens with made up key IDs
+// can not make every request reach provider, and happen outside of lock,
+// callers wanting the same load wait for it.
+func (p *Provider) key(ctx context.Context, keyID string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	if key, ok := p.keys[keyID]; ok {
+		p.mu.Unlock()
+		return key, nil
+	}
+	loading := p.loading
+	if loading == nil {
+		if time.Since(p.keysLoadedAt) < p.config.KeyRefreshInterval {
+			p.mu.Unlock()
+			return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, keyID)
+		}
+		loading = make(chan struct{})
+		p.loading = loading
+		p.keysLoadedAt = time.Now()
+		p.mu.Unlock()
+
+		keys, err := p.loadKeys(ctx)
+		p.mu.Lock()
+		if err == nil {
+			p.keys = keys
+		}
+		p.loading = nil
+		p.mu.Unlock()
+		close(loading)
+		if err != nil {
+			return nil, fmt.Errorf("loading provider keys: %w", err)
+		}
+	} else {
+		p.mu.Unlock()
+		select {
+		case <-loading:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[keyID]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, keyID)
+}
+
+// loadKeys fetches RSA signing keys from provider's JWKS, keys of other
+// types and uses are skipped.
+func (p *Provider) loadKeys(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	var set struct {
+		Keys []struct {
+			KeyType string `json:"kty"`
+			Use     string `json:"use"`
+			KeyID   string `json:"kid"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.metadata.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.KeyType != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("decoding modulus of key %q: %w", k.KeyID, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("decoding exponent of key %q: %w", k.KeyID, err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("exponent of key %q is too large", k.KeyID)
+		}
+		keys[k.KeyID] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+	}
+	return keys, nil
+}
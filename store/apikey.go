@@ -0,0 +1,135 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+// apiKeyPrefix starts every API key, so leaked keys are easy to recognize.
+const apiKeyPrefix = "exk_"
+
+// newToken returns random token (API key or session token) starting with
+// provided prefix and its hash, as stored in database.
+func newToken(prefix string) (token, hash string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", fmt.Errorf("generating token: %w", err)
+	}
+	token = prefix + base64.RawURLEncoding.EncodeToString(secret)
+	return token, hashToken(token), nil
+}
+
+// hashToken returns hash token is looked up by. Tokens are random and long
+// enough for plain SHA-256 to be safe, slow hashes are needed for passwords
+// only.
+func hashToken(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+const serviceAccountQuery = `SELECT id, organization_id, name, scopes, expires_at, created_at, revoked_at FROM api_keys`
+
+func scanServiceAccount(row scanner) (model.ServiceAccount, error) {
+	var sa model.ServiceAccount
+	var scopes string
+	var expiresAt, revokedAt sql.NullTime
+
+	if err := row.Scan(&sa.ID, &sa.OrganizationID, &sa.Name, &scopes, &expiresAt, &sa.CreatedAt, &revokedAt); err != nil {
+		return model.ServiceAccount{}, err
+	}
+	sa.Scopes = strings.Fields(scopes)
+	sa.ExpiresAt = expiresAt.Time
+	sa.RevokedAt = revokedAt.Time
+	return sa, nil
+}
+
+func (m *SQLiteManager) CreateServiceAccount(in model.ServiceAccount) (model.ServiceAccount, string, error) {
+	key, hash, err := newToken(apiKeyPrefix)
+	if err != nil {
+		return model.ServiceAccount{}, "", err
+	}
+	var expiresAt interface{}
+	if !in.ExpiresAt.IsZero() {
+		expiresAt = in.ExpiresAt.UTC()
+	}
+	in.CreatedAt = time.Now().UTC()
+	in.RevokedAt = time.Time{}
+
+	res, err := m.db.Exec(`INSERT INTO api_keys (organization_id, name, key_hash, scopes, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		in.OrganizationID, in.Name, hash, strings.Join(in.Scopes, " "), expiresAt, in.CreatedAt)
+	if err != nil {
+		return model.ServiceAccount{}, "", err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return model.ServiceAccount{}, "", err
+	}
+	in.ID = int(id)
+	return in, key, nil
+}
+
+func (m *SQLiteManager) ServiceAccountByID(id int) (model.ServiceAccount, error) {
+	row := m.db.QueryRow(serviceAccountQuery+` WHERE id = ?`, id)
+	switch sa, err := scanServiceAccount(row); err {
+	case sql.ErrNoRows:
+		return model.ServiceAccount{}, fmt.Errorf("no service account for ID %d", id)
+	case nil:
+		return sa, nil
+	default:
+		return model.ServiceAccount{}, err // unknown error, just propagate
+	}
+}
+
+func (m *SQLiteManager) ServiceAccountByKey(key string) (model.ServiceAccount, error) {
+	row := m.db.QueryRow(serviceAccountQuery+` WHERE key_hash = ?`, hashToken(key))
+	switch sa, err := scanServiceAccount(row); err {
+	case sql.ErrNoRows:
+		// key itself is never part of errors, errors end up in logs
+		return model.ServiceAccount{}, fmt.Errorf("no service account for provided key")
+	case nil:
+		return sa, nil
+	default:
+		return model.ServiceAccount{}, err // unknown error, just propagate
+	}
+}
+
+func (m *SQLiteManager) ServiceAccounts(organizationID int) ([]model.ServiceAccount, error) {
+	rows, err := m.db.Query(serviceAccountQuery+` WHERE organization_id = ? ORDER BY id`, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []model.ServiceAccount{}
+	for rows.Next() {
+		sa, err := scanServiceAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, sa)
+	}
+	return accounts, rows.Err()
+}
+
+func (m *SQLiteManager) RevokeServiceAccount(id int) error {
+	res, err := m.db.Exec(`UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("no active service account for ID %d", id)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+func TestDBManager_ServiceAccounts(t *testing.T) {
+	manager := getDBManager(t, "storetest/fixture.sql")
+
+	expiresAt := time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)
+	created, key, err := manager.CreateServiceAccount(model.ServiceAccount{
+		OrganizationID: 1, Name: "exporter", Scopes: []string{model.ScopeExpensesRead}, ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		t.Fatalf("failed to create service account: %v", err)
+	}
+	if created.ID == 0 || !strings.HasPrefix(key, apiKeyPrefix) {
+		t.Fatalf("unexpected service account %+v with key %q", created, key)
+	}
+
+	// keys are stored hashed
+	var stored int
+	if err := manager.db.QueryRow(`SELECT COUNT(*) FROM api_keys WHERE key_hash = ?`, key).Scan(&stored); err != nil || stored != 0 {
+		t.Fatalf("expected key not to be stored in plain text, got %d, %v", stored, err)
+	}
+
+	found, err := manager.ServiceAccountByKey(key)
+	if err != nil {
+		t.Fatalf("failed to find service account by key: %v", err)
+	}
+	if found.ID != created.ID || !reflect.DeepEqual(found.Scopes, created.Scopes) || !found.ExpiresAt.Equal(expiresAt) {
+		t.Fatalf("expected %+v, got %+v", created, found)
+	}
+	if !found.IsActive(time.Now()) || found.IsActive(expiresAt) {
+		t.Fatalf("expected key to be active until it expires: %+v", found)
+	}
+	if _, err := manager.ServiceAccountByKey(key + "x"); err == nil {
+		t.Fatalf("expected error for unknown key")
+	}
+
+	if err := manager.RevokeServiceAccount(created.ID); err != nil {
+		t.Fatalf("failed to revoke service account: %v", err)
+	}
+	if err := manager.RevokeServiceAccount(created.ID); err == nil {
+		t.Fatalf("expected error revoking service account twice")
+	}
+	revoked, err := manager.ServiceAccountByID(created.ID)
+	if err != nil {
+		t.Fatalf("failed to get service account: %v", err)
+	}
+	if revoked.IsActive(time.Now()) {
+		t.Fatalf("expected revoked key not to be active: %+v", revoked)
+	}
+
+	accounts, err := manager.ServiceAccounts(1)
+	if err != nil || len(accounts) != 1 || accounts[0].ID != created.ID {
+		t.Fatalf("unexpected service accounts: %+v, %v", accounts, err)
+	}
+
+	other := ForTenant(manager, 2)
+	if _, err := other.ServiceAccountByKey(key); !errors.Is(err, ErrOtherTenant) {
+		t.Fatalf("expected service account to be hidden from other tenant, got %v", err)
+	}
+	if err := other.RevokeServiceAccount(created.ID); !errors.Is(err, ErrOtherTenant) {
+		t.Fatalf("expected other tenant not to revoke service account, got %v", err)
+	}
+}
@@ -0,0 +1,932 @@
+// Package store implements persistence of domain models in SQLite database.
+package store
+
+import (
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"go.uber.org/multierr"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+// Schema contains SQL statements needed to initialize database on first start
+//
+//go:embed schema.sql
+var Schema string
+
+// ErrRecordChanged is returned by updates of record that is no longer in
+// version caller expected, because someone else changed it meanwhile.
+var ErrRecordChanged = errors.New("record was changed")
+
+// DBManager provides access to domain models stored in database.
+type DBManager interface {
+	// UserByID returns user from database with provided ID.
+	UserByID(int) (model.User, error)
+
+	// UserByEmail returns user from database with provided email.
+	UserByEmail(string) (model.User, error)
+
+	// CreateUser inserts provided user as member of organization user is
+	// created in, and returns it with ID filled. Emails identify users, so
+	// creating user with email of existing one fails.
+	CreateUser(model.User) (model.User, error)
+
+	// Titles returns distinct titles users hold in organization with
+	// provided ID, or in any organization if ID is zero, ordered by name.
+	Titles(organizationID int) ([]string, error)
+
+	// OrganizationByID returns organization from database with provided ID.
+	OrganizationByID(int) (model.Organization, error)
+
+	// ExpenseByID returns expense from database with provided ID.
+	ExpenseByID(int) (model.Expense, error)
+
+	// CreateExpense inserts provided expense to database and returns new
+	// copy of expense that has all the same data but with ID field filled
+	// (since it is autogenerated)
+	CreateExpense(model.Expense) (model.Expense, error)
+
+	// CreateExpenses inserts all provided expenses in single transaction,
+	// either all of them are created or none. Returns expenses with IDs filled.
+	CreateExpenses([]model.Expense) ([]model.Expense, error)
+
+	// TransitionExpense moves expense to status provided event transitions
+	// to and records the event in expense history. Returns updated expense,
+	// ErrRecordChanged if expense is no longer in provided row version (zero
+	// accepts any), or model.ErrInvalidTransition if expense is no longer in
+	// status event transitions from.
+	TransitionExpense(event model.ExpenseEvent, rowVersion int) (model.Expense, error)
+
+	// ExpenseHistory returns all events of expense with provided ID, oldest first.
+	ExpenseHistory(int) ([]model.ExpenseEvent, error)
+
+	// ExpenseVersions returns snapshots of expense with provided ID taken
+	// after each of its changes, oldest first.
+	ExpenseVersions(int) ([]model.ExpenseVersion, error)
+
+	// ReportsTo reports if user with userID is direct or transitive report
+	// of user with managerID. Cycles in management chain are tolerated.
+	ReportsTo(userID, managerID int) (bool, error)
+
+	// ActiveDelegators returns IDs of users whose delegations to user with
+	// provided ID are active at provided time.
+	ActiveDelegators(delegateID int, at time.Time) ([]int, error)
+
+	// CreateDelegation inserts provided delegation and returns it with ID filled.
+	CreateDelegation(model.Delegation) (model.Delegation, error)
+
+	// ListExpenses returns expenses matching provided filter, ordered by ID.
+	ListExpenses(ExpenseFilter) ([]model.Expense, error)
+
+	// EachExpense calls fn for every expense matching provided filter,
+	// ordered by ID, and stops on first error fn returns. Expenses are
+	// loaded in batches, so large results are never held in memory at once.
+	EachExpense(ExpenseFilter, func(model.Expense) error) error
+
+	// CategoryByID returns category from database with provided ID.
+	CategoryByID(int) (model.Category, error)
+
+	// CategoriesByOrganization returns all categories of organization with
+	// provided ID, ordered by name.
+	CategoriesByOrganization(int) ([]model.Category, error)
+
+	// CreateCategory inserts provided category and returns it with ID filled.
+	CreateCategory(model.Category) (model.Category, error)
+
+	// ExpenseReportByID returns expense report with provided ID, with total
+	// of its expenses.
+	ExpenseReportByID(int) (model.ExpenseReport, error)
+
+	// CreateExpenseReport inserts provided report and returns it with ID
+	// filled. Reports without status are created as drafts.
+	CreateExpenseReport(model.ExpenseReport) (model.ExpenseReport, error)
+
+	// AddExpenseToReport makes expense with provided ID part of report, on
+	// behalf of user with userID. Only draft expenses that are not part of
+	// other report can be added.
+	AddExpenseToReport(reportID, expenseID, userID int) error
+
+	// TransitionExpenseReport moves report and all of its expenses to status
+	// provided event transitions to, recording the event for every expense.
+	// Returns model.ErrInvalidTransition if report or any of its expenses is
+	// no longer in status event transitions from.
+	TransitionExpenseReport(reportID int, event model.ExpenseEvent) (model.ExpenseReport, error)
+
+	// SpentInMonth returns total amount of expenses user submitted in month
+	// (UTC) of provided time, not counting drafts and rejected expenses.
+	SpentInMonth(userID int, month time.Time) (int, error)
+
+	// SoftDelete marks record of provided kind (e.g. KindExpense) as
+	// deleted, on behalf of user with userID. Returns ErrRecordChanged if
+	// record is no longer in provided row version, zero accepts any.
+	SoftDelete(kind string, id, userID, rowVersion int) error
+
+	// Restore undoes soft deletion of record of provided kind, on behalf of
+	// user with userID.
+	Restore(kind string, id, userID int) error
+
+	// DeletedRecords returns soft deleted records of provided kind that
+	// belong to organization with provided ID, or all if ID is zero.
+	DeletedRecords(kind string, organizationID int) ([]DeletedRecord, error)
+
+	// DeletedRecordByID returns soft deleted record of provided kind.
+	DeletedRecordByID(kind string, id int) (DeletedRecord, error)
+
+	// PurgeDeleted permanently removes records soft deleted before provided
+	// time, along with rows that only belong to them (e.g. memberships and
+	// sessions), and returns how many records were removed. Records other
+	// remaining rows still reference are kept until those are gone.
+	PurgeDeleted(before time.Time) (int, error)
+
+	// SpendingTotals returns sums and counts of expenses matching provided
+	// query, grouped as query requests and ordered by group key.
+	SpendingTotals(SpendingQuery) ([]SpendingTotal, error)
+
+	// CreateServiceAccount inserts provided service account with newly
+	// generated API key, and returns it with ID filled and the key. Only
+	// hash of the key is stored, so key can not be retrieved later.
+	CreateServiceAccount(model.ServiceAccount) (model.ServiceAccount, string, error)
+
+	// ServiceAccountByID returns service account with provided ID, revoked
+	// and expired included.
+	ServiceAccountByID(int) (model.ServiceAccount, error)
+
+	// ServiceAccountByKey returns service account provided API key belongs
+	// to, revoked and expired included.
+	ServiceAccountByKey(string) (model.ServiceAccount, error)
+
+	// ServiceAccounts returns all service accounts of organization with
+	// provided ID, ordered by ID.
+	ServiceAccounts(organizationID int) ([]model.ServiceAccount, error)
+
+	// RevokeServiceAccount makes API key of service account with provided
+	// ID unusable.
+	RevokeServiceAccount(int) error
+
+	// CreateSession inserts provided session of user with newly generated
+	// session token and CSRF token, and returns it with ID filled and the
+	// session token. Only hash of session token is stored.
+	CreateSession(model.Session) (model.Session, string, error)
+
+	// SessionByToken returns session provided token belongs to, revoked
+	// and expired included. Token replaced by rotation is accepted for
+	// RotatedTokenGrace after rotation.
+	SessionByToken(string) (model.Session, error)
+
+	// RotateSession replaces token of active session with new one and
+	// returns it. Provided token stops working after RotatedTokenGrace.
+	RotateSession(string) (string, error)
+
+	// RevokeSession ends session provided token belongs to, including
+	// token replaced by rotation while it is accepted.
+	RevokeSession(string) error
+
+	// RevokeUserSessions ends all active sessions of user with provided ID
+	// and returns how many were ended.
+	RevokeUserSessions(userID int) (int, error)
+
+	// RecordImpersonation inserts provided impersonated request to audit
+	// log and returns it with ID filled.
+	RecordImpersonation(model.Impersonation) (model.Impersonation, error)
+
+	// Impersonations returns audit log of impersonated requests in
+	// organization with provided ID, oldest first.
+	Impersonations(organizationID int) ([]model.Impersonation, error)
+}
+
+// ExpenseFilter narrows down expenses returned by ListExpenses, zero
+// fields do not filter.
+type ExpenseFilter struct {
+	OrganizationID int
+	CategoryID     int
+	ReportID       int
+}
+
+// SQLiteManager is DBManager backed by SQLite database.
+type SQLiteManager struct {
+	db *sql.DB
+}
+
+// NewDBManager returns an instance of SQLiteManager connected to a database
+// defined with provided dsn
+func NewDBManager(dsn string) (*SQLiteManager, error) {
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	return &SQLiteManager{db}, nil
+}
+
+// Migrate creates database schema, if it does not exist already, and
+// applies migrations database is missing.
+func (m *SQLiteManager) Migrate() error {
+	if err := m.RawExec(Schema); err != nil {
+		return err
+	}
+	return m.applyMigrations()
+}
+
+// RawExec is used for initialization (e.g. poor man's migration management)
+// or preparing data for tests
+func (m *SQLiteManager) RawExec(sql string) error {
+	if _, err := m.db.Exec(sql); err != nil {
+		return fmt.Errorf("failed to execute sql: %w", err)
+	}
+	return nil
+}
+
+// Close closes underlying database connection.
+func (m *SQLiteManager) Close() error {
+	return m.db.Close()
+}
+
+func (m *SQLiteManager) UserByEmail(forEmail string) (model.User, error) {
+	row := m.db.QueryRow(`SELECT id, email, title, organization_id, COALESCE(manager_id, 0) FROM users WHERE email = ? AND deleted_at IS NULL
+		AND organization_id NOT IN (SELECT id FROM organizations WHERE deleted_at IS NOT NULL)`, forEmail)
+	return m.constructUser(row)
+}
+
+func (m *SQLiteManager) UserByID(id int) (model.User, error) {
+	row := m.db.QueryRow(`SELECT id, email, title, organization_id, COALESCE(manager_id, 0) FROM users WHERE id = ? AND deleted_at IS NULL
+		AND organization_id NOT IN (SELECT id FROM organizations WHERE deleted_at IS NOT NULL)`, id)
+	return m.constructUser(row)
+}
+
+func (m *SQLiteManager) CreateUser(in model.User) (model.User, error) {
+	// membership in organization user is created in is added by trigger
+	res, err := m.db.Exec(`INSERT INTO users (email, title, organization_id)
+		SELECT ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM users WHERE email = ? AND deleted_at IS NULL)`,
+		in.Email, in.Title, in.OrganizationID, in.Email)
+	if err != nil {
+		return model.User{}, err
+	}
+	if affected, err := res.RowsAffected(); err != nil {
+		return model.User{}, err
+	} else if affected == 0 {
+		return model.User{}, fmt.Errorf("user with email %s already exists", in.Email)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return model.User{}, err
+	}
+	return m.UserByID(int(id))
+}
+
+func (m *SQLiteManager) constructUser(row scanner) (model.User, error) {
+	user, err := scanUser(row)
+	switch err {
+	case sql.ErrNoRows:
+		return model.User{}, fmt.Errorf("no user found for selected criteria")
+	case nil:
+	default:
+		return model.User{}, err // unknown error, just propagate
+	}
+
+	if user.Memberships, err = m.memberships(user.ID); err != nil {
+		return model.User{}, err
+	}
+	return user, nil
+}
+
+// memberships returns memberships of user with provided ID, except in
+// deleted organizations.
+func (m *SQLiteManager) memberships(userID int) ([]model.Membership, error) {
+	rows, err := m.db.Query(`SELECT organization_id, title FROM memberships
+		WHERE user_id = ? AND organization_id NOT IN (SELECT id FROM organizations WHERE deleted_at IS NOT NULL)
+		ORDER BY organization_id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	memberships := []model.Membership{}
+	for rows.Next() {
+		var membership model.Membership
+		if err := rows.Scan(&membership.OrganizationID, &membership.Title); err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, membership)
+	}
+	return memberships, rows.Err()
+}
+
+func (m *SQLiteManager) Titles(organizationID int) ([]string, error) {
+	// like memberships of users, those in deleted organizations are ignored
+	query := `SELECT DISTINCT memberships.title FROM memberships JOIN users ON users.id = memberships.user_id
+		WHERE users.deleted_at IS NULL
+		AND memberships.organization_id NOT IN (SELECT id FROM organizations WHERE deleted_at IS NOT NULL)`
+	var args []interface{}
+	if organizationID != 0 {
+		query += ` AND memberships.organization_id = ?`
+		args = append(args, organizationID)
+	}
+	rows, err := m.db.Query(query+` ORDER BY memberships.title`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	titles := []string{}
+	for rows.Next() {
+		var title string
+		if err := rows.Scan(&title); err != nil {
+			return nil, err
+		}
+		titles = append(titles, title)
+	}
+	return titles, rows.Err()
+}
+
+func scanUser(row scanner) (model.User, error) {
+	var id int
+	var email string
+	var title string
+	var organizationID int
+	var managerID int
+
+	if err := row.Scan(&id, &email, &title, &organizationID, &managerID); err != nil {
+		return model.User{}, err
+	}
+	return model.User{
+		ID:             id,
+		Email:          email,
+		Title:          title,
+		OrganizationID: organizationID,
+		ManagerID:      managerID,
+	}, nil
+}
+
+func (m *SQLiteManager) OrganizationByID(forID int) (model.Organization, error) {
+	row := m.db.QueryRow(`SELECT id, name, row_version FROM organizations WHERE id = ? AND deleted_at IS NULL`, forID)
+
+	switch organization, err := scanOrganization(row); err {
+	case sql.ErrNoRows:
+		return model.Organization{}, fmt.Errorf("no organization for ID %d", forID)
+	case nil:
+		return organization, nil
+	default:
+		return model.Organization{}, err // unknown error, just propagate
+	}
+}
+
+func scanOrganization(row scanner) (model.Organization, error) {
+	var id int
+	var name string
+	var rowVersion int
+
+	if err := row.Scan(&id, &name, &rowVersion); err != nil {
+		return model.Organization{}, err
+	}
+	return model.Organization{
+		ID:         id,
+		Name:       name,
+		RowVersion: rowVersion,
+	}, nil
+}
+
+// expenseQuery selects expenses with columns scanExpense expects, category
+// name is joined so policies can reference it.
+const expenseQuery = `SELECT ` + expenseColumns + ` FROM ` + expenseTables
+
+const expenseColumns = `expenses.id, user_id, amount, description, COALESCE(expenses.organization_id, 0), status,
+	COALESCE(category_id, 0), COALESCE(categories.name, ''), COALESCE(report_id, 0), expenses.created_at, expenses.row_version`
+
+const expenseTables = `expenses LEFT JOIN categories ON categories.id = expenses.category_id`
+
+// expenseOrganizationLive excludes expenses of deleted organizations.
+const expenseOrganizationLive = `COALESCE(expenses.organization_id, 0) NOT IN (SELECT id FROM organizations WHERE deleted_at IS NOT NULL)`
+
+// scanner is implemented by both *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func (m *SQLiteManager) ExpenseByID(forID int) (model.Expense, error) {
+	row := m.db.QueryRow(expenseQuery+` WHERE expenses.id = ? AND expenses.deleted_at IS NULL AND `+expenseOrganizationLive, forID)
+	return m.constructExpense(row, forID)
+}
+
+func (m *SQLiteManager) constructExpense(row scanner, forID int) (model.Expense, error) {
+	switch expense, err := scanExpense(row); err {
+	case sql.ErrNoRows:
+		return model.Expense{}, fmt.Errorf("no expense for ID %d", forID)
+	case nil:
+		return expense, nil
+	default:
+		return model.Expense{}, err // unknown error, just propagate
+	}
+}
+
+func scanExpense(row scanner) (model.Expense, error) {
+	var id int
+	var userID int
+	var amount int
+	var description string
+	var organizationID int
+	var status string
+	var categoryID int
+	var category string
+	var reportID int
+	var createdAt sql.NullTime
+	var rowVersion int
+
+	err := row.Scan(&id, &userID, &amount, &description, &organizationID, &status, &categoryID, &category, &reportID, &createdAt, &rowVersion)
+	if err != nil {
+		return model.Expense{}, err
+	}
+	return model.Expense{
+		ID:             id,
+		UserID:         userID,
+		Amount:         amount,
+		Description:    description,
+		OrganizationID: organizationID,
+		Status:         model.ExpenseStatus(status),
+		CategoryID:     categoryID,
+		Category:       category,
+		ReportID:       reportID,
+		CreatedAt:      createdAt.Time,
+		RowVersion:     rowVersion,
+	}, nil
+}
+
+func (m *SQLiteManager) ListExpenses(filter ExpenseFilter) ([]model.Expense, error) {
+	return m.listExpenses(filter, 0, -1)
+}
+
+// exportBatchSize is number of expenses EachExpense loads at once.
+const exportBatchSize = 500
+
+func (m *SQLiteManager) EachExpense(filter ExpenseFilter, fn func(model.Expense) error) error {
+	afterID := 0
+	for {
+		// batch is fully read before fn is called, so fn can use database
+		batch, err := m.listExpenses(filter, afterID, exportBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, expense := range batch {
+			if err := fn(expense); err != nil {
+				return err
+			}
+		}
+		if len(batch) < exportBatchSize {
+			return nil
+		}
+		afterID = batch[len(batch)-1].ID
+	}
+}
+
+// listExpenses returns at most limit (negative for no limit) expenses
+// matching filter with ID greater than afterID, ordered by ID.
+func (m *SQLiteManager) listExpenses(filter ExpenseFilter, afterID, limit int) ([]model.Expense, error) {
+	where := []string{`expenses.id > ?`, `expenses.deleted_at IS NULL`, expenseOrganizationLive}
+	args := []interface{}{afterID}
+	if filter.OrganizationID != 0 {
+		where = append(where, `expenses.organization_id = ?`)
+		args = append(args, filter.OrganizationID)
+	}
+	if filter.CategoryID != 0 {
+		where = append(where, `category_id = ?`)
+		args = append(args, filter.CategoryID)
+	}
+	if filter.ReportID != 0 {
+		where = append(where, `report_id = ?`)
+		args = append(args, filter.ReportID)
+	}
+	query := expenseQuery + ` WHERE ` + strings.Join(where, ` AND `)
+
+	rows, err := m.db.Query(query+` ORDER BY expenses.id LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	expenses := []model.Expense{}
+	for rows.Next() {
+		expense, err := scanExpense(rows)
+		if err != nil {
+			return nil, err
+		}
+		expenses = append(expenses, expense)
+	}
+	return expenses, rows.Err()
+}
+
+func (m *SQLiteManager) CategoryByID(forID int) (model.Category, error) {
+	var category model.Category
+	row := m.db.QueryRow(`SELECT id, organization_id, name FROM categories WHERE id = ?`, forID)
+	switch err := row.Scan(&category.ID, &category.OrganizationID, &category.Name); err {
+	case sql.ErrNoRows:
+		return model.Category{}, fmt.Errorf("no category for ID %d", forID)
+	case nil:
+		return category, nil
+	default:
+		return model.Category{}, err // unknown error, just propagate
+	}
+}
+
+func (m *SQLiteManager) CategoriesByOrganization(organizationID int) ([]model.Category, error) {
+	rows, err := m.db.Query(`SELECT id, organization_id, name FROM categories WHERE organization_id = ? ORDER BY name`, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []model.Category{}
+	for rows.Next() {
+		var category model.Category
+		if err := rows.Scan(&category.ID, &category.OrganizationID, &category.Name); err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+	return categories, rows.Err()
+}
+
+func (m *SQLiteManager) CreateCategory(in model.Category) (model.Category, error) {
+	res, err := m.db.Exec(`INSERT INTO categories (organization_id, name) VALUES (?, ?)`, in.OrganizationID, in.Name)
+	if err != nil {
+		return model.Category{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return model.Category{}, err
+	}
+	in.ID = int(id)
+	return in, nil
+}
+
+// CreateExpense inserts expense and records its creation in expense
+// history. Expenses without status are created as submitted.
+func (m *SQLiteManager) CreateExpense(in model.Expense) (model.Expense, error) {
+	created, err := m.CreateExpenses([]model.Expense{in})
+	if err != nil {
+		return model.Expense{}, err
+	}
+	return created[0], nil
+}
+
+func (m *SQLiteManager) CreateExpenses(in []model.Expense) (e []model.Expense, err error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			rollbackErr := tx.Rollback()
+			if rollbackErr != nil {
+				err = multierr.Combine(err, rollbackErr)
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	created := make([]model.Expense, 0, len(in))
+	for _, expense := range in {
+		expense, err := insertExpense(tx, expense)
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, expense)
+	}
+	return created, nil
+}
+
+// insertExpense inserts expense and records its creation in history.
+func insertExpense(tx *sql.Tx, in model.Expense) (model.Expense, error) {
+	if in.Status == "" {
+		in.Status = model.StatusSubmitted
+	}
+	// without monotonic clock reading, so it equals time read back
+	in.CreatedAt = time.Now().UTC().Round(0)
+	// zero category is stored as NULL, so it does not violate foreign key
+	var categoryID interface{}
+	if in.CategoryID != 0 {
+		categoryID = in.CategoryID
+	}
+	res, err := tx.Exec(`INSERT INTO expenses (amount, description, user_id, organization_id, status, category_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		in.Amount, in.Description, in.UserID, in.OrganizationID, in.Status, categoryID, in.CreatedAt)
+	if err != nil {
+		return model.Expense{}, err
+	}
+	expenseID, err := res.LastInsertId()
+	if err != nil {
+		return model.Expense{}, err
+	}
+	in.ID = int(expenseID)
+	// rows start at version 1, as set by default of column
+	in.RowVersion = 1
+
+	err = insertEvent(tx, model.ExpenseEvent{
+		ExpenseID: in.ID,
+		UserID:    in.UserID,
+		Action:    model.ActionCreate,
+		To:        in.Status,
+		CreatedAt: in.CreatedAt,
+	})
+	if err != nil {
+		return model.Expense{}, err
+	}
+	if err := insertVersion(tx, in.ID, in.UserID, in.CreatedAt); err != nil {
+		return model.Expense{}, err
+	}
+	return in, nil
+}
+
+func (m *SQLiteManager) TransitionExpense(event model.ExpenseEvent, rowVersion int) (e model.Expense, err error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return model.Expense{}, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = multierr.Append(err, tx.Rollback())
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	// status and version are checked again in update, in case expense was
+	// changed after caller loaded it
+	res, err := tx.Exec(`UPDATE expenses SET status = ?, row_version = row_version + 1 WHERE id = ? AND status = ? AND deleted_at IS NULL AND (? = 0 OR row_version = ?)`,
+		event.To, event.ExpenseID, event.From, rowVersion, rowVersion)
+	if err != nil {
+		return model.Expense{}, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return model.Expense{}, err
+	}
+	if affected == 0 {
+		if err := expectVersion(tx, "expenses", event.ExpenseID, rowVersion); err != nil {
+			return model.Expense{}, err
+		}
+		return model.Expense{}, fmt.Errorf("%w: expense %d is not %s", model.ErrInvalidTransition, event.ExpenseID, event.From)
+	}
+	if err := insertEvent(tx, event); err != nil {
+		return model.Expense{}, err
+	}
+	if err := insertVersion(tx, event.ExpenseID, event.UserID, event.CreatedAt); err != nil {
+		return model.Expense{}, err
+	}
+
+	row := tx.QueryRow(expenseQuery+` WHERE expenses.id = ?`, event.ExpenseID)
+	return m.constructExpense(row, event.ExpenseID)
+}
+
+func (m *SQLiteManager) ExpenseHistory(expenseID int) ([]model.ExpenseEvent, error) {
+	rows, err := m.db.Query(`SELECT id, expense_id, user_id, action, "from", "to", created_at FROM expense_events WHERE expense_id = ? ORDER BY id`, expenseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []model.ExpenseEvent{}
+	for rows.Next() {
+		var e model.ExpenseEvent
+		var from, to string
+		if err := rows.Scan(&e.ID, &e.ExpenseID, &e.UserID, &e.Action, &from, &to, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.From, e.To = model.ExpenseStatus(from), model.ExpenseStatus(to)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (m *SQLiteManager) ReportsTo(userID, managerID int) (bool, error) {
+	// UNION (unlike UNION ALL) drops rows already in chain, which stops
+	// recursion if management chain has a cycle
+	row := m.db.QueryRow(`
+		WITH RECURSIVE chain(id) AS (
+			SELECT manager_id FROM users WHERE id = ?
+			UNION
+			SELECT users.manager_id FROM users JOIN chain ON users.id = chain.id
+		)
+		SELECT EXISTS (SELECT 1 FROM chain WHERE id = ?)`, userID, managerID)
+
+	var reports bool
+	if err := row.Scan(&reports); err != nil {
+		return false, err
+	}
+	return reports, nil
+}
+
+func (m *SQLiteManager) ActiveDelegators(delegateID int, at time.Time) ([]int, error) {
+	rows, err := m.db.Query(`SELECT DISTINCT delegator_id FROM delegations WHERE delegate_id = ? AND starts_at <= ? AND ends_at > ?`,
+		delegateID, at.UTC(), at.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	delegators := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		delegators = append(delegators, id)
+	}
+	return delegators, rows.Err()
+}
+
+func (m *SQLiteManager) CreateDelegation(in model.Delegation) (model.Delegation, error) {
+	res, err := m.db.Exec(`INSERT INTO delegations (delegator_id, delegate_id, starts_at, ends_at) VALUES (?, ?, ?, ?)`,
+		in.DelegatorID, in.DelegateID, in.StartsAt.UTC(), in.EndsAt.UTC())
+	if err != nil {
+		return model.Delegation{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return model.Delegation{}, err
+	}
+	in.ID = int(id)
+	return in, nil
+}
+
+func (m *SQLiteManager) SpentInMonth(userID int, month time.Time) (int, error) {
+	month = month.UTC()
+	start := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+
+	// expense is counted in month it was submitted in, according to history
+	row := m.db.QueryRow(`
+		SELECT COALESCE(SUM(amount), 0) FROM expenses
+		WHERE user_id = ? AND deleted_at IS NULL
+		AND status IN (?, ?, ?)
+		AND EXISTS (
+			SELECT 1 FROM expense_events
+			WHERE expense_id = expenses.id AND "to" = ? AND created_at >= ? AND created_at < ?
+		)`,
+		userID, model.StatusSubmitted, model.StatusApproved, model.StatusReimbursed,
+		model.StatusSubmitted, start, end)
+
+	var total int
+	if err := row.Scan(&total); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// expenseReportQuery selects reports with total amount of their expenses.
+const expenseReportQuery = `SELECT expense_reports.id, expense_reports.user_id, expense_reports.organization_id, title,
+	expense_reports.status, COALESCE(SUM(expenses.amount), 0)
+	FROM expense_reports LEFT JOIN expenses ON expenses.report_id = expense_reports.id AND expenses.deleted_at IS NULL
+	WHERE expense_reports.id = ?
+	AND expense_reports.organization_id NOT IN (SELECT id FROM organizations WHERE deleted_at IS NOT NULL)
+	GROUP BY expense_reports.id`
+
+func (m *SQLiteManager) ExpenseReportByID(forID int) (model.ExpenseReport, error) {
+	return constructExpenseReport(m.db.QueryRow(expenseReportQuery, forID), forID)
+}
+
+func constructExpenseReport(row scanner, forID int) (model.ExpenseReport, error) {
+	var report model.ExpenseReport
+	var status string
+
+	switch err := row.Scan(&report.ID, &report.UserID, &report.OrganizationID, &report.Title, &status, &report.Total); err {
+	case sql.ErrNoRows:
+		return model.ExpenseReport{}, fmt.Errorf("no expense report for ID %d", forID)
+	case nil:
+		report.Status = model.ExpenseStatus(status)
+		return report, nil
+	default:
+		return model.ExpenseReport{}, err // unknown error, just propagate
+	}
+}
+
+func (m *SQLiteManager) CreateExpenseReport(in model.ExpenseReport) (model.ExpenseReport, error) {
+	if in.Status == "" {
+		in.Status = model.StatusDraft
+	}
+	res, err := m.db.Exec(`INSERT INTO expense_reports (user_id, organization_id, title, status) VALUES (?, ?, ?, ?)`,
+		in.UserID, in.OrganizationID, in.Title, in.Status)
+	if err != nil {
+		return model.ExpenseReport{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return model.ExpenseReport{}, err
+	}
+	in.ID = int(id)
+	return in, nil
+}
+
+func (m *SQLiteManager) AddExpenseToReport(reportID, expenseID, userID int) (err error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			err = multierr.Append(err, tx.Rollback())
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	res, err := tx.Exec(`UPDATE expenses SET report_id = ?, row_version = row_version + 1 WHERE id = ? AND report_id IS NULL AND status = ? AND deleted_at IS NULL`,
+		reportID, expenseID, model.StatusDraft)
+	if err != nil {
+		return err
+	}
+	if err := expectAffected(res, fmt.Errorf("expense %d is not a draft outside of reports", expenseID)); err != nil {
+		return err
+	}
+	return insertVersion(tx, expenseID, userID, time.Time{})
+}
+
+func (m *SQLiteManager) TransitionExpenseReport(reportID int, event model.ExpenseEvent) (r model.ExpenseReport, err error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return model.ExpenseReport{}, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = multierr.Append(err, tx.Rollback())
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	res, err := tx.Exec(`UPDATE expense_reports SET status = ? WHERE id = ? AND status = ?`, event.To, reportID, event.From)
+	if err != nil {
+		return model.ExpenseReport{}, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return model.ExpenseReport{}, err
+	}
+	if affected == 0 {
+		return model.ExpenseReport{}, fmt.Errorf("%w: report %d is not %s", model.ErrInvalidTransition, reportID, event.From)
+	}
+
+	rows, err := tx.Query(`SELECT id, status FROM expenses WHERE report_id = ? AND deleted_at IS NULL`, reportID)
+	if err != nil {
+		return model.ExpenseReport{}, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		var status string
+		if err := rows.Scan(&id, &status); err != nil {
+			_ = rows.Close()
+			return model.ExpenseReport{}, err
+		}
+		if model.ExpenseStatus(status) != event.From {
+			_ = rows.Close()
+			return model.ExpenseReport{}, fmt.Errorf("%w: expense %d in report is not %s", model.ErrInvalidTransition, id, event.From)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return model.ExpenseReport{}, err
+	}
+	if err := rows.Close(); err != nil {
+		return model.ExpenseReport{}, err
+	}
+
+	for _, id := range ids {
+		if _, err := tx.Exec(`UPDATE expenses SET status = ?, row_version = row_version + 1 WHERE id = ?`, event.To, id); err != nil {
+			return model.ExpenseReport{}, err
+		}
+		event.ExpenseID = id
+		if err := insertEvent(tx, event); err != nil {
+			return model.ExpenseReport{}, err
+		}
+		if err := insertVersion(tx, id, event.UserID, event.CreatedAt); err != nil {
+			return model.ExpenseReport{}, err
+		}
+	}
+
+	return constructExpenseReport(tx.QueryRow(expenseReportQuery, reportID), reportID)
+}
+
+// insertEvent records event in expense history, creation time is set to
+// now unless event has it set.
+func insertEvent(tx *sql.Tx, event model.ExpenseEvent) error {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
+	}
+	_, err := tx.Exec(`INSERT INTO expense_events (expense_id, user_id, action, "from", "to", created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		event.ExpenseID, event.UserID, event.Action, event.From, event.To, event.CreatedAt)
+	return err
+}
+
+// build time guarantee that SQLiteManager implement DBManager
+var _ DBManager = &SQLiteManager{}
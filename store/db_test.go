@@ -0,0 +1,615 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+func getDBManager(t *testing.T, dataFiles ...string) *SQLiteManager {
+	t.Helper()
+	manager, err := NewDBManager(":memory:")
+	if err != nil {
+		t.Fatalf("failed to create db instance: %v", err)
+	}
+
+	// read schema file and execute it always
+	// this also checks that schema.sql is in good shape, since during
+	// the build it is only embedded
+	schema, err := os.ReadFile("schema.sql")
+	if err != nil {
+		t.Fatalf("failed to read sql schema file")
+		return nil
+	}
+	if err := manager.RawExec(string(schema)); err != nil {
+		t.Fatalf("failed to crate db schema: %v", err)
+		return nil
+	}
+	if err := manager.applyMigrations(); err != nil {
+		t.Fatalf("failed to migrate db schema: %v", err)
+	}
+
+	// load all provided data files
+	for _, dataFile := range dataFiles {
+		data, err := os.ReadFile(dataFile)
+		if err != nil {
+			t.Fatalf("unable to read datafile %q: %v", dataFile, err)
+		}
+		if err := manager.RawExec(string(data)); err != nil {
+			t.Fatalf("failed to execute data file: %v", err)
+		}
+	}
+	return manager
+}
+
+func TestDBManager_UserByID(t *testing.T) {
+	manager := getDBManager(t, "storetest/fixture.sql")
+
+	data := []struct {
+		id           int
+		expectToFind bool
+	}{
+		{1, true},
+		{99, false},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(fmt.Sprintf("%d - %v", d.id, d.expectToFind), func(t *testing.T) {
+			u, err := manager.UserByID(d.id)
+			if d.expectToFind {
+				if err != nil {
+					t.Fatalf("expected to find user, but did not get one")
+					return
+				}
+				// sanity check that we got the same user ID we asked for
+				if u.ID != d.id {
+					t.Fatalf("unexpected user ID, got: %d, expected: %d", u.ID, d.id)
+				}
+			} else {
+				if err == nil {
+					t.Fatalf("did not expect to find user, but got: %v", u)
+				}
+			}
+
+		})
+	}
+}
+
+func TestDBManager_ExpenseWorkflow(t *testing.T) {
+	manager := getDBManager(t, "storetest/fixture.sql")
+
+	expense, err := manager.CreateExpense(model.Expense{UserID: 1, OrganizationID: 1, Amount: 100, Status: model.StatusDraft})
+	if err != nil {
+		t.Fatalf("failed to create expense: %v", err)
+	}
+
+	submit := model.ExpenseEvent{ExpenseID: expense.ID, UserID: 1, Action: model.ActionSubmit, From: model.StatusDraft, To: model.StatusSubmitted}
+	updated, err := manager.TransitionExpense(submit, expense.RowVersion)
+	if err != nil {
+		t.Fatalf("failed to submit expense: %v", err)
+	}
+	if updated.Status != model.StatusSubmitted || updated.OrganizationID != 1 {
+		t.Fatalf("unexpected expense after transition: %+v", updated)
+	}
+
+	// expense is no longer in version it was loaded in
+	if _, err := manager.TransitionExpense(submit, expense.RowVersion); !errors.Is(err, ErrRecordChanged) {
+		t.Fatalf("expected record changed error, got: %v", err)
+	}
+	// expense is no longer draft, the same transition must fail
+	if _, err := manager.TransitionExpense(submit, updated.RowVersion); !errors.Is(err, model.ErrInvalidTransition) {
+		t.Fatalf("expected invalid transition error, got: %v", err)
+	}
+
+	history, err := manager.ExpenseHistory(expense.ID)
+	if err != nil {
+		t.Fatalf("failed to get expense history: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected 2 events, got: %+v", history)
+	}
+	if history[0].Action != model.ActionCreate || history[0].To != model.StatusDraft {
+		t.Fatalf("unexpected creation event: %+v", history[0])
+	}
+	if history[1].Action != model.ActionSubmit || history[1].From != model.StatusDraft || history[1].CreatedAt.IsZero() {
+		t.Fatalf("unexpected submit event: %+v", history[1])
+	}
+}
+
+func TestDBManager_MigrateExistingExpenses(t *testing.T) {
+	manager, err := NewDBManager(":memory:")
+	if err != nil {
+		t.Fatalf("failed to create db instance: %v", err)
+	}
+	defer manager.Close()
+
+	// database created before migrations existed
+	if err := manager.RawExec(Schema); err != nil {
+		t.Fatalf("failed to crate db schema: %v", err)
+	}
+	if err := manager.RawExec(`INSERT INTO organizations (id, name) VALUES (3, 'Old Org');
+		INSERT INTO users (id, email, title, organization_id) VALUES (1, 'test@example.com', 'developer', 3);
+		INSERT INTO expenses (id, user_id, amount, description) VALUES (1, 1, 100, 'lunch');`); err != nil {
+		t.Fatalf("failed to insert data: %v", err)
+	}
+
+	// migrating twice must be safe
+	for i := 0; i < 2; i++ {
+		if err := manager.Migrate(); err != nil {
+			t.Fatalf("failed to migrate: %v", err)
+		}
+	}
+
+	expense, err := manager.ExpenseByID(1)
+	if err != nil {
+		t.Fatalf("failed to get expense: %v", err)
+	}
+	// creation time is unknown, since expense has no history
+	if expense.Status != model.StatusSubmitted || expense.OrganizationID != 3 || !expense.CreatedAt.IsZero() {
+		t.Fatalf("unexpected migrated expense: %+v", expense)
+	}
+
+	versions, err := manager.ExpenseVersions(1)
+	if err != nil {
+		t.Fatalf("failed to get versions: %v", err)
+	}
+	if len(versions) != 1 || versions[0].UserID != 1 || versions[0].Expense.Amount != 100 {
+		t.Fatalf("expected initial version of existing expense, got: %+v", versions)
+	}
+
+	categories, err := manager.CategoriesByOrganization(3)
+	if err != nil {
+		t.Fatalf("failed to list categories: %v", err)
+	}
+	if len(categories) != 4 {
+		t.Fatalf("expected default categories for existing organization, got: %v", categories)
+	}
+
+	user, err := manager.UserByID(1)
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	if !reflect.DeepEqual(user.Memberships, []model.Membership{{OrganizationID: 3, Title: "developer"}}) {
+		t.Fatalf("expected membership in existing organization, got: %+v", user.Memberships)
+	}
+}
+
+func TestDBManager_Memberships(t *testing.T) {
+	manager := getDBManager(t, "storetest/fixture.sql")
+	if err := manager.RawExec(`INSERT INTO organizations ("id", "name") VALUES (2, 'Client'), (3, 'Deleted Client');
+		UPDATE organizations SET deleted_at = CURRENT_TIMESTAMP WHERE id = 3;
+		INSERT INTO memberships ("user_id", "organization_id", "title") VALUES (1, 3, 'admin'), (1, 2, 'accountant');`); err != nil {
+		t.Fatalf("failed to insert data: %v", err)
+	}
+
+	user, err := manager.UserByEmail("test@example.com")
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	// users are members of organization they are created in, memberships
+	// in deleted organizations are ignored
+	expected := []model.Membership{{OrganizationID: 1, Title: "developer"}, {OrganizationID: 2, Title: "accountant"}}
+	if !reflect.DeepEqual(user.Memberships, expected) {
+		t.Fatalf("unexpected memberships: %+v", user.Memberships)
+	}
+	if user.OrganizationID != 1 || user.Title != "developer" {
+		t.Fatalf("expected user acting in own organization, got: %+v", user)
+	}
+
+	client, ok := user.InOrganization(2)
+	if !ok || client.OrganizationID != 2 || client.Title != "accountant" {
+		t.Fatalf("unexpected user acting in client organization: %+v, %v", client, ok)
+	}
+	if _, ok := user.InOrganization(3); ok {
+		t.Fatalf("expected user not to act in deleted organization")
+	}
+
+	// other tenants see members acting in their organization
+	member, err := ForTenant(manager, 2).UserByID(1)
+	if err != nil || member.OrganizationID != 2 || member.Title != "accountant" {
+		t.Fatalf("unexpected member of tenant: %+v, %v", member, err)
+	}
+	if err := ForTenant(manager, 2).SoftDelete(KindUser, 1, 1, 0); !errors.Is(err, ErrOtherTenant) {
+		t.Fatalf("expected members to be deleted only by their own organization, got: %v", err)
+	}
+
+	// titles are those users hold in organizations that are not deleted
+	if titles, err := manager.Titles(0); err != nil || !reflect.DeepEqual(titles, []string{"accountant", "developer"}) {
+		t.Fatalf("unexpected titles: %v, %v", titles, err)
+	}
+	if titles, err := ForTenant(manager, 2).Titles(0); err != nil || !reflect.DeepEqual(titles, []string{"accountant"}) {
+		t.Fatalf("unexpected titles of tenant: %v, %v", titles, err)
+	}
+	if _, err := ForTenant(manager, 2).Titles(1); !errors.Is(err, ErrOtherTenant) {
+		t.Fatalf("expected tenant not to read titles of other organization, got: %v", err)
+	}
+}
+
+func TestDBManager_CreateUser(t *testing.T) {
+	manager := getDBManager(t, "storetest/fixture.sql")
+
+	created, err := manager.CreateUser(model.User{Email: "new@example.com", Title: "accountant", OrganizationID: 1})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	expected := []model.Membership{{OrganizationID: 1, Title: "accountant"}}
+	if created.ID == 0 || created.Email != "new@example.com" || !reflect.DeepEqual(created.Memberships, expected) {
+		t.Fatalf("unexpected user: %+v", created)
+	}
+	if _, err := manager.CreateUser(model.User{Email: "new@example.com", Title: "developer", OrganizationID: 1}); err == nil {
+		t.Fatalf("expected error creating user with existing email")
+	}
+	if _, err := ForTenant(manager, 2).CreateUser(model.User{Email: "other@example.com", OrganizationID: 1}); !errors.Is(err, ErrOtherTenant) {
+		t.Fatalf("expected tenant not to create users in other organization, got: %v", err)
+	}
+}
+
+func TestDBManager_ReportsTo(t *testing.T) {
+	manager := getDBManager(t, "storetest/fixture.sql")
+	// 2 reports to 3, 3 reports to 4, 5 and 6 report to each other
+	if err := manager.RawExec(`
+		INSERT INTO users (id, email, title, organization_id, manager_id) VALUES (4, 'ceo@example.com', 'ceo', 1, NULL);
+		INSERT INTO users (id, email, title, organization_id, manager_id) VALUES (3, 'cto@example.com', 'cto', 1, 4);
+		INSERT INTO users (id, email, title, organization_id, manager_id) VALUES (2, 'dev@example.com', 'developer', 1, 3);
+		INSERT INTO users (id, email, title, organization_id, manager_id) VALUES (5, 'a@example.com', 'developer', 1, 6);
+		INSERT INTO users (id, email, title, organization_id, manager_id) VALUES (6, 'b@example.com', 'developer', 1, 5);`); err != nil {
+		t.Fatalf("failed to insert users: %v", err)
+	}
+
+	data := []struct {
+		user, manager int
+		reports       bool
+	}{
+		{2, 3, true},
+		{2, 4, true},
+		{3, 4, true},
+		{4, 2, false},
+		{3, 2, false},
+		{1, 4, false},
+		{5, 6, true},
+		{5, 5, true},
+		{5, 4, false},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(fmt.Sprintf("%d reports to %d", d.user, d.manager), func(t *testing.T) {
+			reports, err := manager.ReportsTo(d.user, d.manager)
+			if err != nil {
+				t.Fatalf("failed to check reports: %v", err)
+			}
+			if reports != d.reports {
+				t.Fatalf("unexpected result, got: %v, expected: %v", reports, d.reports)
+			}
+		})
+	}
+
+	user, err := manager.UserByID(2)
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	if user.ManagerID != 3 {
+		t.Fatalf("unexpected manager ID: %d", user.ManagerID)
+	}
+}
+
+func TestDBManager_ActiveDelegators(t *testing.T) {
+	manager := getDBManager(t, "storetest/fixture.sql")
+	now := time.Now()
+
+	delegations := []model.Delegation{
+		{DelegatorID: 2, DelegateID: 1, StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour)},
+		{DelegatorID: 3, DelegateID: 1, StartsAt: now.Add(time.Hour), EndsAt: now.Add(2 * time.Hour)},
+		{DelegatorID: 4, DelegateID: 1, StartsAt: now.Add(-2 * time.Hour), EndsAt: now.Add(-time.Hour)},
+		{DelegatorID: 5, DelegateID: 6, StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour)},
+	}
+	for _, d := range delegations {
+		if _, err := manager.CreateDelegation(d); err != nil {
+			t.Fatalf("failed to create delegation: %v", err)
+		}
+	}
+
+	delegators, err := manager.ActiveDelegators(1, now)
+	if err != nil {
+		t.Fatalf("failed to get delegators: %v", err)
+	}
+	if len(delegators) != 1 || delegators[0] != 2 {
+		t.Fatalf("unexpected delegators: %v", delegators)
+	}
+}
+
+func TestDBManager_SpentInMonth(t *testing.T) {
+	manager := getDBManager(t, "storetest/fixture.sql")
+
+	expenses := []model.Expense{
+		{UserID: 1, Amount: 100, Status: model.StatusSubmitted},
+		{UserID: 1, Amount: 200, Status: model.StatusSubmitted},
+		{UserID: 1, Amount: 400, Status: model.StatusDraft},
+		{UserID: 2, Amount: 800, Status: model.StatusSubmitted},
+	}
+	var created []model.Expense
+	for _, e := range expenses {
+		c, err := manager.CreateExpense(e)
+		if err != nil {
+			t.Fatalf("failed to create expense: %v", err)
+		}
+		created = append(created, c)
+	}
+	// rejected expenses are not counted
+	_, err := manager.TransitionExpense(model.ExpenseEvent{
+		ExpenseID: created[1].ID, UserID: 2, Action: model.ActionReject, From: model.StatusSubmitted, To: model.StatusRejected,
+	}, 0)
+	if err != nil {
+		t.Fatalf("failed to reject expense: %v", err)
+	}
+
+	now := time.Now().UTC()
+	// last day of previous month, AddDate(0, -1, 0) normalizes e.g. March 31 to March 3
+	lastMonth := now.AddDate(0, 0, -now.Day())
+
+	data := []struct {
+		name  string
+		user  int
+		month time.Time
+		total int
+	}{
+		{"current month", 1, now, 100},
+		{"previous month", 1, lastMonth, 0},
+		{"other user", 2, time.Now(), 800},
+		{"user without expenses", 3, time.Now(), 0},
+	}
+	for _, d := range data {
+		d := d
+		t.Run(d.name, func(t *testing.T) {
+			total, err := manager.SpentInMonth(d.user, d.month)
+			if err != nil {
+				t.Fatalf("failed to get total: %v", err)
+			}
+			if total != d.total {
+				t.Fatalf("unexpected total, got: %d, expected: %d", total, d.total)
+			}
+		})
+	}
+}
+
+func TestDBManager_Categories(t *testing.T) {
+	manager := getDBManager(t, "storetest/fixture.sql")
+
+	// fixture has travel, meals, equipment and software categories
+	if _, err := manager.CreateCategory(model.Category{OrganizationID: 1, Name: "travel"}); err == nil {
+		t.Fatalf("expected duplicate category to fail")
+	}
+	parking, err := manager.CreateCategory(model.Category{OrganizationID: 1, Name: "parking"})
+	if err != nil {
+		t.Fatalf("failed to create category: %v", err)
+	}
+
+	categories, err := manager.CategoriesByOrganization(1)
+	if err != nil {
+		t.Fatalf("failed to list categories: %v", err)
+	}
+	var names []string
+	for _, c := range categories {
+		names = append(names, c.Name)
+	}
+	if fmt.Sprint(names) != "[equipment meals parking software travel]" || categories[2] != parking {
+		t.Fatalf("unexpected categories: %v", categories)
+	}
+	meals, travel := categories[1], categories[4]
+
+	for _, e := range []model.Expense{
+		{UserID: 1, OrganizationID: 1, Amount: 100, CategoryID: travel.ID},
+		{UserID: 1, OrganizationID: 1, Amount: 200, CategoryID: meals.ID},
+		{UserID: 1, OrganizationID: 1, Amount: 300},
+		{UserID: 2, OrganizationID: 2, Amount: 400},
+	} {
+		if _, err := manager.CreateExpense(e); err != nil {
+			t.Fatalf("failed to create expense: %v", err)
+		}
+	}
+
+	expense, err := manager.ExpenseByID(1)
+	if err != nil {
+		t.Fatalf("failed to get expense: %v", err)
+	}
+	if expense.CategoryID != travel.ID || expense.Category != "travel" {
+		t.Fatalf("unexpected expense category: %+v", expense)
+	}
+
+	data := []struct {
+		name    string
+		filter  ExpenseFilter
+		amounts []int
+	}{
+		{"all", ExpenseFilter{}, []int{100, 200, 300, 400}},
+		{"organization", ExpenseFilter{OrganizationID: 1}, []int{100, 200, 300}},
+		{"category", ExpenseFilter{OrganizationID: 1, CategoryID: meals.ID}, []int{200}},
+	}
+	for _, d := range data {
+		d := d
+		t.Run(d.name, func(t *testing.T) {
+			expenses, err := manager.ListExpenses(d.filter)
+			if err != nil {
+				t.Fatalf("failed to list expenses: %v", err)
+			}
+			var amounts []int
+			for _, e := range expenses {
+				amounts = append(amounts, e.Amount)
+			}
+			if fmt.Sprint(amounts) != fmt.Sprint(d.amounts) {
+				t.Fatalf("unexpected expenses, got: %v, expected: %v", amounts, d.amounts)
+			}
+		})
+	}
+}
+
+func TestDBManager_ExpenseReports(t *testing.T) {
+	manager := getDBManager(t, "storetest/fixture.sql")
+
+	report, err := manager.CreateExpenseReport(model.ExpenseReport{UserID: 1, OrganizationID: 1, Title: "trip"})
+	if err != nil {
+		t.Fatalf("failed to create report: %v", err)
+	}
+	if report.Status != model.StatusDraft {
+		t.Fatalf("expected report to be created as draft, got: %v", report.Status)
+	}
+
+	var expenses []model.Expense
+	for _, e := range []model.Expense{
+		{UserID: 1, Amount: 100, Status: model.StatusDraft},
+		{UserID: 1, Amount: 200, Status: model.StatusDraft},
+		{UserID: 1, Amount: 400, Status: model.StatusSubmitted},
+	} {
+		created, err := manager.CreateExpense(e)
+		if err != nil {
+			t.Fatalf("failed to create expense: %v", err)
+		}
+		expenses = append(expenses, created)
+	}
+	for _, e := range expenses[:2] {
+		if err := manager.AddExpenseToReport(report.ID, e.ID, 1); err != nil {
+			t.Fatalf("failed to add expense to report: %v", err)
+		}
+	}
+	if err := manager.AddExpenseToReport(report.ID, expenses[2].ID, 1); err == nil {
+		t.Fatalf("expected submitted expense not to be added to report")
+	}
+
+	report, err = manager.ExpenseReportByID(report.ID)
+	if err != nil {
+		t.Fatalf("failed to get report: %v", err)
+	}
+	if report.Total != 300 {
+		t.Fatalf("unexpected report total: %d", report.Total)
+	}
+
+	submit := model.ExpenseEvent{UserID: 1, Action: model.ActionSubmit, From: model.StatusDraft, To: model.StatusSubmitted}
+	report, err = manager.TransitionExpenseReport(report.ID, submit)
+	if err != nil {
+		t.Fatalf("failed to submit report: %v", err)
+	}
+	if report.Status != model.StatusSubmitted || report.Total != 300 {
+		t.Fatalf("unexpected report after submit: %+v", report)
+	}
+	if _, err := manager.TransitionExpenseReport(report.ID, submit); !errors.Is(err, model.ErrInvalidTransition) {
+		t.Fatalf("expected invalid transition error, got: %v", err)
+	}
+
+	inReport, err := manager.ListExpenses(ExpenseFilter{ReportID: report.ID})
+	if err != nil {
+		t.Fatalf("failed to list expenses: %v", err)
+	}
+	if len(inReport) != 2 {
+		t.Fatalf("unexpected expenses in report: %v", inReport)
+	}
+	for _, e := range inReport {
+		if e.Status != model.StatusSubmitted || e.ReportID != report.ID {
+			t.Fatalf("expense was not transitioned with report: %+v", e)
+		}
+		history, err := manager.ExpenseHistory(e.ID)
+		if err != nil {
+			t.Fatalf("failed to get history: %v", err)
+		}
+		if len(history) != 2 || history[1].Action != model.ActionSubmit {
+			t.Fatalf("unexpected history: %+v", history)
+		}
+	}
+
+	// expense transitioned outside of report blocks report transitions
+	_, err = manager.TransitionExpense(model.ExpenseEvent{
+		ExpenseID: inReport[0].ID, UserID: 2, Action: model.ActionApprove, From: model.StatusSubmitted, To: model.StatusApproved,
+	}, 0)
+	if err != nil {
+		t.Fatalf("failed to approve expense: %v", err)
+	}
+	approve := model.ExpenseEvent{UserID: 2, Action: model.ActionApprove, From: model.StatusSubmitted, To: model.StatusApproved}
+	if _, err := manager.TransitionExpenseReport(report.ID, approve); !errors.Is(err, model.ErrInvalidTransition) {
+		t.Fatalf("expected invalid transition error, got: %v", err)
+	}
+	if report, _ := manager.ExpenseReportByID(report.ID); report.Status != model.StatusSubmitted {
+		t.Fatalf("failed transition must be rolled back, got status: %v", report.Status)
+	}
+}
+
+func TestDBManager_CreateExpenses(t *testing.T) {
+	manager := getDBManager(t, "storetest/fixture.sql")
+
+	created, err := manager.CreateExpenses([]model.Expense{
+		{UserID: 1, OrganizationID: 1, Amount: 100, Description: "lunch"},
+		{UserID: 1, OrganizationID: 1, Amount: 200, Description: "dinner", Status: model.StatusDraft},
+	})
+	if err != nil {
+		t.Fatalf("failed to create expenses: %v", err)
+	}
+	if len(created) != 2 || created[0].ID == created[1].ID {
+		t.Fatalf("unexpected created expenses: %+v", created)
+	}
+
+	for _, e := range created {
+		stored, err := manager.ExpenseByID(e.ID)
+		if err != nil {
+			t.Fatalf("failed to get expense: %v", err)
+		}
+		if stored != e {
+			t.Fatalf("stored expense differs, got: %+v, expected: %+v", stored, e)
+		}
+		history, err := manager.ExpenseHistory(e.ID)
+		if err != nil {
+			t.Fatalf("failed to get history: %v", err)
+		}
+		if len(history) != 1 || history[0].Action != model.ActionCreate || history[0].To != e.Status {
+			t.Fatalf("unexpected history: %+v", history)
+		}
+	}
+}
+
+func TestDBManager_EachExpense(t *testing.T) {
+	manager := getDBManager(t, "storetest/fixture.sql")
+
+	// more than one batch
+	count := exportBatchSize + 2
+	in := make([]model.Expense, count)
+	for i := range in {
+		in[i] = model.Expense{UserID: 1, OrganizationID: 1, Amount: i}
+	}
+	if _, err := manager.CreateExpenses(in); err != nil {
+		t.Fatalf("failed to create expenses: %v", err)
+	}
+
+	var amounts []int
+	err := manager.EachExpense(ExpenseFilter{OrganizationID: 1}, func(e model.Expense) error {
+		// database is usable while iterating
+		if _, err := manager.UserByID(e.UserID); err != nil {
+			return err
+		}
+		amounts = append(amounts, e.Amount)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to iterate expenses: %v", err)
+	}
+	if len(amounts) != count {
+		t.Fatalf("expected %d expenses, got %d", count, len(amounts))
+	}
+	for i, amount := range amounts {
+		if amount != i {
+			t.Fatalf("expenses out of order at %d: %d", i, amount)
+		}
+	}
+
+	stop := errors.New("stop")
+	seen := 0
+	err = manager.EachExpense(ExpenseFilter{}, func(model.Expense) error {
+		seen++
+		return stop
+	})
+	if !errors.Is(err, stop) || seen != 1 {
+		t.Fatalf("expected iteration to stop on error, got: %v after %d", err, seen)
+	}
+}
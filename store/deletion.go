@@ -0,0 +1,296 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+// Kinds of records that are soft deleted. Soft deleted records are kept
+// in database, but lookups (e.g. ExpenseByID) do not return them.
+const (
+	KindUser         = "user"
+	KindOrganization = "organization"
+	KindExpense      = "expense"
+)
+
+// DeletedRecord is soft deleted record with time of its deletion.
+type DeletedRecord struct {
+	Kind      string
+	DeletedAt time.Time
+	// Record is model.User, model.Organization or model.Expense, by Kind.
+	Record interface{}
+}
+
+// deletable describes table with soft deleted records of single kind.
+type deletable struct {
+	table string
+	// query selects records with deleted_at as last column
+	query string
+	// organization is column with ID of organization record belongs to
+	organization string
+	scan         func(scanner) (interface{}, error)
+}
+
+var deletables = map[string]deletable{
+	KindUser: {
+		table:        "users",
+		query:        `SELECT id, email, title, organization_id, COALESCE(manager_id, 0), deleted_at FROM users`,
+		organization: "organization_id",
+		scan:         func(row scanner) (interface{}, error) { return scanUser(row) },
+	},
+	KindOrganization: {
+		table:        "organizations",
+		query:        `SELECT id, name, row_version, deleted_at FROM organizations`,
+		organization: "id",
+		scan:         func(row scanner) (interface{}, error) { return scanOrganization(row) },
+	},
+	KindExpense: {
+		table:        "expenses",
+		query:        `SELECT ` + expenseColumns + `, expenses.deleted_at FROM ` + expenseTables,
+		organization: "organization_id",
+		scan:         func(row scanner) (interface{}, error) { return scanExpense(row) },
+	},
+}
+
+// IsDeletable reports if records of provided kind can be soft deleted.
+func IsDeletable(kind string) bool {
+	_, ok := deletables[kind]
+	return ok
+}
+
+func (m *SQLiteManager) SoftDelete(kind string, id, userID, rowVersion int) error {
+	return m.setDeletedAt(kind, id, userID, rowVersion, time.Now().UTC(), `deleted_at IS NULL`,
+		fmt.Errorf("no %s for ID %d", kind, id))
+}
+
+func (m *SQLiteManager) Restore(kind string, id, userID int) error {
+	return m.setDeletedAt(kind, id, userID, 0, nil, `deleted_at IS NOT NULL`,
+		fmt.Errorf("no deleted %s for ID %d", kind, id))
+}
+
+// setDeletedAt sets deletion time of record matching condition and row
+// version (zero matches any), nil deletedAt restores it. Change of expense
+// is recorded as its new version.
+func (m *SQLiteManager) setDeletedAt(kind string, id, userID, rowVersion int, deletedAt interface{}, condition string, notFound error) (err error) {
+	d, ok := deletables[kind]
+	if !ok {
+		return fmt.Errorf("unknown kind %q", kind)
+	}
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			err = multierr.Append(err, tx.Rollback())
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	res, err := tx.Exec(`UPDATE `+d.table+` SET deleted_at = ?, row_version = row_version + 1 WHERE id = ? AND (? = 0 OR row_version = ?) AND `+condition,
+		deletedAt, id, rowVersion, rowVersion)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		if err := expectVersion(tx, d.table, id, rowVersion); err != nil {
+			return err
+		}
+		return notFound
+	}
+	if kind == KindExpense {
+		return insertVersion(tx, id, userID, time.Time{})
+	}
+	return nil
+}
+
+func (m *SQLiteManager) DeletedRecords(kind string, organizationID int) ([]DeletedRecord, error) {
+	d, ok := deletables[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown kind %q", kind)
+	}
+	query := d.query + ` WHERE ` + d.table + `.deleted_at IS NOT NULL`
+	var args []interface{}
+	if organizationID != 0 {
+		query += ` AND ` + d.table + `.` + d.organization + ` = ?`
+		args = append(args, organizationID)
+	}
+
+	rows, err := m.db.Query(query+` ORDER BY `+d.table+`.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []DeletedRecord{}
+	for rows.Next() {
+		record, err := scanDeleted(kind, d, rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func (m *SQLiteManager) DeletedRecordByID(kind string, id int) (DeletedRecord, error) {
+	d, ok := deletables[kind]
+	if !ok {
+		return DeletedRecord{}, fmt.Errorf("unknown kind %q", kind)
+	}
+	row := m.db.QueryRow(d.query+` WHERE `+d.table+`.deleted_at IS NOT NULL AND `+d.table+`.id = ?`, id)
+	switch record, err := scanDeleted(kind, d, row); err {
+	case sql.ErrNoRows:
+		return DeletedRecord{}, fmt.Errorf("no deleted %s for ID %d", kind, id)
+	case nil:
+		return record, nil
+	default:
+		return DeletedRecord{}, err // unknown error, just propagate
+	}
+}
+
+func scanDeleted(kind string, d deletable, row scanner) (DeletedRecord, error) {
+	var deletedAt time.Time
+	record, err := d.scan(extraScanner{scanner: row, extra: []interface{}{&deletedAt}})
+	if err != nil {
+		return DeletedRecord{}, err
+	}
+	return DeletedRecord{Kind: kind, DeletedAt: deletedAt, Record: record}, nil
+}
+
+// purgeable describes table with soft deleted records for purging.
+type purgeable struct {
+	table string
+	// referenced is condition matching records remaining rows reference,
+	// those are kept
+	referenced string
+	// dependents are rows that only belong to purged records and go with
+	// them, as table and column referencing purged record
+	dependents [][2]string
+}
+
+// purgeables are purged in order, so records referenced only by records
+// purged before them go in the same run.
+var purgeables = []purgeable{
+	{
+		table:      "expenses",
+		referenced: `FALSE`,
+		dependents: [][2]string{{"expense_events", "expense_id"}, {"expense_versions", "expense_id"}},
+	},
+	{
+		table: "users",
+		referenced: `EXISTS (SELECT 1 FROM expenses WHERE expenses.user_id = users.id)
+			OR EXISTS (SELECT 1 FROM expense_reports WHERE expense_reports.user_id = users.id)
+			OR EXISTS (SELECT 1 FROM expense_events WHERE expense_events.user_id = users.id)
+			OR EXISTS (SELECT 1 FROM expense_versions WHERE expense_versions.user_id = users.id)
+			OR EXISTS (SELECT 1 FROM users AS reports WHERE reports.manager_id = users.id)
+			OR EXISTS (SELECT 1 FROM impersonations WHERE users.id IN (impersonations.real_user_id, impersonations.effective_user_id))`,
+		dependents: [][2]string{{"memberships", "user_id"}, {"sessions", "user_id"},
+			{"delegations", "delegator_id"}, {"delegations", "delegate_id"}},
+	},
+	{
+		table: "organizations",
+		referenced: `EXISTS (SELECT 1 FROM users WHERE users.organization_id = organizations.id)
+			OR EXISTS (SELECT 1 FROM expenses WHERE expenses.organization_id = organizations.id)
+			OR EXISTS (SELECT 1 FROM expense_reports WHERE expense_reports.organization_id = organizations.id)
+			OR EXISTS (SELECT 1 FROM impersonations WHERE impersonations.organization_id = organizations.id)`,
+		dependents: [][2]string{{"memberships", "organization_id"}, {"categories", "organization_id"},
+			{"api_keys", "organization_id"}},
+	},
+}
+
+func (m *SQLiteManager) PurgeDeleted(before time.Time) (purged int, err error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		if err != nil {
+			err = multierr.Append(err, tx.Rollback())
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	before = before.UTC()
+	for _, p := range purgeables {
+		condition := `deleted_at < ? AND NOT (` + p.referenced + `)`
+		// purging record can release other record of the same table,
+		// e.g. manager of purged user, so repeat until nothing changes
+		for {
+			for _, d := range p.dependents {
+				_, err = tx.Exec(`DELETE FROM `+d[0]+` WHERE `+d[1]+` IN (SELECT id FROM `+p.table+` WHERE `+condition+`)`, before)
+				if err != nil {
+					return 0, err
+				}
+			}
+			res, err := tx.Exec(`DELETE FROM `+p.table+` WHERE `+condition, before)
+			if err != nil {
+				return 0, err
+			}
+			affected, err := res.RowsAffected()
+			if err != nil {
+				return 0, err
+			}
+			if affected == 0 {
+				break
+			}
+			purged += int(affected)
+		}
+	}
+	return purged, nil
+}
+
+// extraScanner scans additional trailing columns into extra, so scan
+// functions can be reused for queries with more columns.
+type extraScanner struct {
+	scanner
+	extra []interface{}
+}
+
+func (s extraScanner) Scan(dest ...interface{}) error {
+	return s.scanner.Scan(append(dest, s.extra...)...)
+}
+
+// expectVersion returns ErrRecordChanged if record with provided ID in
+// table exists in other than provided row version, zero matches any.
+func expectVersion(tx *sql.Tx, table string, id, rowVersion int) error {
+	if rowVersion == 0 {
+		return nil
+	}
+	var current int
+	err := tx.QueryRow(`SELECT row_version FROM `+table+` WHERE id = ?`, id).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if current != rowVersion {
+		return fmt.Errorf("%w: %s %d has version %d, not %d", ErrRecordChanged, table, id, current, rowVersion)
+	}
+	return nil
+}
+
+// expectAffected returns provided error if statement changed no rows.
+func expectAffected(res sql.Result, notFound error) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return notFound
+	}
+	return nil
+}
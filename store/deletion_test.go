@@ -0,0 +1,231 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+func TestDBManager_SoftDelete(t *testing.T) {
+	manager := getDBManager(t, "storetest/fixture.sql")
+	if err := manager.RawExec(`
+		INSERT INTO organizations ("id", "name") VALUES (2, 'Other Org');
+		INSERT INTO users ("id", "email", "title", "organization_id") VALUES (2, 'other@example.com', 'developer',  2);
+	`); err != nil {
+		t.Fatalf("failed to insert data: %v", err)
+	}
+	kept, err := manager.CreateExpense(model.Expense{UserID: 1, OrganizationID: 1, Amount: 100})
+	if err != nil {
+		t.Fatalf("failed to create expense: %v", err)
+	}
+	deleted, err := manager.CreateExpense(model.Expense{UserID: 1, OrganizationID: 1, Amount: 200})
+	if err != nil {
+		t.Fatalf("failed to create expense: %v", err)
+	}
+
+	for _, d := range []struct {
+		kind string
+		id   int
+	}{{KindExpense, deleted.ID}, {KindUser, 2}, {KindOrganization, 2}} {
+		if err := manager.SoftDelete(d.kind, d.id, 1, 0); err != nil {
+			t.Fatalf("failed to delete %s: %v", d.kind, err)
+		}
+		if err := manager.SoftDelete(d.kind, d.id, 1, 0); err == nil {
+			t.Fatalf("expected error deleting %s twice", d.kind)
+		}
+	}
+	if err := manager.SoftDelete("planet", 1, 1, 0); err == nil {
+		t.Fatalf("expected error for unknown kind")
+	}
+
+	// lookups do not see deleted records
+	if _, err := manager.ExpenseByID(deleted.ID); err == nil {
+		t.Fatalf("expected deleted expense not to be found")
+	}
+	if _, err := manager.UserByEmail("other@example.com"); err == nil {
+		t.Fatalf("expected deleted user not to be found")
+	}
+	if _, err := manager.UserByID(2); err == nil {
+		t.Fatalf("expected deleted user not to be found")
+	}
+	if _, err := manager.OrganizationByID(2); err == nil {
+		t.Fatalf("expected deleted organization not to be found")
+	}
+	expenses, err := manager.ListExpenses(ExpenseFilter{})
+	if err != nil {
+		t.Fatalf("failed to list expenses: %v", err)
+	}
+	if len(expenses) != 1 || expenses[0].ID != kept.ID {
+		t.Fatalf("unexpected expenses: %v", expenses)
+	}
+	if total, err := manager.SpentInMonth(1, time.Now()); err != nil || total != 100 {
+		t.Fatalf("unexpected monthly total: %d, %v", total, err)
+	}
+
+	records, err := manager.DeletedRecords(KindExpense, 1)
+	if err != nil {
+		t.Fatalf("failed to list deleted expenses: %v", err)
+	}
+	if len(records) != 1 || records[0].Record.(model.Expense).ID != deleted.ID || records[0].DeletedAt.IsZero() {
+		t.Fatalf("unexpected deleted expenses: %+v", records)
+	}
+	if records, err := manager.DeletedRecords(KindUser, 1); err != nil || len(records) != 0 {
+		t.Fatalf("unexpected deleted users of organization 1: %+v, %v", records, err)
+	}
+	if records, err := manager.DeletedRecords(KindUser, 0); err != nil || len(records) != 1 {
+		t.Fatalf("unexpected deleted users: %+v, %v", records, err)
+	}
+	record, err := manager.DeletedRecordByID(KindOrganization, 2)
+	if err != nil {
+		t.Fatalf("failed to get deleted organization: %v", err)
+	}
+	if record.Kind != KindOrganization || record.Record.(model.Organization).Name != "Other Org" {
+		t.Fatalf("unexpected deleted organization: %+v", record)
+	}
+	if _, err := manager.DeletedRecordByID(KindExpense, kept.ID); err == nil {
+		t.Fatalf("expected error for expense that is not deleted")
+	}
+
+	if err := manager.Restore(KindUser, 2, 1); err != nil {
+		t.Fatalf("failed to restore user: %v", err)
+	}
+	if _, err := manager.UserByID(2); err == nil {
+		t.Fatalf("expected restored user of deleted organization not to be found")
+	}
+	if err := manager.Restore(KindUser, 2, 1); err == nil {
+		t.Fatalf("expected error restoring user that is not deleted")
+	}
+
+	// records are purged only after retention
+	purged, err := manager.PurgeDeleted(time.Now().Add(-time.Hour))
+	if err != nil || purged != 0 {
+		t.Fatalf("unexpected purge: %d, %v", purged, err)
+	}
+	// organization 2 is kept, restored user still belongs to it
+	purged, err = manager.PurgeDeleted(time.Now().Add(time.Hour))
+	if err != nil || purged != 1 {
+		t.Fatalf("unexpected purge: %d, %v", purged, err)
+	}
+	if _, err := manager.DeletedRecordByID(KindOrganization, 2); err != nil {
+		t.Fatalf("expected referenced organization to be kept: %v", err)
+	}
+	if _, err := manager.DeletedRecordByID(KindExpense, deleted.ID); err == nil {
+		t.Fatalf("expected purged expense to be gone")
+	}
+	if history, err := manager.ExpenseHistory(deleted.ID); err != nil || len(history) != 0 {
+		t.Fatalf("expected history of purged expense to be gone: %v, %v", history, err)
+	}
+	if history, err := manager.ExpenseHistory(kept.ID); err != nil || len(history) != 1 {
+		t.Fatalf("expected history of kept expense: %v, %v", history, err)
+	}
+}
+
+func TestDBManager_SoftDeleteVersion(t *testing.T) {
+	manager := getDBManager(t, "storetest/fixture.sql")
+	expense, err := manager.CreateExpense(model.Expense{UserID: 1, OrganizationID: 1, Amount: 100, Status: model.StatusDraft})
+	if err != nil {
+		t.Fatalf("failed to create expense: %v", err)
+	}
+	// someone else changes expense after it was loaded
+	if _, err := manager.TransitionExpense(model.ExpenseEvent{
+		ExpenseID: expense.ID, UserID: 1, Action: model.ActionSubmit, From: model.StatusDraft, To: model.StatusSubmitted,
+	}, expense.RowVersion); err != nil {
+		t.Fatalf("failed to submit expense: %v", err)
+	}
+
+	if err := manager.SoftDelete(KindExpense, expense.ID, 1, expense.RowVersion); !errors.Is(err, ErrRecordChanged) {
+		t.Fatalf("expected record changed error, got: %v", err)
+	}
+	current, err := manager.ExpenseByID(expense.ID)
+	if err != nil {
+		t.Fatalf("expected changed expense not to be deleted: %v", err)
+	}
+	if err := manager.SoftDelete(KindExpense, expense.ID, 1, current.RowVersion); err != nil {
+		t.Fatalf("failed to delete expense in current version: %v", err)
+	}
+}
+
+func TestDBManager_PurgeDeleted(t *testing.T) {
+	manager := getDBManager(t, "storetest/fixture.sql")
+	if err := manager.RawExec(`
+		INSERT INTO organizations ("id", "name") VALUES (2, 'Other Org');
+		INSERT INTO categories ("id", "organization_id", "name") VALUES (5, 2, 'travel');
+		INSERT INTO users ("id", "email", "title", "organization_id") VALUES (2, 'manager@example.com', 'developer',  2);
+		INSERT INTO users ("id", "email", "title", "organization_id", "manager_id") VALUES (3, 'report@example.com', 'developer',  2, 2);
+		INSERT INTO users ("id", "email", "title", "organization_id") VALUES (4, 'audited@example.com', 'developer',  1);
+		INSERT INTO memberships ("user_id", "organization_id", "title") VALUES (1, 2, 'developer');
+		INSERT INTO delegations ("delegator_id", "delegate_id", "starts_at", "ends_at") VALUES (2, 3, '2001-01-01 00:00:00+00:00', '2001-02-01 00:00:00+00:00');
+		INSERT INTO sessions ("user_id", "token_hash", "csrf_token", "created_at", "rotated_at", "expires_at") VALUES (2, 'hash', 'csrf', '2001-01-01 00:00:00+00:00', '2001-01-01 00:00:00+00:00', '2001-01-02 00:00:00+00:00');
+		INSERT INTO api_keys ("organization_id", "name", "key_hash", "created_at") VALUES (2, 'batch', 'hash', '2001-01-01 00:00:00+00:00');
+		INSERT INTO impersonations ("organization_id", "real_user_id", "effective_user_id", "method", "path", "created_at") VALUES (1, 1, 4, 'GET', '/whoami', '2001-01-01 00:00:00+00:00');
+	`); err != nil {
+		t.Fatalf("failed to insert data: %v", err)
+	}
+	expense, err := manager.CreateExpense(model.Expense{UserID: 3, OrganizationID: 2, Amount: 100, CategoryID: 5})
+	if err != nil {
+		t.Fatalf("failed to create expense: %v", err)
+	}
+	purge := func(expected int) {
+		t.Helper()
+		if purged, err := manager.PurgeDeleted(time.Now().Add(time.Hour)); err != nil || purged != expected {
+			t.Fatalf("unexpected purge, expected %d: %d, %v", expected, purged, err)
+		}
+	}
+	count := func(query string) int {
+		t.Helper()
+		var n int
+		if err := manager.db.QueryRow(query).Scan(&n); err != nil {
+			t.Fatalf("failed to count %q: %v", query, err)
+		}
+		return n
+	}
+
+	// manager still manages user 3 and organization has users, both stay
+	for _, d := range []struct {
+		kind string
+		id   int
+	}{{KindUser, 2}, {KindOrganization, 2}, {KindUser, 4}} {
+		if err := manager.SoftDelete(d.kind, d.id, 1, 0); err != nil {
+			t.Fatalf("failed to delete %s: %v", d.kind, err)
+		}
+	}
+	purge(0)
+
+	// once managed user and its expense are gone, manager and organization
+	// go too, user referenced by audit log stays
+	for _, d := range []struct {
+		kind string
+		id   int
+	}{{KindExpense, expense.ID}, {KindUser, 3}} {
+		if err := manager.SoftDelete(d.kind, d.id, 1, 0); err != nil {
+			t.Fatalf("failed to delete %s: %v", d.kind, err)
+		}
+	}
+	purge(4)
+	if _, err := manager.DeletedRecordByID(KindUser, 4); err != nil {
+		t.Fatalf("expected audited user to be kept: %v", err)
+	}
+
+	// nothing references purged records
+	for _, query := range []string{
+		`SELECT COUNT(*) FROM users WHERE id IN (2, 3)`,
+		`SELECT COUNT(*) FROM organizations WHERE id = 2`,
+		`SELECT COUNT(*) FROM memberships WHERE user_id NOT IN (SELECT id FROM users) OR organization_id NOT IN (SELECT id FROM organizations)`,
+		`SELECT COUNT(*) FROM sessions WHERE user_id NOT IN (SELECT id FROM users)`,
+		`SELECT COUNT(*) FROM delegations WHERE delegator_id NOT IN (SELECT id FROM users) OR delegate_id NOT IN (SELECT id FROM users)`,
+		`SELECT COUNT(*) FROM categories WHERE organization_id NOT IN (SELECT id FROM organizations)`,
+		`SELECT COUNT(*) FROM api_keys WHERE organization_id NOT IN (SELECT id FROM organizations)`,
+		`SELECT COUNT(*) FROM expense_events WHERE expense_id NOT IN (SELECT id FROM expenses)`,
+		`SELECT COUNT(*) FROM expense_versions WHERE expense_id NOT IN (SELECT id FROM expenses)`,
+	} {
+		if n := count(query); n != 0 {
+			t.Fatalf("expected no rows for %q, got %d", query, n)
+		}
+	}
+	// remaining user keeps home membership
+	if n := count(`SELECT COUNT(*) FROM memberships WHERE user_id = 1`); n != 1 {
+		t.Fatalf("expected home membership of remaining user, got %d", n)
+	}
+}
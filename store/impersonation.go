@@ -0,0 +1,41 @@
+package store
+
+import (
+	"time"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+func (m *SQLiteManager) RecordImpersonation(in model.Impersonation) (model.Impersonation, error) {
+	in.CreatedAt = time.Now().UTC()
+	res, err := m.db.Exec(`INSERT INTO impersonations (organization_id, real_user_id, effective_user_id, method, path, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		in.OrganizationID, in.RealUserID, in.EffectiveUserID, in.Method, in.Path, in.CreatedAt)
+	if err != nil {
+		return model.Impersonation{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return model.Impersonation{}, err
+	}
+	in.ID = int(id)
+	return in, nil
+}
+
+func (m *SQLiteManager) Impersonations(organizationID int) ([]model.Impersonation, error) {
+	rows, err := m.db.Query(`SELECT id, organization_id, real_user_id, effective_user_id, method, path, created_at
+		FROM impersonations WHERE organization_id = ? ORDER BY id`, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	impersonations := []model.Impersonation{}
+	for rows.Next() {
+		var i model.Impersonation
+		if err := rows.Scan(&i.ID, &i.OrganizationID, &i.RealUserID, &i.EffectiveUserID, &i.Method, &i.Path, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		impersonations = append(impersonations, i)
+	}
+	return impersonations, rows.Err()
+}
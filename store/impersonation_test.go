@@ -0,0 +1,33 @@
+package store
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+func TestDBManager_Impersonations(t *testing.T) {
+	manager := getDBManager(t, "storetest/fixture.sql")
+
+	recorded, err := manager.RecordImpersonation(model.Impersonation{
+		OrganizationID: 1, RealUserID: 2, EffectiveUserID: 1, Method: "GET", Path: "/expenses",
+	})
+	if err != nil {
+		t.Fatalf("failed to record impersonation: %v", err)
+	}
+	if recorded.ID == 0 || recorded.CreatedAt.IsZero() {
+		t.Fatalf("unexpected impersonation: %+v", recorded)
+	}
+
+	impersonations, err := manager.Impersonations(1)
+	if err != nil || len(impersonations) != 1 || impersonations[0].ID != recorded.ID || impersonations[0].Path != "/expenses" {
+		t.Fatalf("unexpected impersonations: %+v, %v", impersonations, err)
+	}
+	if other, err := manager.Impersonations(2); err != nil || len(other) != 0 {
+		t.Fatalf("expected no impersonations in other organization, got %+v, %v", other, err)
+	}
+	if _, err := ForTenant(manager, 2).Impersonations(1); !errors.Is(err, ErrOtherTenant) {
+		t.Fatalf("expected audit of other organization to be hidden, got %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+package store
+
+import (
+	"fmt"
+
+	"go.uber.org/multierr"
+)
+
+// migrations change schema of databases created by earlier versions of
+// Schema. Each migration is applied once, index of last applied migration
+// is tracked in SQLite user_version pragma. Migrations are append only,
+// existing ones must never be changed.
+var migrations = []string{
+	// 1: approval workflow
+	`ALTER TABLE "expenses" ADD COLUMN "organization_id" integer;
+	UPDATE "expenses" SET "organization_id" = (SELECT "organization_id" FROM "users" WHERE "users"."id" = "expenses"."user_id");
+	ALTER TABLE "expenses" ADD COLUMN "status" varchar NOT NULL DEFAULT 'submitted';
+	CREATE TABLE "expense_events"
+	(
+	    "id"         integer PRIMARY KEY AUTOINCREMENT NOT NULL,
+	    "expense_id" integer NOT NULL,
+	    "user_id"    integer NOT NULL,
+	    "action"     varchar NOT NULL,
+	    "from"       varchar NOT NULL,
+	    "to"         varchar NOT NULL,
+	    "created_at" timestamp NOT NULL,
+	    CONSTRAINT "fk_expense_events_expenses"
+	        FOREIGN KEY ("expense_id")
+	            REFERENCES "expenses" ("id")
+	);`,
+
+	// 2: manager hierarchy and delegated approvals
+	`ALTER TABLE "users" ADD COLUMN "manager_id" integer REFERENCES "users" ("id");
+	CREATE TABLE "delegations"
+	(
+	    "id"           integer PRIMARY KEY AUTOINCREMENT NOT NULL,
+	    "delegator_id" integer NOT NULL,
+	    "delegate_id"  integer NOT NULL,
+	    "starts_at"    timestamp NOT NULL,
+	    "ends_at"      timestamp NOT NULL,
+	    CONSTRAINT "fk_delegations_delegator"
+	        FOREIGN KEY ("delegator_id")
+	            REFERENCES "users" ("id"),
+	    CONSTRAINT "fk_delegations_delegate"
+	        FOREIGN KEY ("delegate_id")
+	            REFERENCES "users" ("id")
+	);`,
+
+	// 3: expense categories, existing organizations get default ones
+	`CREATE TABLE "categories"
+	(
+	    "id"              integer PRIMARY KEY AUTOINCREMENT NOT NULL,
+	    "organization_id" integer NOT NULL,
+	    "name"            varchar NOT NULL,
+	    CONSTRAINT "fk_categories_organizations"
+	        FOREIGN KEY ("organization_id")
+	            REFERENCES "organizations" ("id"),
+	    UNIQUE ("organization_id", "name")
+	);
+	INSERT INTO "categories" ("organization_id", "name")
+	    SELECT "organizations"."id", "defaults"."name" FROM "organizations"
+	    CROSS JOIN (SELECT 'travel' AS "name" UNION SELECT 'meals' UNION SELECT 'equipment' UNION SELECT 'software') AS "defaults";
+	ALTER TABLE "expenses" ADD COLUMN "category_id" integer REFERENCES "categories" ("id");`,
+
+	// 4: expense reports
+	`CREATE TABLE "expense_reports"
+	(
+	    "id"              integer PRIMARY KEY AUTOINCREMENT NOT NULL,
+	    "user_id"         integer NOT NULL,
+	    "organization_id" integer NOT NULL,
+	    "title"           varchar NOT NULL,
+	    "status"          varchar NOT NULL,
+	    CONSTRAINT "fk_expense_reports_users"
+	        FOREIGN KEY ("user_id")
+	            REFERENCES "users" ("id")
+	);
+	ALTER TABLE "expenses" ADD COLUMN "report_id" integer REFERENCES "expense_reports" ("id");`,
+
+	// 5: creation time of expenses, taken from history for existing ones
+	`ALTER TABLE "expenses" ADD COLUMN "created_at" timestamp;
+	UPDATE "expenses" SET "created_at" = (SELECT MIN("created_at") FROM "expense_events" WHERE "expense_id" = "expenses"."id");`,
+
+	// 6: soft deletion
+	`ALTER TABLE "users" ADD COLUMN "deleted_at" timestamp;
+	ALTER TABLE "organizations" ADD COLUMN "deleted_at" timestamp;
+	ALTER TABLE "expenses" ADD COLUMN "deleted_at" timestamp;`,
+
+	// 7: versioned snapshots of expenses, existing ones get their first
+	`CREATE TABLE "expense_versions"
+	(
+	    "id"          integer PRIMARY KEY AUTOINCREMENT NOT NULL,
+	    "expense_id"  integer NOT NULL,
+	    "version"     integer NOT NULL,
+	    "user_id"     integer NOT NULL,
+	    "amount"      integer NOT NULL,
+	    "description" varchar NOT NULL,
+	    "status"      varchar NOT NULL,
+	    "category_id" integer,
+	    "report_id"   integer,
+	    "deleted_at"  timestamp,
+	    "created_at"  timestamp NOT NULL,
+	    CONSTRAINT "fk_expense_versions_expenses"
+	        FOREIGN KEY ("expense_id")
+	            REFERENCES "expenses" ("id"),
+	    UNIQUE ("expense_id", "version")
+	);
+	INSERT INTO "expense_versions" ("expense_id", "version", "user_id", "amount", "description", "status", "category_id", "report_id", "deleted_at", "created_at")
+	    SELECT "id", 1, "user_id", "amount", "description", "status", "category_id", "report_id", "deleted_at", COALESCE("created_at", CURRENT_TIMESTAMP) FROM "expenses";`,
+
+	// 8: row versions, incremented on every update of the row
+	`ALTER TABLE "users" ADD COLUMN "row_version" integer NOT NULL DEFAULT 1;
+	ALTER TABLE "organizations" ADD COLUMN "row_version" integer NOT NULL DEFAULT 1;
+	ALTER TABLE "expenses" ADD COLUMN "row_version" integer NOT NULL DEFAULT 1;`,
+
+	// 9: users belonging to multiple organizations, users are always
+	// members of organization they were created in
+	`CREATE TABLE "memberships"
+	(
+	    "user_id"         integer NOT NULL REFERENCES "users" ("id"),
+	    "organization_id" integer NOT NULL REFERENCES "organizations" ("id"),
+	    "title"           varchar NOT NULL,
+	    PRIMARY KEY ("user_id", "organization_id")
+	);
+	INSERT INTO "memberships" ("user_id", "organization_id", "title")
+	    SELECT "id", "organization_id", COALESCE("title", '') FROM "users" WHERE "organization_id" IS NOT NULL;
+	CREATE TRIGGER "users_home_membership" AFTER INSERT ON "users" WHEN NEW."organization_id" IS NOT NULL
+	BEGIN
+	    INSERT OR IGNORE INTO "memberships" ("user_id", "organization_id", "title")
+	        VALUES (NEW."id", NEW."organization_id", COALESCE(NEW."title", ''));
+	END;`,
+
+	// 10: API keys of service accounts, only hashes of keys are stored
+	`CREATE TABLE "api_keys"
+	(
+	    "id"              integer PRIMARY KEY AUTOINCREMENT NOT NULL,
+	    "organization_id" integer NOT NULL REFERENCES "organizations" ("id"),
+	    "name"            varchar NOT NULL,
+	    "key_hash"        varchar NOT NULL UNIQUE,
+	    "scopes"          varchar NOT NULL DEFAULT '',
+	    "expires_at"      timestamp,
+	    "created_at"      timestamp NOT NULL,
+	    "revoked_at"      timestamp
+	);`,
+
+	// 11: cookie sessions, only hashes of session tokens are stored
+	`CREATE TABLE "sessions"
+	(
+	    "id"         integer PRIMARY KEY AUTOINCREMENT NOT NULL,
+	    "user_id"    integer NOT NULL REFERENCES "users" ("id"),
+	    "token_hash" varchar NOT NULL UNIQUE,
+	    "csrf_token" varchar NOT NULL,
+	    "created_at" timestamp NOT NULL,
+	    "rotated_at" timestamp NOT NULL,
+	    "expires_at" timestamp NOT NULL,
+	    "revoked_at" timestamp
+	);
+	CREATE INDEX "sessions_user_id" ON "sessions" ("user_id");`,
+
+	// 12: audit of requests admins make as other users
+	`CREATE TABLE "impersonations"
+	(
+	    "id"                integer PRIMARY KEY AUTOINCREMENT NOT NULL,
+	    "organization_id"   integer NOT NULL REFERENCES "organizations" ("id"),
+	    "real_user_id"      integer NOT NULL REFERENCES "users" ("id"),
+	    "effective_user_id" integer NOT NULL REFERENCES "users" ("id"),
+	    "method"            varchar NOT NULL,
+	    "path"              varchar NOT NULL,
+	    "created_at"        timestamp NOT NULL
+	);`,
+
+	// 13: token replaced by rotation keeps working for a while
+	`ALTER TABLE "sessions" ADD COLUMN "previous_token_hash" varchar;
+	CREATE INDEX "sessions_previous_token_hash" ON "sessions" ("previous_token_hash");`,
+}
+
+// applyMigrations applies all migrations not yet applied to the database.
+func (m *SQLiteManager) applyMigrations() error {
+	var version int
+	if err := m.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+	for i := version; i < len(migrations); i++ {
+		if err := m.applyMigration(i); err != nil {
+			return fmt.Errorf("applying migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (m *SQLiteManager) applyMigration(i int) (err error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			err = multierr.Append(err, tx.Rollback())
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	if _, err := tx.Exec(migrations[i]); err != nil {
+		return err
+	}
+	// pragma does not support placeholders
+	_, err = tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1))
+	return err
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+// sessionTokenPrefix starts every session token.
+const sessionTokenPrefix = "exs_"
+
+// RotatedTokenGrace is how long session token replaced by rotation keeps
+// working, so requests sent together with the one that rotated it, still
+// carrying the old token, do not end up logged out.
+const RotatedTokenGrace = time.Minute
+
+// sessionTokenMatch matches session by its token, or by token replaced
+// by rotation less than RotatedTokenGrace ago. Token hash is bound twice,
+// followed by start of grace.
+const sessionTokenMatch = `(token_hash = ? OR (previous_token_hash = ? AND rotated_at > ?))`
+
+const sessionQuery = `SELECT id, user_id, csrf_token, created_at, rotated_at, expires_at, revoked_at FROM sessions`
+
+func scanSession(row scanner) (model.Session, error) {
+	var s model.Session
+	var revokedAt sql.NullTime
+
+	if err := row.Scan(&s.ID, &s.UserID, &s.CSRFToken, &s.CreatedAt, &s.RotatedAt, &s.ExpiresAt, &revokedAt); err != nil {
+		return model.Session{}, err
+	}
+	s.RevokedAt = revokedAt.Time
+	return s, nil
+}
+
+func (m *SQLiteManager) CreateSession(in model.Session) (model.Session, string, error) {
+	token, hash, err := newToken(sessionTokenPrefix)
+	if err != nil {
+		return model.Session{}, "", err
+	}
+	csrf := make([]byte, 32)
+	if _, err := rand.Read(csrf); err != nil {
+		return model.Session{}, "", fmt.Errorf("generating CSRF token: %w", err)
+	}
+	in.CSRFToken = base64.RawURLEncoding.EncodeToString(csrf)
+	in.CreatedAt = time.Now().UTC()
+	in.RotatedAt = in.CreatedAt
+	in.ExpiresAt = in.ExpiresAt.UTC()
+	in.RevokedAt = time.Time{}
+
+	res, err := m.db.Exec(`INSERT INTO sessions (user_id, token_hash, csrf_token, created_at, rotated_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		in.UserID, hash, in.CSRFToken, in.CreatedAt, in.RotatedAt, in.ExpiresAt)
+	if err != nil {
+		return model.Session{}, "", err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return model.Session{}, "", err
+	}
+	in.ID = int(id)
+	return in, token, nil
+}
+
+func (m *SQLiteManager) SessionByToken(token string) (model.Session, error) {
+	hash := hashToken(token)
+	row := m.db.QueryRow(sessionQuery+` WHERE `+sessionTokenMatch, hash, hash, time.Now().UTC().Add(-RotatedTokenGrace))
+	switch s, err := scanSession(row); err {
+	case sql.ErrNoRows:
+		// token itself is never part of errors, errors end up in logs
+		return model.Session{}, fmt.Errorf("no session for provided token")
+	case nil:
+		return s, nil
+	default:
+		return model.Session{}, err // unknown error, just propagate
+	}
+}
+
+func (m *SQLiteManager) RotateSession(token string) (string, error) {
+	rotated, hash, err := newToken(sessionTokenPrefix)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	res, err := m.db.Exec(`UPDATE sessions SET previous_token_hash = token_hash, token_hash = ?, rotated_at = ?
+		WHERE token_hash = ? AND revoked_at IS NULL AND expires_at > ?`, hash, now, hashToken(token), now)
+	if err != nil {
+		return "", err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if affected == 0 {
+		return "", fmt.Errorf("no active session for provided token")
+	}
+	return rotated, nil
+}
+
+func (m *SQLiteManager) RevokeSession(token string) error {
+	now, hash := time.Now().UTC(), hashToken(token)
+	res, err := m.db.Exec(`UPDATE sessions SET revoked_at = ? WHERE `+sessionTokenMatch+` AND revoked_at IS NULL`,
+		now, hash, hash, now.Add(-RotatedTokenGrace))
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("no active session for provided token")
+	}
+	return nil
+}
+
+func (m *SQLiteManager) RevokeUserSessions(userID int) (int, error) {
+	now := time.Now().UTC()
+	res, err := m.db.Exec(`UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?`, now, userID, now)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := res.RowsAffected()
+	return int(affected), err
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+func TestDBManager_RevokeRotatedSession(t *testing.T) {
+	manager := getDBManager(t, "storetest/fixture.sql")
+	_, token, err := manager.CreateSession(model.Session{UserID: 1, ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	rotated, err := manager.RotateSession(token)
+	if err != nil {
+		t.Fatalf("failed to rotate session: %v", err)
+	}
+
+	// logging out with old token ends session, new token included
+	if err := manager.RevokeSession(token); err != nil {
+		t.Fatalf("failed to revoke session with old token: %v", err)
+	}
+	if found, err := manager.SessionByToken(rotated); err != nil || found.IsActive(time.Now()) {
+		t.Fatalf("expected session to be revoked: %+v, %v", found, err)
+	}
+}
+
+func TestDBManager_Sessions(t *testing.T) {
+	manager := getDBManager(t, "storetest/fixture.sql")
+
+	expiresAt := time.Now().Add(time.Hour)
+	created, token, err := manager.CreateSession(model.Session{UserID: 1, ExpiresAt: expiresAt})
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	if created.ID == 0 || created.CSRFToken == "" || !strings.HasPrefix(token, sessionTokenPrefix) {
+		t.Fatalf("unexpected session %+v with token %q", created, token)
+	}
+
+	found, err := manager.SessionByToken(token)
+	if err != nil {
+		t.Fatalf("failed to find session: %v", err)
+	}
+	if found.ID != created.ID || found.UserID != 1 || found.CSRFToken != created.CSRFToken || !found.IsActive(time.Now()) {
+		t.Fatalf("expected %+v, got %+v", created, found)
+	}
+	if found.IsActive(expiresAt) {
+		t.Fatalf("expected session not to be active once it expires")
+	}
+
+	// rotated token replaces old one, CSRF token stays
+	rotated, err := manager.RotateSession(token)
+	if err != nil {
+		t.Fatalf("failed to rotate session: %v", err)
+	}
+	if found, err := manager.SessionByToken(rotated); err != nil || found.ID != created.ID || found.CSRFToken != created.CSRFToken {
+		t.Fatalf("unexpected rotated session: %+v, %v", found, err)
+	}
+	// old token keeps working for requests sent in parallel, until grace
+	// passes
+	if found, err := manager.SessionByToken(token); err != nil || found.ID != created.ID {
+		t.Fatalf("expected old token to work right after rotation: %+v, %v", found, err)
+	}
+	if _, err := manager.RotateSession(token); err == nil {
+		t.Fatalf("expected old token not to rotate session again")
+	}
+	if err := manager.RawExec(`UPDATE sessions SET rotated_at = '2001-01-01 00:00:00+00:00'`); err != nil {
+		t.Fatalf("failed to move rotation to past: %v", err)
+	}
+	if _, err := manager.SessionByToken(token); err == nil {
+		t.Fatalf("expected old token to stop working after grace")
+	}
+	if err := manager.RevokeSession(token); err == nil {
+		t.Fatalf("expected old token not to revoke session after grace")
+	}
+
+	if err := manager.RevokeSession(rotated); err != nil {
+		t.Fatalf("failed to revoke session: %v", err)
+	}
+	if err := manager.RevokeSession(rotated); err == nil {
+		t.Fatalf("expected error revoking session twice")
+	}
+	if _, err := manager.RotateSession(rotated); err == nil {
+		t.Fatalf("expected revoked session not to rotate")
+	}
+	if revoked, err := manager.SessionByToken(rotated); err != nil || revoked.IsActive(time.Now()) {
+		t.Fatalf("expected revoked session not to be active: %+v, %v", revoked, err)
+	}
+
+	// log out everywhere ends only active sessions
+	for i := 0; i < 2; i++ {
+		if _, _, err := manager.CreateSession(model.Session{UserID: 1, ExpiresAt: expiresAt}); err != nil {
+			t.Fatalf("failed to create session: %v", err)
+		}
+	}
+	if ended, err := manager.RevokeUserSessions(1); err != nil || ended != 2 {
+		t.Fatalf("expected 2 sessions to end, got %d, %v", ended, err)
+	}
+
+	if _, _, err := ForTenant(manager, 2).CreateSession(model.Session{UserID: 1, ExpiresAt: expiresAt}); !errors.Is(err, ErrOtherTenant) {
+		t.Fatalf("expected other tenant not to create session of user, got %v", err)
+	}
+}
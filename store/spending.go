@@ -0,0 +1,115 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+// Groupings supported by SpendingTotals.
+const (
+	GroupByUser     = "user"
+	GroupByCategory = "category"
+	GroupByMonth    = "month"
+)
+
+// groupKeys are SQL expressions producing group key for each grouping.
+// Expenses without category are grouped under empty key, as are expenses
+// without recorded history when grouped by month.
+var groupKeys = map[string]string{
+	GroupByUser:     `COALESCE(users.email, '')`,
+	GroupByCategory: `COALESCE(categories.name, '')`,
+	// timestamps are stored in UTC, so month is prefix of the timestamp
+	GroupByMonth: `COALESCE(substr(created.created_at, 1, 7), '')`,
+}
+
+// IsGrouping reports if provided grouping is supported by SpendingTotals.
+func IsGrouping(groupBy string) bool {
+	_, ok := groupKeys[groupBy]
+	return ok
+}
+
+// SpendingQuery describes aggregation done by SpendingTotals. Only spent
+// money is aggregated, drafts and rejected expenses are not counted.
+type SpendingQuery struct {
+	// GroupBy is one of GroupByUser, GroupByCategory or GroupByMonth.
+	GroupBy string
+	// ExpenseIDs limits aggregation to expenses with provided IDs, e.g.
+	// those user is allowed to read. Empty list aggregates nothing.
+	ExpenseIDs []int
+	// From and To limit expenses to those created in [From, To), zero
+	// values do not limit.
+	From, To time.Time
+	// OrganizationID limits aggregation to expenses of organization, zero
+	// does not limit.
+	OrganizationID int
+}
+
+// SpendingTotal is aggregate of single group of expenses.
+type SpendingTotal struct {
+	// Key identifies group, e.g. user email, category name or month
+	// formatted as "2006-01".
+	Key   string
+	Total int
+	Count int
+}
+
+func (m *SQLiteManager) SpendingTotals(q SpendingQuery) ([]SpendingTotal, error) {
+	key, ok := groupKeys[q.GroupBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown grouping %q", q.GroupBy)
+	}
+	totals := []SpendingTotal{}
+	if len(q.ExpenseIDs) == 0 {
+		return totals, nil
+	}
+
+	where := []string{`expenses.status IN (?, ?, ?)`, `expenses.deleted_at IS NULL`}
+	args := []interface{}{model.StatusSubmitted, model.StatusApproved, model.StatusReimbursed}
+
+	placeholders := make([]string, len(q.ExpenseIDs))
+	for i, id := range q.ExpenseIDs {
+		placeholders[i] = "?"
+		args = append(args, id)
+	}
+	where = append(where, `expenses.id IN (`+strings.Join(placeholders, ", ")+`)`)
+
+	if q.OrganizationID != 0 {
+		where = append(where, `expenses.organization_id = ?`)
+		args = append(args, q.OrganizationID)
+	}
+	if !q.From.IsZero() {
+		where = append(where, `created.created_at >= ?`)
+		args = append(args, q.From.UTC())
+	}
+	if !q.To.IsZero() {
+		where = append(where, `created.created_at < ?`)
+		args = append(args, q.To.UTC())
+	}
+
+	// expense is created at time of its first event in history
+	rows, err := m.db.Query(`SELECT `+key+`, SUM(amount), COUNT(*)
+		FROM expenses
+		LEFT JOIN users ON users.id = expenses.user_id
+		LEFT JOIN categories ON categories.id = expenses.category_id
+		LEFT JOIN (
+			SELECT expense_id, MIN(created_at) AS created_at FROM expense_events GROUP BY expense_id
+		) AS created ON created.expense_id = expenses.id
+		WHERE `+strings.Join(where, ` AND `)+`
+		GROUP BY 1 ORDER BY 1`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t SpendingTotal
+		if err := rows.Scan(&t.Key, &t.Total, &t.Count); err != nil {
+			return nil, err
+		}
+		totals = append(totals, t)
+	}
+	return totals, rows.Err()
+}
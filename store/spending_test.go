@@ -0,0 +1,77 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+func TestDBManager_SpendingTotals(t *testing.T) {
+	manager := getDBManager(t, "storetest/fixture.sql")
+	if err := manager.RawExec(`
+		INSERT INTO users ("id", "email", "title", "organization_id") VALUES (2, 'other@example.com', 'developer',  1);
+	`); err != nil {
+		t.Fatalf("failed to insert data: %v", err)
+	}
+
+	expenses := []model.Expense{
+		{UserID: 1, Amount: 100, Status: model.StatusSubmitted, CategoryID: 1},
+		{UserID: 1, Amount: 200, Status: model.StatusSubmitted},
+		{UserID: 1, Amount: 400, Status: model.StatusDraft},
+		{UserID: 2, Amount: 800, Status: model.StatusSubmitted, CategoryID: 1},
+		{UserID: 2, Amount: 1600, Status: model.StatusSubmitted},
+	}
+	var ids []int
+	for _, e := range expenses {
+		created, err := manager.CreateExpense(e)
+		if err != nil {
+			t.Fatalf("failed to create expense: %v", err)
+		}
+		ids = append(ids, created.ID)
+	}
+
+	now := time.Now().UTC()
+	month := now.Format("2006-01")
+	readable := ids[:4]
+
+	data := []struct {
+		name     string
+		query    SpendingQuery
+		expected []SpendingTotal
+	}{
+		{"by user", SpendingQuery{GroupBy: GroupByUser, ExpenseIDs: readable}, []SpendingTotal{
+			{Key: "other@example.com", Total: 800, Count: 1},
+			{Key: "test@example.com", Total: 300, Count: 2},
+		}},
+		{"by category", SpendingQuery{GroupBy: GroupByCategory, ExpenseIDs: readable}, []SpendingTotal{
+			{Key: "", Total: 200, Count: 1},
+			{Key: "travel", Total: 900, Count: 2},
+		}},
+		{"by month", SpendingQuery{GroupBy: GroupByMonth, ExpenseIDs: ids}, []SpendingTotal{
+			{Key: month, Total: 2700, Count: 4},
+		}},
+		{"in period", SpendingQuery{GroupBy: GroupByMonth, ExpenseIDs: ids, From: now.Add(-time.Hour), To: now.Add(time.Hour)}, []SpendingTotal{
+			{Key: month, Total: 2700, Count: 4},
+		}},
+		{"before period", SpendingQuery{GroupBy: GroupByMonth, ExpenseIDs: ids, From: now.Add(time.Hour)}, []SpendingTotal{}},
+		{"no expenses", SpendingQuery{GroupBy: GroupByUser}, []SpendingTotal{}},
+	}
+	for _, d := range data {
+		d := d
+		t.Run(d.name, func(t *testing.T) {
+			totals, err := manager.SpendingTotals(d.query)
+			if err != nil {
+				t.Fatalf("failed to get totals: %v", err)
+			}
+			if !reflect.DeepEqual(totals, d.expected) {
+				t.Fatalf("unexpected totals, got: %+v, expected: %+v", totals, d.expected)
+			}
+		})
+	}
+
+	if _, err := manager.SpendingTotals(SpendingQuery{GroupBy: "planet", ExpenseIDs: ids}); err == nil {
+		t.Fatalf("expected error for unknown grouping")
+	}
+}
@@ -1,3 +1,5 @@
 INSERT INTO main.organizations ("id", "name") VALUES (1, 'My Org');
 
 INSERT INTO users ("id", "email", "title", "organization_id") VALUES (1, 'test@example.com', 'developer',  1);
+
+INSERT INTO categories ("id", "organization_id", "name") VALUES (1, 1, 'travel'), (2, 1, 'meals'), (3, 1, 'equipment'), (4, 1, 'software');
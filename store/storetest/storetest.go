@@ -0,0 +1,37 @@
+// Package storetest provides database fixtures for tests of packages
+// that depend on store.
+package storetest
+
+import (
+	_ "embed"
+	"testing"
+
+	"github.com/delicb/oso-go-tutorial/store"
+)
+
+// Fixture contains small data set with one organization, its default
+// categories and one user in it.
+//
+//go:embed fixture.sql
+var Fixture string
+
+// New returns in-memory database with schema created and provided SQL
+// statements (e.g. Fixture) executed.
+func New(t *testing.T, data ...string) *store.SQLiteManager {
+	t.Helper()
+	manager, err := store.NewDBManager(":memory:")
+	if err != nil {
+		t.Fatalf("failed to create db instance: %v", err)
+	}
+	t.Cleanup(func() { _ = manager.Close() })
+
+	if err := manager.Migrate(); err != nil {
+		t.Fatalf("failed to create db schema: %v", err)
+	}
+	for _, d := range data {
+		if err := manager.RawExec(d); err != nil {
+			t.Fatalf("failed to execute data: %v", err)
+		}
+	}
+	return manager
+}
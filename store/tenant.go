@@ -0,0 +1,460 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+// ErrOtherTenant is returned by tenant scoped DBManager for records of
+// other organizations. Errors wrapping it also read as record not found.
+var ErrOtherTenant = errors.New("record belongs to other organization")
+
+// ForTenant returns DBManager that only reads and writes records of
+// organization with provided ID, e.g. organization of current user. Records
+// of other organizations are reported as not found, regardless of what
+// policy allows. Users are found if they are members of organization, and
+// are returned acting in it. Tenant zero (e.g. of guests) owns nothing, not
+// even records without organization.
+func ForTenant(db DBManager, organizationID int) DBManager {
+	return &tenantManager{db: db, organizationID: organizationID}
+}
+
+// tenantManager implements every method of DBManager explicitly, so new
+// methods can not skip tenant check by accident.
+type tenantManager struct {
+	db             DBManager
+	organizationID int
+}
+
+// otherTenant returns error for record of provided kind with provided ID
+// that belongs to other organization.
+func otherTenant(kind string, id int) error {
+	return fmt.Errorf("no %s for ID %d: %w", kind, id, ErrOtherTenant)
+}
+
+// owns reports if record of organization with provided ID belongs to
+// tenant.
+func (t *tenantManager) owns(organizationID int) bool {
+	return t.organizationID != 0 && organizationID == t.organizationID
+}
+
+// organizationOf returns ID of organization record belongs to.
+func organizationOf(record interface{}) int {
+	switch r := record.(type) {
+	case model.User:
+		return r.OrganizationID
+	case model.Organization:
+		return r.ID
+	case model.Expense:
+		return r.OrganizationID
+	case model.ExpenseReport:
+		return r.OrganizationID
+	case model.Category:
+		return r.OrganizationID
+	}
+	return 0
+}
+
+func (t *tenantManager) UserByID(id int) (model.User, error) {
+	user, err := t.db.UserByID(id)
+	if err != nil {
+		return model.User{}, err
+	}
+	member, ok := user.InOrganization(t.organizationID)
+	if !ok || !t.owns(member.OrganizationID) {
+		return model.User{}, otherTenant(KindUser, id)
+	}
+	return member, nil
+}
+
+func (t *tenantManager) UserByEmail(email string) (model.User, error) {
+	user, err := t.db.UserByEmail(email)
+	if err != nil {
+		return model.User{}, err
+	}
+	member, ok := user.InOrganization(t.organizationID)
+	if !ok || !t.owns(member.OrganizationID) {
+		return model.User{}, fmt.Errorf("no user for email %s: %w", email, ErrOtherTenant)
+	}
+	return member, nil
+}
+
+func (t *tenantManager) CreateUser(in model.User) (model.User, error) {
+	if !t.owns(in.OrganizationID) {
+		return model.User{}, fmt.Errorf("creating user: %w", ErrOtherTenant)
+	}
+	user, err := t.db.CreateUser(in)
+	if err != nil {
+		return model.User{}, err
+	}
+	member, _ := user.InOrganization(t.organizationID)
+	return member, nil
+}
+
+func (t *tenantManager) Titles(organizationID int) ([]string, error) {
+	// zero organization would list titles of every organization
+	if t.organizationID == 0 {
+		return nil, otherTenant(KindOrganization, 0)
+	}
+	if organizationID != 0 && !t.owns(organizationID) {
+		return nil, otherTenant(KindOrganization, organizationID)
+	}
+	return t.db.Titles(t.organizationID)
+}
+
+func (t *tenantManager) OrganizationByID(id int) (model.Organization, error) {
+	if !t.owns(id) {
+		return model.Organization{}, otherTenant(KindOrganization, id)
+	}
+	return t.db.OrganizationByID(id)
+}
+
+func (t *tenantManager) ExpenseByID(id int) (model.Expense, error) {
+	expense, err := t.db.ExpenseByID(id)
+	if err != nil {
+		return model.Expense{}, err
+	}
+	if !t.owns(expense.OrganizationID) {
+		return model.Expense{}, otherTenant(KindExpense, id)
+	}
+	return expense, nil
+}
+
+func (t *tenantManager) CreateExpense(in model.Expense) (model.Expense, error) {
+	if !t.owns(in.OrganizationID) {
+		return model.Expense{}, fmt.Errorf("creating expense: %w", ErrOtherTenant)
+	}
+	return t.db.CreateExpense(in)
+}
+
+func (t *tenantManager) CreateExpenses(in []model.Expense) ([]model.Expense, error) {
+	for _, expense := range in {
+		if !t.owns(expense.OrganizationID) {
+			return nil, fmt.Errorf("creating expenses: %w", ErrOtherTenant)
+		}
+	}
+	return t.db.CreateExpenses(in)
+}
+
+func (t *tenantManager) TransitionExpense(event model.ExpenseEvent, rowVersion int) (model.Expense, error) {
+	if _, err := t.ExpenseByID(event.ExpenseID); err != nil {
+		return model.Expense{}, err
+	}
+	return t.db.TransitionExpense(event, rowVersion)
+}
+
+func (t *tenantManager) ExpenseHistory(expenseID int) ([]model.ExpenseEvent, error) {
+	if _, err := t.ExpenseByID(expenseID); err != nil {
+		return nil, err
+	}
+	return t.db.ExpenseHistory(expenseID)
+}
+
+func (t *tenantManager) ExpenseVersions(expenseID int) ([]model.ExpenseVersion, error) {
+	if _, err := t.ExpenseByID(expenseID); err != nil {
+		return nil, err
+	}
+	return t.db.ExpenseVersions(expenseID)
+}
+
+func (t *tenantManager) ReportsTo(userID, managerID int) (bool, error) {
+	// users of other organizations are not in management chain
+	for _, id := range []int{userID, managerID} {
+		if _, err := t.UserByID(id); errors.Is(err, ErrOtherTenant) {
+			return false, nil
+		}
+	}
+	return t.db.ReportsTo(userID, managerID)
+}
+
+func (t *tenantManager) ActiveDelegators(delegateID int, at time.Time) ([]int, error) {
+	if _, err := t.UserByID(delegateID); err != nil {
+		return nil, err
+	}
+	all, err := t.db.ActiveDelegators(delegateID, at)
+	if err != nil {
+		return nil, err
+	}
+	delegators := []int{}
+	for _, id := range all {
+		if _, err := t.UserByID(id); err == nil {
+			delegators = append(delegators, id)
+		}
+	}
+	return delegators, nil
+}
+
+func (t *tenantManager) CreateDelegation(in model.Delegation) (model.Delegation, error) {
+	for _, id := range []int{in.DelegatorID, in.DelegateID} {
+		if _, err := t.UserByID(id); err != nil {
+			return model.Delegation{}, err
+		}
+	}
+	return t.db.CreateDelegation(in)
+}
+
+func (t *tenantManager) ListExpenses(filter ExpenseFilter) ([]model.Expense, error) {
+	filter, err := t.expenseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	return t.db.ListExpenses(filter)
+}
+
+func (t *tenantManager) EachExpense(filter ExpenseFilter, fn func(model.Expense) error) error {
+	filter, err := t.expenseFilter(filter)
+	if err != nil {
+		return err
+	}
+	return t.db.EachExpense(filter, fn)
+}
+
+// expenseFilter limits filter to expenses of tenant.
+func (t *tenantManager) expenseFilter(filter ExpenseFilter) (ExpenseFilter, error) {
+	// zero filter would match expenses of every organization
+	if t.organizationID == 0 {
+		return ExpenseFilter{}, otherTenant(KindOrganization, 0)
+	}
+	if filter.OrganizationID != 0 && !t.owns(filter.OrganizationID) {
+		return ExpenseFilter{}, otherTenant(KindOrganization, filter.OrganizationID)
+	}
+	filter.OrganizationID = t.organizationID
+	return filter, nil
+}
+
+func (t *tenantManager) CategoryByID(id int) (model.Category, error) {
+	category, err := t.db.CategoryByID(id)
+	if err != nil {
+		return model.Category{}, err
+	}
+	if !t.owns(category.OrganizationID) {
+		return model.Category{}, otherTenant("category", id)
+	}
+	return category, nil
+}
+
+func (t *tenantManager) CategoriesByOrganization(organizationID int) ([]model.Category, error) {
+	if !t.owns(organizationID) {
+		return nil, otherTenant(KindOrganization, organizationID)
+	}
+	return t.db.CategoriesByOrganization(organizationID)
+}
+
+func (t *tenantManager) CreateCategory(in model.Category) (model.Category, error) {
+	if !t.owns(in.OrganizationID) {
+		return model.Category{}, fmt.Errorf("creating category: %w", ErrOtherTenant)
+	}
+	return t.db.CreateCategory(in)
+}
+
+func (t *tenantManager) ExpenseReportByID(id int) (model.ExpenseReport, error) {
+	report, err := t.db.ExpenseReportByID(id)
+	if err != nil {
+		return model.ExpenseReport{}, err
+	}
+	if !t.owns(report.OrganizationID) {
+		return model.ExpenseReport{}, otherTenant("expense report", id)
+	}
+	return report, nil
+}
+
+func (t *tenantManager) CreateExpenseReport(in model.ExpenseReport) (model.ExpenseReport, error) {
+	if !t.owns(in.OrganizationID) {
+		return model.ExpenseReport{}, fmt.Errorf("creating expense report: %w", ErrOtherTenant)
+	}
+	return t.db.CreateExpenseReport(in)
+}
+
+func (t *tenantManager) AddExpenseToReport(reportID, expenseID, userID int) error {
+	if _, err := t.ExpenseReportByID(reportID); err != nil {
+		return err
+	}
+	if _, err := t.ExpenseByID(expenseID); err != nil {
+		return err
+	}
+	return t.db.AddExpenseToReport(reportID, expenseID, userID)
+}
+
+func (t *tenantManager) TransitionExpenseReport(reportID int, event model.ExpenseEvent) (model.ExpenseReport, error) {
+	if _, err := t.ExpenseReportByID(reportID); err != nil {
+		return model.ExpenseReport{}, err
+	}
+	return t.db.TransitionExpenseReport(reportID, event)
+}
+
+func (t *tenantManager) SpentInMonth(userID int, month time.Time) (int, error) {
+	if _, err := t.UserByID(userID); err != nil {
+		return 0, err
+	}
+	return t.db.SpentInMonth(userID, month)
+}
+
+func (t *tenantManager) SoftDelete(kind string, id, userID, rowVersion int) error {
+	var record interface{}
+	var err error
+	switch kind {
+	case KindUser:
+		// users are deleted by organization they were created in, not by
+		// other organizations they are members of
+		record, err = t.db.UserByID(id)
+	case KindOrganization:
+		record, err = t.db.OrganizationByID(id)
+	case KindExpense:
+		record, err = t.db.ExpenseByID(id)
+	default:
+		return fmt.Errorf("unknown kind %q", kind)
+	}
+	if err != nil {
+		return err
+	}
+	if !t.owns(organizationOf(record)) {
+		return otherTenant(kind, id)
+	}
+	return t.db.SoftDelete(kind, id, userID, rowVersion)
+}
+
+func (t *tenantManager) Restore(kind string, id, userID int) error {
+	if _, err := t.DeletedRecordByID(kind, id); err != nil {
+		return err
+	}
+	return t.db.Restore(kind, id, userID)
+}
+
+func (t *tenantManager) DeletedRecords(kind string, organizationID int) ([]DeletedRecord, error) {
+	// zero organization would list records of every organization
+	if t.organizationID == 0 {
+		return nil, otherTenant(KindOrganization, 0)
+	}
+	if organizationID != 0 && !t.owns(organizationID) {
+		return nil, otherTenant(KindOrganization, organizationID)
+	}
+	return t.db.DeletedRecords(kind, t.organizationID)
+}
+
+func (t *tenantManager) DeletedRecordByID(kind string, id int) (DeletedRecord, error) {
+	record, err := t.db.DeletedRecordByID(kind, id)
+	if err != nil {
+		return DeletedRecord{}, err
+	}
+	if !t.owns(organizationOf(record.Record)) {
+		return DeletedRecord{}, otherTenant(kind, id)
+	}
+	return record, nil
+}
+
+func (t *tenantManager) PurgeDeleted(before time.Time) (int, error) {
+	// retention applies to whole database, purging is maintenance task
+	return 0, errors.New("purging deleted records is not possible for single organization")
+}
+
+func (t *tenantManager) SpendingTotals(q SpendingQuery) ([]SpendingTotal, error) {
+	// zero organization would aggregate expenses of every organization
+	if t.organizationID == 0 {
+		return nil, otherTenant(KindOrganization, 0)
+	}
+	q.OrganizationID = t.organizationID
+	return t.db.SpendingTotals(q)
+}
+
+func (t *tenantManager) CreateServiceAccount(in model.ServiceAccount) (model.ServiceAccount, string, error) {
+	if !t.owns(in.OrganizationID) {
+		return model.ServiceAccount{}, "", fmt.Errorf("creating service account: %w", ErrOtherTenant)
+	}
+	return t.db.CreateServiceAccount(in)
+}
+
+func (t *tenantManager) ServiceAccountByID(id int) (model.ServiceAccount, error) {
+	sa, err := t.db.ServiceAccountByID(id)
+	if err != nil {
+		return model.ServiceAccount{}, err
+	}
+	if !t.owns(sa.OrganizationID) {
+		return model.ServiceAccount{}, otherTenant("service account", id)
+	}
+	return sa, nil
+}
+
+func (t *tenantManager) ServiceAccountByKey(key string) (model.ServiceAccount, error) {
+	sa, err := t.db.ServiceAccountByKey(key)
+	if err != nil {
+		return model.ServiceAccount{}, err
+	}
+	if !t.owns(sa.OrganizationID) {
+		return model.ServiceAccount{}, fmt.Errorf("no service account for provided key: %w", ErrOtherTenant)
+	}
+	return sa, nil
+}
+
+func (t *tenantManager) ServiceAccounts(organizationID int) ([]model.ServiceAccount, error) {
+	if !t.owns(organizationID) {
+		return nil, otherTenant(KindOrganization, organizationID)
+	}
+	return t.db.ServiceAccounts(organizationID)
+}
+
+func (t *tenantManager) RevokeServiceAccount(id int) error {
+	if _, err := t.ServiceAccountByID(id); err != nil {
+		return err
+	}
+	return t.db.RevokeServiceAccount(id)
+}
+
+func (t *tenantManager) CreateSession(in model.Session) (model.Session, string, error) {
+	if _, err := t.UserByID(in.UserID); err != nil {
+		return model.Session{}, "", fmt.Errorf("creating session: %w", err)
+	}
+	return t.db.CreateSession(in)
+}
+
+func (t *tenantManager) SessionByToken(token string) (model.Session, error) {
+	s, err := t.db.SessionByToken(token)
+	if err != nil {
+		return model.Session{}, err
+	}
+	// sessions belong to users, they are visible to organizations user is member of
+	if _, err := t.UserByID(s.UserID); err != nil {
+		return model.Session{}, fmt.Errorf("no session for provided token: %w", err)
+	}
+	return s, nil
+}
+
+func (t *tenantManager) RotateSession(token string) (string, error) {
+	if _, err := t.SessionByToken(token); err != nil {
+		return "", err
+	}
+	return t.db.RotateSession(token)
+}
+
+func (t *tenantManager) RevokeSession(token string) error {
+	if _, err := t.SessionByToken(token); err != nil {
+		return err
+	}
+	return t.db.RevokeSession(token)
+}
+
+func (t *tenantManager) RevokeUserSessions(userID int) (int, error) {
+	if _, err := t.UserByID(userID); err != nil {
+		return 0, err
+	}
+	return t.db.RevokeUserSessions(userID)
+}
+
+func (t *tenantManager) RecordImpersonation(in model.Impersonation) (model.Impersonation, error) {
+	if !t.owns(in.OrganizationID) {
+		return model.Impersonation{}, fmt.Errorf("recording impersonation: %w", ErrOtherTenant)
+	}
+	return t.db.RecordImpersonation(in)
+}
+
+func (t *tenantManager) Impersonations(organizationID int) ([]model.Impersonation, error) {
+	if !t.owns(organizationID) {
+		return nil, otherTenant(KindOrganization, organizationID)
+	}
+	return t.db.Impersonations(organizationID)
+}
+
+// build time guarantee that tenantManager implement DBManager
+var _ DBManager = &tenantManager{}
@@ -0,0 +1,205 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+const tenantData = `
+INSERT INTO organizations ("id", "name") VALUES (2, 'Other Org');
+INSERT INTO users ("id", "email", "title", "organization_id") VALUES (2, 'other@example.com', 'developer',  2);
+INSERT INTO categories ("id", "organization_id", "name") VALUES (5, 2, 'travel');
+INSERT INTO expenses ("id", "user_id", "amount", "description", "organization_id", "status") VALUES (1, 1, 100, 'own', 1, 'draft');
+INSERT INTO expenses ("id", "user_id", "amount", "description", "organization_id", "status") VALUES (2, 2, 200, 'other', 2, 'draft');
+INSERT INTO expense_reports ("id", "user_id", "organization_id", "title", "status") VALUES (1, 1, 1, 'own', 'draft');
+INSERT INTO expense_reports ("id", "user_id", "organization_id", "title", "status") VALUES (2, 2, 2, 'other', 'draft');
+`
+
+func TestForTenant(t *testing.T) {
+	manager := getDBManager(t, "storetest/fixture.sql")
+	if err := manager.RawExec(tenantData); err != nil {
+		t.Fatalf("failed to insert data: %v", err)
+	}
+	db := ForTenant(manager, 1)
+
+	// every access to records of organization 2 has to fail
+	data := []struct {
+		name string
+		call func() error
+	}{
+		{"user by ID", func() error { _, err := db.UserByID(2); return err }},
+		{"user by email", func() error { _, err := db.UserByEmail("other@example.com"); return err }},
+		{"organization", func() error { _, err := db.OrganizationByID(2); return err }},
+		{"expense", func() error { _, err := db.ExpenseByID(2); return err }},
+		{"create expense", func() error {
+			_, err := db.CreateExpense(model.Expense{UserID: 2, OrganizationID: 2, Amount: 1})
+			return err
+		}},
+		{"create expenses", func() error {
+			_, err := db.CreateExpenses([]model.Expense{{UserID: 1, OrganizationID: 1}, {UserID: 2, OrganizationID: 2}})
+			return err
+		}},
+		{"transition expense", func() error {
+			_, err := db.TransitionExpense(model.ExpenseEvent{ExpenseID: 2, UserID: 1, Action: model.ActionSubmit, From: model.StatusDraft, To: model.StatusSubmitted}, 0)
+			return err
+		}},
+		{"expense history", func() error { _, err := db.ExpenseHistory(2); return err }},
+		{"expense versions", func() error { _, err := db.ExpenseVersions(2); return err }},
+		{"active delegators", func() error { _, err := db.ActiveDelegators(2, time.Now()); return err }},
+		{"create delegation", func() error {
+			_, err := db.CreateDelegation(model.Delegation{DelegatorID: 1, DelegateID: 2, StartsAt: time.Now(), EndsAt: time.Now().Add(time.Hour)})
+			return err
+		}},
+		{"list expenses of organization", func() error { _, err := db.ListExpenses(ExpenseFilter{OrganizationID: 2}); return err }},
+		{"each expense of organization", func() error {
+			return db.EachExpense(ExpenseFilter{OrganizationID: 2}, func(model.Expense) error { return nil })
+		}},
+		{"category", func() error { _, err := db.CategoryByID(5); return err }},
+		{"categories", func() error { _, err := db.CategoriesByOrganization(2); return err }},
+		{"create category", func() error { _, err := db.CreateCategory(model.Category{OrganizationID: 2, Name: "x"}); return err }},
+		{"expense report", func() error { _, err := db.ExpenseReportByID(2); return err }},
+		{"create expense report", func() error {
+			_, err := db.CreateExpenseReport(model.ExpenseReport{UserID: 2, OrganizationID: 2, Title: "x"})
+			return err
+		}},
+		{"add expense to report", func() error { return db.AddExpenseToReport(1, 2, 1) }},
+		{"add to report", func() error { return db.AddExpenseToReport(2, 1, 1) }},
+		{"transition expense report", func() error {
+			_, err := db.TransitionExpenseReport(2, model.ExpenseEvent{UserID: 1, Action: model.ActionSubmit, From: model.StatusDraft, To: model.StatusSubmitted})
+			return err
+		}},
+		{"spent in month", func() error { _, err := db.SpentInMonth(2, time.Now()); return err }},
+		{"soft delete expense", func() error { return db.SoftDelete(KindExpense, 2, 1, 0) }},
+		{"soft delete user", func() error { return db.SoftDelete(KindUser, 2, 1, 0) }},
+		{"soft delete organization", func() error { return db.SoftDelete(KindOrganization, 2, 1, 0) }},
+		{"deleted records of organization", func() error { _, err := db.DeletedRecords(KindExpense, 2); return err }},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.name, func(t *testing.T) {
+			if err := d.call(); !errors.Is(err, ErrOtherTenant) {
+				t.Fatalf("expected other tenant error, got: %v", err)
+			}
+		})
+	}
+
+	// nothing above changed records of other organization
+	other, err := manager.ExpenseByID(2)
+	if err != nil || other.Status != model.StatusDraft || other.ReportID != 0 || other.RowVersion != 1 {
+		t.Fatalf("expense of other organization was changed: %+v, %v", other, err)
+	}
+	if _, err := manager.UserByID(2); err != nil {
+		t.Fatalf("user of other organization was changed: %v", err)
+	}
+	if _, err := manager.OrganizationByID(2); err != nil {
+		t.Fatalf("other organization was changed: %v", err)
+	}
+	if expenses, err := manager.ListExpenses(ExpenseFilter{}); err != nil || len(expenses) != 2 {
+		t.Fatalf("expected no created expenses, got: %v, %v", expenses, err)
+	}
+
+	// lists contain records of tenant only
+	expenses, err := db.ListExpenses(ExpenseFilter{})
+	if err != nil || len(expenses) != 1 || expenses[0].ID != 1 {
+		t.Fatalf("expected only own expense, got: %v, %v", expenses, err)
+	}
+	if err := manager.SoftDelete(KindExpense, 2, 2, 0); err != nil {
+		t.Fatalf("failed to delete expense: %v", err)
+	}
+	if records, err := db.DeletedRecords(KindExpense, 0); err != nil || len(records) != 0 {
+		t.Fatalf("expected no deleted records of tenant, got: %v, %v", records, err)
+	}
+	if _, err := db.DeletedRecordByID(KindExpense, 2); !errors.Is(err, ErrOtherTenant) {
+		t.Fatalf("expected other tenant error for deleted record, got: %v", err)
+	}
+	if err := db.Restore(KindExpense, 2, 1); !errors.Is(err, ErrOtherTenant) {
+		t.Fatalf("expected other tenant error for restore, got: %v", err)
+	}
+	if managed, err := db.ReportsTo(2, 1); err != nil || managed {
+		t.Fatalf("expected user of other organization outside of management chain, got: %v, %v", managed, err)
+	}
+	if _, err := db.PurgeDeleted(time.Now()); err == nil {
+		t.Fatalf("expected purge to be refused for tenant")
+	}
+
+	// records of tenant are accessible
+	if _, err := db.ExpenseByID(1); err != nil {
+		t.Fatalf("failed to get own expense: %v", err)
+	}
+	if err := db.AddExpenseToReport(1, 1, 1); err != nil {
+		t.Fatalf("failed to add own expense to own report: %v", err)
+	}
+}
+
+func TestForTenant_Zero(t *testing.T) {
+	manager := getDBManager(t, "storetest/fixture.sql")
+	if err := manager.RawExec(tenantData + `
+		INSERT INTO expenses ("id", "user_id", "amount", "description", "status") VALUES (3, 1, 300, 'no organization', 'draft');
+	`); err != nil {
+		t.Fatalf("failed to insert data: %v", err)
+	}
+	// guests have no organization, they must not reach records without one
+	db := ForTenant(manager, 0)
+
+	data := []struct {
+		name string
+		call func() error
+	}{
+		{"expense without organization", func() error { _, err := db.ExpenseByID(3); return err }},
+		{"list expenses", func() error { _, err := db.ListExpenses(ExpenseFilter{}); return err }},
+		{"deleted records", func() error { _, err := db.DeletedRecords(KindExpense, 0); return err }},
+		{"spending totals", func() error { _, err := db.SpendingTotals(SpendingQuery{}); return err }},
+		{"organization", func() error { _, err := db.OrganizationByID(0); return err }},
+	}
+	for _, d := range data {
+		d := d
+		t.Run(d.name, func(t *testing.T) {
+			if err := d.call(); !errors.Is(err, ErrOtherTenant) {
+				t.Fatalf("expected other tenant error, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestForTenant_DeletedOrganization(t *testing.T) {
+	manager := getDBManager(t, "storetest/fixture.sql")
+	if err := manager.RawExec(tenantData); err != nil {
+		t.Fatalf("failed to insert data: %v", err)
+	}
+	if err := manager.SoftDelete(KindOrganization, 2, 1, 0); err != nil {
+		t.Fatalf("failed to delete organization: %v", err)
+	}
+	db := ForTenant(manager, 2)
+
+	// users and records of deleted organization are gone with it
+	data := []struct {
+		name string
+		call func() error
+	}{
+		{"user by ID", func() error { _, err := db.UserByID(2); return err }},
+		{"user by email", func() error { _, err := db.UserByEmail("other@example.com"); return err }},
+		{"expense", func() error { _, err := db.ExpenseByID(2); return err }},
+		{"expense report", func() error { _, err := db.ExpenseReportByID(2); return err }},
+	}
+	for _, d := range data {
+		if err := d.call(); err == nil {
+			t.Fatalf("%s: expected record of deleted organization not to be found", d.name)
+		}
+	}
+	if expenses, err := db.ListExpenses(ExpenseFilter{}); err != nil || len(expenses) != 0 {
+		t.Fatalf("expected no expenses of deleted organization, got: %v, %v", expenses, err)
+	}
+
+	if err := manager.Restore(KindOrganization, 2, 1); err != nil {
+		t.Fatalf("failed to restore organization: %v", err)
+	}
+	for _, d := range data {
+		if err := d.call(); err != nil {
+			t.Fatalf("%s: expected record of restored organization to be found: %v", d.name, err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+// expenseVersionQuery selects versions with expense columns scanExpense
+// expects, followed by version columns. Snapshot replaces fields that can
+// change, the rest comes from expense. Row version of snapshots is zero.
+const expenseVersionQuery = `SELECT expenses.id, expenses.user_id, expense_versions.amount, expense_versions.description,
+	COALESCE(expenses.organization_id, 0), expense_versions.status, COALESCE(expense_versions.category_id, 0),
+	COALESCE(categories.name, ''), COALESCE(expense_versions.report_id, 0), expenses.created_at, 0,
+	expense_versions.version, expense_versions.user_id, expense_versions.deleted_at IS NOT NULL, expense_versions.created_at
+	FROM expense_versions JOIN expenses ON expenses.id = expense_versions.expense_id
+	LEFT JOIN categories ON categories.id = expense_versions.category_id`
+
+func (m *SQLiteManager) ExpenseVersions(expenseID int) ([]model.ExpenseVersion, error) {
+	rows, err := m.db.Query(expenseVersionQuery+` WHERE expense_versions.expense_id = ? ORDER BY expense_versions.version`, expenseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []model.ExpenseVersion{}
+	for rows.Next() {
+		var v model.ExpenseVersion
+		expense, err := scanExpense(extraScanner{scanner: rows, extra: []interface{}{&v.Version, &v.UserID, &v.Deleted, &v.CreatedAt}})
+		if err != nil {
+			return nil, err
+		}
+		v.Expense = expense
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// insertVersion records current state of expense as its next version,
+// created by user with provided ID. Creation time is set to now if at is zero.
+func insertVersion(tx *sql.Tx, expenseID, userID int, at time.Time) error {
+	if at.IsZero() {
+		at = time.Now().UTC()
+	}
+	_, err := tx.Exec(`INSERT INTO expense_versions (expense_id, version, user_id, amount, description, status, category_id, report_id, deleted_at, created_at)
+		SELECT id, (SELECT COALESCE(MAX(version), 0) + 1 FROM expense_versions WHERE expense_id = expenses.id),
+			?, amount, description, status, category_id, report_id, deleted_at, ?
+		FROM expenses WHERE id = ?`, userID, at, expenseID)
+	return err
+}
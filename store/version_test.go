@@ -0,0 +1,79 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/delicb/oso-go-tutorial/model"
+)
+
+func TestDBManager_ExpenseVersions(t *testing.T) {
+	manager := getDBManager(t, "storetest/fixture.sql")
+	if err := manager.RawExec(`INSERT INTO users ("id", "email", "title", "organization_id") VALUES (2, 'admin@example.com', 'admin',  1);`); err != nil {
+		t.Fatalf("failed to insert data: %v", err)
+	}
+
+	expense, err := manager.CreateExpense(model.Expense{UserID: 1, OrganizationID: 1, Amount: 100, Status: model.StatusDraft})
+	if err != nil {
+		t.Fatalf("failed to create expense: %v", err)
+	}
+	report, err := manager.CreateExpenseReport(model.ExpenseReport{UserID: 1, OrganizationID: 1, Title: "trip"})
+	if err != nil {
+		t.Fatalf("failed to create report: %v", err)
+	}
+	if err := manager.AddExpenseToReport(report.ID, expense.ID, 1); err != nil {
+		t.Fatalf("failed to add expense to report: %v", err)
+	}
+	if _, err := manager.TransitionExpenseReport(report.ID, model.ExpenseEvent{UserID: 1, Action: model.ActionSubmit, From: model.StatusDraft, To: model.StatusSubmitted}); err != nil {
+		t.Fatalf("failed to submit report: %v", err)
+	}
+	if err := manager.SoftDelete(KindExpense, expense.ID, 2, 0); err != nil {
+		t.Fatalf("failed to delete expense: %v", err)
+	}
+	if err := manager.Restore(KindExpense, expense.ID, 2); err != nil {
+		t.Fatalf("failed to restore expense: %v", err)
+	}
+	// failed changes do not create versions
+	if err := manager.AddExpenseToReport(report.ID, expense.ID, 1); err == nil {
+		t.Fatalf("expected error adding submitted expense to report")
+	}
+
+	versions, err := manager.ExpenseVersions(expense.ID)
+	if err != nil {
+		t.Fatalf("failed to get versions: %v", err)
+	}
+	expected := []struct {
+		userID   int
+		status   model.ExpenseStatus
+		reportID int
+		deleted  bool
+	}{
+		{1, model.StatusDraft, 0, false},
+		{1, model.StatusDraft, report.ID, false},
+		{1, model.StatusSubmitted, report.ID, false},
+		{2, model.StatusSubmitted, report.ID, true},
+		{2, model.StatusSubmitted, report.ID, false},
+	}
+	if len(versions) != len(expected) {
+		t.Fatalf("expected %d versions, got: %+v", len(expected), versions)
+	}
+	for i, e := range expected {
+		v := versions[i]
+		if v.Version != i+1 || v.UserID != e.userID || v.Expense.Status != e.status || v.Expense.ReportID != e.reportID || v.Deleted != e.deleted {
+			t.Fatalf("unexpected version %d: %+v", i+1, v)
+		}
+		if v.Expense.ID != expense.ID || v.Expense.Amount != 100 || v.CreatedAt.IsZero() {
+			t.Fatalf("unexpected expense in version %d: %+v", i+1, v)
+		}
+	}
+
+	// versions go with purged expense
+	if err := manager.SoftDelete(KindExpense, expense.ID, 2, 0); err != nil {
+		t.Fatalf("failed to delete expense: %v", err)
+	}
+	if _, err := manager.PurgeDeleted(versions[4].CreatedAt.AddDate(1, 0, 0)); err != nil {
+		t.Fatalf("failed to purge: %v", err)
+	}
+	if versions, err := manager.ExpenseVersions(expense.ID); err != nil || len(versions) != 0 {
+		t.Fatalf("expected no versions of purged expense, got: %+v, %v", versions, err)
+	}
+}